@@ -0,0 +1,82 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/slack-go/slack"
+)
+
+const (
+	AttachmentColorFailure = "danger"
+	AttachmentColorSuccess = "good"
+	AttachmentColorOther   = "warning"
+)
+
+// AttachmentFieldTemplate is a field of ATTACHMENT_FIELDS, whose title and value may hold placeholders like {sha}
+type AttachmentFieldTemplate struct {
+	Title string `json:"title"`
+	Value string `json:"value"`
+	Short bool   `json:"short"`
+}
+
+// buildNotificationFields renders the fields configured in ATTACHMENT_FIELDS for the commit and status
+func buildNotificationFields(config Config, commit Commit, commitStatus CommitStatus) (fields []NotificationField) {
+	if len(config.AttachmentFields) == 0 {
+		return
+	}
+
+	replacer := buildPlaceholderReplacer(config, commit, commitStatus)
+	for _, field := range config.AttachmentFields {
+		fields = append(fields, NotificationField{
+			Title: replacer.Replace(field.Title),
+			Value: replacer.Replace(field.Value),
+			Short: field.Short,
+		})
+	}
+	return
+}
+
+// buildSlackAttachment renders the fields of the notification into an attachment colored by the conclusion of the
+// status, or returns false if there are no fields to show
+func buildSlackAttachment(config Config, notification Notification) (attachment slack.Attachment, ok bool) {
+	if len(notification.Fields) == 0 {
+		return
+	}
+
+	for _, field := range notification.Fields {
+		attachment.Fields = append(attachment.Fields, slack.AttachmentField{
+			Title: field.Title,
+			Value: field.Value,
+			Short: field.Short,
+		})
+	}
+
+	attachment.Color = AttachmentColorOther
+	if notification.Status.Failed(config.FailureConclusions) {
+		attachment.Color = AttachmentColorFailure
+	} else if notification.Status.Succeeded() {
+		attachment.Color = AttachmentColorSuccess
+	}
+	if notification.Color != "" {
+		attachment.Color = notification.Color
+	}
+	ok = true
+	return
+}
+
+// buildPlaceholderReplacer substitutes the {name} placeholders of user templates with the commit and status data, and
+// the extra placeholder and value pairs
+func buildPlaceholderReplacer(config Config, commit Commit, commitStatus CommitStatus, extra ...string) *strings.Replacer {
+	return strings.NewReplacer(append([]string{
+		"{repository}", config.GithubRepository,
+		"{run_id}", config.GithubRunID,
+		"{run_number}", config.GithubRunNumber,
+		"{sha}", commit.sha,
+		"{author}", commit.authorUsername,
+		"{title}", escapeMrkdwn(commit.getCommitMessageTitle()),
+		"{status}", commitStatus.Name,
+		"{conclusion}", commitStatus.Conclusion,
+		"{job}", commitStatus.JobName,
+		"{step}", commitStatus.StepName,
+	}, extra...)...)
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBuildNotificationFields(t *testing.T) {
+	config := Config{
+		GithubRepository: "owner/repo",
+		GithubRunID:      "1234",
+		GithubRunNumber:  "42",
+	}
+	commit := Commit{sha: "abc123", authorUsername: "jdoe", commitMessage: "Fix <b> & co\n\nBody"}
+	status := CommitStatus{Name: "build", Conclusion: "failure", JobName: "test", StepName: "go test"}
+	tests := []struct {
+		name      string
+		templates []AttachmentFieldTemplate
+		want      []NotificationField
+	}{
+		{name: "no fields"},
+		{
+			name: "placeholders",
+			templates: []AttachmentFieldTemplate{
+				{Title: "Run", Value: "{repository} #{run_number} ({run_id})", Short: true},
+				{Title: "Commit", Value: "{sha} by {author}: {title}"},
+				{Title: "{status}", Value: "{conclusion} in {job} / {step}", Short: true},
+			},
+			want: []NotificationField{
+				{Title: "Run", Value: "owner/repo #42 (1234)", Short: true},
+				{Title: "Commit", Value: "abc123 by jdoe: Fix &lt;b&gt; &amp; co"},
+				{Title: "build", Value: "failure in test / go test", Short: true},
+			},
+		},
+		{
+			name:      "unknown placeholders and plain text",
+			templates: []AttachmentFieldTemplate{{Title: "Service", Value: "payments {unknown}"}},
+			want:      []NotificationField{{Title: "Service", Value: "payments {unknown}"}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := config
+			config.AttachmentFields = test.templates
+			if got := buildNotificationFields(config, commit, status); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/slack-go/slack"
+)
+
+var (
+	// coAuthorTrailerRegexp matches the trailers GitHub adds for co-authored commits, like "Co-authored-by: Name <email>"
+	coAuthorTrailerRegexp = regexp.MustCompile(`(?im)^Co-authored-by:[ \t]*(.*?)[ \t]*<([^>]*)>[ \t\r]*$`)
+
+	// noreplyEmailRegexp matches the GitHub noreply emails, like 123+octocat@users.noreply.github.com, which tell the
+	// GitHub username
+	noreplyEmailRegexp = regexp.MustCompile(`(?i)^(?:\d+\+)?([a-z0-9-]+)@users\.noreply\.github\.com$`)
+)
+
+// Author is someone to credit for a commit, as far as they are known
+type Author struct {
+	// username is the GitHub username, empty if unknown e.g. for co-authors only known by name
+	username  string
+	name      string
+	email     string
+	slackUser *slack.User
+}
+
+// parseCoAuthors reads the co-authors of the commit from its Co-authored-by trailers and the COMMIT_CO_AUTHORS env
+// var, a comma-separated list of GitHub usernames or emails
+func parseCoAuthors(commitMessage, coAuthorsEnv string) (coAuthors []Author) {
+	for _, match := range coAuthorTrailerRegexp.FindAllStringSubmatch(commitMessage, -1) {
+		coAuthor := Author{name: match[1], email: match[2]}
+		if noreplyMatch := noreplyEmailRegexp.FindStringSubmatch(coAuthor.email); noreplyMatch != nil {
+			coAuthor.username = noreplyMatch[1]
+		}
+		coAuthors = append(coAuthors, coAuthor)
+	}
+	for _, entry := range strings.Split(coAuthorsEnv, ",") {
+		entry = strings.TrimSpace(entry)
+		switch {
+		case entry == "":
+		case looksLikeEmail(entry):
+			coAuthors = append(coAuthors, Author{email: entry})
+		default:
+			coAuthors = append(coAuthors, Author{username: strings.TrimPrefix(entry, "@")})
+		}
+	}
+	return
+}
+
+// resolveAuthors returns the author of the commit followed by its co-authors, found in Slack and de-duplicated, so
+// every author is mentioned once wherever the commit is notified
+func resolveAuthors(userResolver *SlackUserResolver, commit Commit) (authors []Author) {
+	candidates := append([]Author{{username: commit.authorUsername, name: commit.authorName, email: commit.authorEmail}}, commit.coAuthors...)
+	seen := map[string]bool{}
+	for _, author := range candidates {
+		if author.username == "" && author.email == "" {
+			continue
+		}
+		author.slackUser = userResolver.resolveUser(author.email, author.username)
+
+		var keys []string
+		if author.username != "" {
+			keys = append(keys, "github:"+strings.ToLower(author.username))
+		}
+		if author.email != "" {
+			keys = append(keys, "email:"+strings.ToLower(author.email))
+		}
+		if author.slackUser != nil && author.slackUser.ID != "" {
+			keys = append(keys, "slack:"+author.slackUser.ID)
+		}
+		duplicate := false
+		for _, key := range keys {
+			duplicate = duplicate || seen[key]
+		}
+		if duplicate {
+			continue
+		}
+		for _, key := range keys {
+			seen[key] = true
+		}
+		authors = append(authors, author)
+	}
+	return
+}
+
+// hasSlackUser reports whether one of the authors was found to be the Slack user
+func hasSlackUser(authors []Author, slackUser *slack.User) bool {
+	if slackUser == nil || slackUser.ID == "" {
+		return false
+	}
+	for _, author := range authors {
+		if author.slackUser != nil && author.slackUser.ID == slackUser.ID {
+			return true
+		}
+	}
+	return false
+}
+
+// buildAuthorMention mentions the author in Slack, linking their GitHub profile when the username is known
+func buildAuthorMention(config Config, author Author) string {
+	switch {
+	case author.username != "":
+		return buildUserMention(config, author.slackUser, author.username)
+	case author.slackUser != nil && author.slackUser.ID != "":
+		return addAuthorPrefixEmoji(config, "<@"+author.slackUser.ID+">")
+	case author.name != "":
+		return addAuthorPrefixEmoji(config, escapeMrkdwn(author.name))
+	default:
+		return addAuthorPrefixEmoji(config, escapeMrkdwn(author.email))
+	}
+}
+
+// addAuthorPrefixEmoji puts AUTHOR_PREFIX_EMOJI, if any, before the mention
+func addAuthorPrefixEmoji(config Config, mention string) string {
+	if config.AuthorPrefixEmoji == "" {
+		return mention
+	}
+	return config.AuthorPrefixEmoji + " " + mention
+}
+
+// buildAuthorsMention mentions the first author, followed by the others if any, like "@alice with @bob, @carol"
+func buildAuthorsMention(config Config, authors []Author) (mention string) {
+	for i, author := range authors {
+		switch i {
+		case 0:
+			mention = buildAuthorMention(config, author)
+		case 1:
+			mention += " with " + buildAuthorMention(config, author)
+		default:
+			mention += ", " + buildAuthorMention(config, author)
+		}
+	}
+	return
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/slack-go/slack"
+)
+
+func TestParseCoAuthors(t *testing.T) {
+	tests := []struct {
+		name          string
+		commitMessage string
+		coAuthorsEnv  string
+		want          []Author
+	}{
+		{name: "none", commitMessage: "Fix the build\n\nBody"},
+		{
+			name:          "trailer",
+			commitMessage: "Fix the build\n\nCo-authored-by: Jane Doe <jane@example.com>",
+			want:          []Author{{name: "Jane Doe", email: "jane@example.com"}},
+		},
+		{
+			name:          "case and spacing",
+			commitMessage: "Fix\n\nco-authored-by:Jane Doe<jane@example.com>  \nCO-AUTHORED-BY: \tJohn   <john@example.com>\r\n",
+			want:          []Author{{name: "Jane Doe", email: "jane@example.com"}, {name: "John", email: "john@example.com"}},
+		},
+		{
+			name:          "noreply email",
+			commitMessage: "Fix\n\nCo-authored-by: Octo Cat <123+octocat@users.noreply.github.com>",
+			want:          []Author{{username: "octocat", name: "Octo Cat", email: "123+octocat@users.noreply.github.com"}},
+		},
+		{
+			name:          "malformed",
+			commitMessage: "Fix\n\nCo-authored-by: Jane Doe\nCo-authored-by Jane <jane@example.com>\nsee Co-authored-by: John <john@example.com>\nCo-authored-by: Pat <pat@example.com> too",
+		},
+		{
+			name:         "env",
+			coAuthorsEnv: " @jdoe, pat@example.com,, psmith ",
+			want:         []Author{{username: "jdoe"}, {email: "pat@example.com"}, {username: "psmith"}},
+		},
+		{
+			name:          "trailer then env",
+			commitMessage: "Fix\n\nCo-authored-by: Jane <jane@example.com>",
+			coAuthorsEnv:  "jdoe",
+			want:          []Author{{name: "Jane", email: "jane@example.com"}, {username: "jdoe"}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := parseCoAuthors(test.commitMessage, test.coAuthorsEnv)
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestResolveAuthorsDeduplicates(t *testing.T) {
+	userResolver, _ := newFakeUserDirectory(t, Config{}, map[string]string{
+		"jane@example.com":     "U0JANE",
+		"jane.doe@example.com": "U0JANE",
+		"john@example.com":     "U0JOHN",
+	})
+	tests := []struct {
+		name      string
+		coAuthors []Author
+		want      []string
+	}{
+		{name: "no co-authors", want: []string{"jdoe"}},
+		{name: "same username", coAuthors: []Author{{username: "JDoe"}}, want: []string{"jdoe"}},
+		{name: "same email", coAuthors: []Author{{name: "Jane", email: "Jane@Example.com"}}, want: []string{"jdoe"}},
+		{name: "same slack user", coAuthors: []Author{{name: "Jane", email: "jane.doe@example.com"}}, want: []string{"jdoe"}},
+		{name: "without username nor email", coAuthors: []Author{{name: "Ghost"}}, want: []string{"jdoe"}},
+		{
+			name:      "other authors once each",
+			coAuthors: []Author{{name: "John", email: "john@example.com"}, {username: "psmith"}, {username: "jsmith", email: "john@example.com"}, {username: "PSmith"}},
+			want:      []string{"jdoe", "john@example.com", "psmith"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			commit := Commit{authorUsername: "jdoe", authorEmail: "jane@example.com", coAuthors: test.coAuthors}
+			var got []string
+			for _, author := range resolveAuthors(userResolver, commit) {
+				if author.username != "" {
+					got = append(got, author.username)
+				} else {
+					got = append(got, author.email)
+				}
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got authors %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestAuthorPrefixEmoji(t *testing.T) {
+	jane := Author{username: "jdoe", email: "jane@example.com", slackUser: &slack.User{ID: "U0JANE"}}
+	john := Author{name: "John Smith", email: "john@example.com", slackUser: &slack.User{ID: "U0JOHN"}}
+	pat := Author{name: "Pat Smith", email: "pat@gmail.com"}
+	tests := []struct {
+		name    string
+		emoji   string
+		authors []Author
+		want    string
+	}{
+		{name: "no emoji", authors: []Author{jane, john}, want: "<@U0JANE> (<https://github.com/jdoe|jdoe>) with <@U0JOHN>"},
+		{name: "github author", emoji: ":bust_in_silhouette:", authors: []Author{jane}, want: ":bust_in_silhouette: <@U0JANE> (<https://github.com/jdoe|jdoe>)"},
+		{
+			name:    "every co-author",
+			emoji:   ":bust_in_silhouette:",
+			authors: []Author{jane, john, pat},
+			want:    ":bust_in_silhouette: <@U0JANE> (<https://github.com/jdoe|jdoe>) with :bust_in_silhouette: <@U0JOHN>, :bust_in_silhouette: Pat Smith",
+		},
+		{name: "author known by email only", emoji: ":bust_in_silhouette:", authors: []Author{{email: "pat@gmail.com"}}, want: ":bust_in_silhouette: pat@gmail.com"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Setenv("AUTHOR_PREFIX_EMOJI", " "+test.emoji+" ")
+			config := buildConfig()
+			if got := buildAuthorsMention(config, test.authors); got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestHasSlackUser(t *testing.T) {
+	authors := []Author{
+		{username: "jdoe", slackUser: &slack.User{ID: "U0JANE"}},
+		{username: "psmith"},
+		{email: "john@example.com", slackUser: &slack.User{Name: "john"}},
+	}
+	tests := []struct {
+		name      string
+		authors   []Author
+		slackUser *slack.User
+		want      bool
+	}{
+		{name: "an author", authors: authors, slackUser: &slack.User{ID: "U0JANE"}, want: true},
+		{name: "not an author", authors: authors, slackUser: &slack.User{ID: "U0PAT"}, want: false},
+		{name: "no slack user", authors: authors, slackUser: nil, want: false},
+		{name: "slack user without ID", authors: authors, slackUser: &slack.User{Name: "john"}, want: false},
+		{name: "no authors", slackUser: &slack.User{ID: "U0JANE"}, want: false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := hasSlackUser(test.authors, test.slackUser); got != test.want {
+				t.Errorf("got %t, want %t", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/slack-go/slack"
+)
+
+const (
+	// MessageMetadataEventType tags the messages posted by this action, so they can be found later
+	MessageMetadataEventType = "ci_notification"
+
+	PostTargetThread = "thread"
+	PostTargetRoot   = "root"
+
+	// ChannelHistoryLookupLimit is how many recent channel messages are checked when looking for previous posts
+	ChannelHistoryLookupLimit = 100
+)
+
+var (
+	channelIDRegexp   = regexp.MustCompile(`^[CGD][A-Z0-9]{8,}$`)
+	channelNameRegexp = regexp.MustCompile(`^#?[a-z0-9_-]{1,80}$`)
+	// overrideChannelIDRegexp only accepts channel IDs, not direct message (D...) or legacy group (G...) ones
+	overrideChannelIDRegexp = regexp.MustCompile(`^C[A-Z0-9]{8,}$`)
+
+	notifyChannelDirectiveRegexp = regexp.MustCompile(`(?im)^Notify-Channel:[ \t]*(\S*)[ \t]*$`)
+)
+
+// isValidChannelName reports whether the channel looks like a Slack channel name or ID
+func isValidChannelName(slackChannel string) bool {
+	return channelNameRegexp.MatchString(slackChannel) || channelIDRegexp.MatchString(slackChannel)
+}
+
+// isValidChannelOverride reports whether a channel coming from an untrusted source, like a commit message, is safe to
+// post to instead of the configured one: a plain channel name or a channel ID, but no direct messages
+func isValidChannelOverride(slackChannel string) bool {
+	return channelNameRegexp.MatchString(slackChannel) || overrideChannelIDRegexp.MatchString(slackChannel)
+}
+
+// parseNotifyChannelDirective finds a "Notify-Channel: #channel" trailer in the commit message. If there are several
+// the last one wins, as with other git trailers.
+func parseNotifyChannelDirective(commitMessage string) (slackChannel string, found bool) {
+	matches := notifyChannelDirectiveRegexp.FindAllStringSubmatch(commitMessage, -1)
+	if len(matches) == 0 {
+		return
+	}
+	slackChannel = matches[len(matches)-1][1]
+	found = true
+	return
+}
+
+// resolveChannelID returns the ID of the channel, looking it up by name if needed. Posting accepts names, but most
+// other conversation endpoints only take IDs. In an Enterprise Grid org names can collide across workspaces, so
+// teamID restricts the lookup to one workspace; it is empty otherwise.
+func resolveChannelID(client *slack.Client, teamID, slackChannel string) (channelID string, err error) {
+	if channelIDRegexp.MatchString(slackChannel) {
+		channelID = slackChannel
+		return
+	}
+
+	channelName := strings.TrimPrefix(slackChannel, "#")
+	params := &slack.GetConversationsParameters{
+		ExcludeArchived: true,
+		Limit:           1000,
+		Types:           []string{"public_channel", "private_channel"},
+		TeamID:          teamID,
+	}
+	for {
+		channels, nextCursor, listErr := client.GetConversations(params)
+		if listErr != nil {
+			err = wrapSlackAuthError(listErr)
+			return
+		}
+		for _, channel := range channels {
+			if channel.Name == channelName {
+				channelID = channel.ID
+				return
+			}
+		}
+		if nextCursor == "" {
+			break
+		}
+		params.Cursor = nextCursor
+	}
+
+	err = fmt.Errorf("%w: %s", ErrChannelNotFound, slackChannel)
+	if teamID != "" {
+		err = fmt.Errorf("%w: %s in team %s", ErrChannelNotFound, slackChannel, teamID)
+	}
+	return
+}
+
+// joinChannel makes the bot join the channel, which only works for public channels
+func joinChannel(client *slack.Client, teamID, slackChannel string) (err error) {
+	channelID, err := resolveChannelID(client, teamID, slackChannel)
+	if err != nil {
+		return
+	}
+	_, _, _, err = client.JoinConversation(channelID)
+	return
+}
+
+// isSlackError reports whether err is the Slack API error with the given code, e.g. "channel_not_found"
+func isSlackError(err error, code string) bool {
+	var slackErr slack.SlackErrorResponse
+	return errors.As(err, &slackErr) && slackErr.Err == code
+}
+
+// buildThreadOptions places the message in the configured thread, if any. A thread reply stays in the thread for
+// triage, while with POST_TARGET=root it is broadcast so it also shows in the channel, e.g. for a final summary.
+func buildThreadOptions(config Config) (options []slack.MsgOption) {
+	if config.SlackThreadTs == "" {
+		return
+	}
+	options = append(options, slack.MsgOptionTS(config.SlackThreadTs))
+	if config.PostTarget == PostTargetRoot {
+		options = append(options, slack.MsgOptionBroadcast())
+	}
+	return
+}
+
+// buildRunMetadata tags a message with the workflow run and commit it was posted for, so it can be found later and
+// Slack apps subscribed to message metadata events can aggregate the notifications
+func buildRunMetadata(config Config, commit Commit, commitStatus CommitStatus) slack.SlackMetadata {
+	return slack.SlackMetadata{
+		EventType: MessageMetadataEventType,
+		EventPayload: map[string]interface{}{
+			"repository": config.GithubRepository,
+			"run_id":     config.GithubRunID,
+			"sha":        commit.sha,
+			"conclusion": commitStatus.Conclusion,
+		},
+	}
+}
+
+// hasRunFailureBeenPosted reports whether a failure for the run was already posted among the recent channel messages
+func hasRunFailureBeenPosted(config Config, client *slack.Client, slackChannel, runID string) (posted bool, err error) {
+	channelID, err := resolveChannelID(client, config.SlackTeamID, slackChannel)
+	if err != nil {
+		return
+	}
+
+	history, err := client.GetConversationHistory(&slack.GetConversationHistoryParameters{
+		ChannelID:          channelID,
+		Limit:              ChannelHistoryLookupLimit,
+		IncludeAllMetadata: true,
+	})
+	if err != nil {
+		return
+	}
+
+	for _, message := range history.Messages {
+		if message.Metadata.EventType != MessageMetadataEventType {
+			continue
+		}
+		payload := message.Metadata.EventPayload
+		postedStatus := CommitStatus{Conclusion: fmt.Sprint(payload["conclusion"])}
+		if payload["run_id"] == runID && postedStatus.Failed(config.FailureConclusions) {
+			posted = true
+			return
+		}
+	}
+	return
+}
+
+// isLatestChannelMessage reports whether the most recent message of the channel has exactly the given text, e.g.
+// because a re-run rendered the same notification again
+func isLatestChannelMessage(client *slack.Client, teamID, slackChannel, message string) (latest bool, err error) {
+	channelID, err := resolveChannelID(client, teamID, slackChannel)
+	if err != nil {
+		return
+	}
+
+	history, err := client.GetConversationHistory(&slack.GetConversationHistoryParameters{
+		ChannelID: channelID,
+		Limit:     1,
+	})
+	if err != nil {
+		return
+	}
+	latest = len(history.Messages) > 0 && history.Messages[0].Text == message
+	return
+}
+
+// isMessageDelivered reports whether the message with the timestamp can be read back from the channel, or from the
+// thread if threadTs is set, to catch messages Slack accepted but did not show
+func isMessageDelivered(ctx context.Context, client *slack.Client, channelID, threadTs, ts string) (delivered bool, err error) {
+	var messages []slack.Message
+	if threadTs != "" {
+		messages, _, _, err = client.GetConversationRepliesContext(ctx, &slack.GetConversationRepliesParameters{
+			ChannelID: channelID,
+			Timestamp: threadTs,
+			Latest:    ts,
+			Oldest:    ts,
+			Inclusive: true,
+		})
+	} else {
+		var history *slack.GetConversationHistoryResponse
+		history, err = client.GetConversationHistoryContext(ctx, &slack.GetConversationHistoryParameters{
+			ChannelID: channelID,
+			Latest:    ts,
+			Oldest:    ts,
+			Inclusive: true,
+			Limit:     1,
+		})
+		if history != nil {
+			messages = history.Messages
+		}
+	}
+	if err != nil {
+		return
+	}
+
+	for _, message := range messages {
+		if message.Timestamp == ts {
+			delivered = true
+			return
+		}
+	}
+	return
+}
+
+// isChannelMember reports whether the user is a member of the channel, going through all the pages of its members
+func isChannelMember(ctx context.Context, client *slack.Client, teamID, slackChannel, userID string) (member bool, err error) {
+	channelID, err := resolveChannelID(client, teamID, slackChannel)
+	if err != nil {
+		return
+	}
+
+	params := &slack.GetUsersInConversationParameters{ChannelID: channelID, Limit: 1000}
+	for {
+		var userIDs []string
+		userIDs, params.Cursor, err = client.GetUsersInConversationContext(ctx, params)
+		if err != nil {
+			return
+		}
+		if slices.Contains(userIDs, userID) {
+			member = true
+			return
+		}
+		if params.Cursor == "" {
+			return
+		}
+	}
+}
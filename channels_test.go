@@ -0,0 +1,528 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/slack-go/slack"
+)
+
+// fakeSlackAPI answers the Slack Web API methods with canned responses, or with the handler of the method if there is
+// one, recording the calls it gets
+type fakeSlackAPI struct {
+	mu        sync.Mutex
+	calls     []string
+	requests  []*http.Request
+	responses map[string][]map[string]any
+	handlers  map[string]func(r *http.Request) map[string]any
+}
+
+func newFakeSlackClient(t *testing.T, api *fakeSlackAPI) *slack.Client {
+	server := httptest.NewServer(api)
+	t.Cleanup(server.Close)
+	return slack.New("xoxb-test", slack.OptionAPIURL(server.URL+"/"))
+}
+
+// ServeHTTP answers with the next response queued for the method, repeating the last one once they run out
+func (f *fakeSlackAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	method := r.URL.Path[1:]
+	f.calls = append(f.calls, method)
+	_ = r.ParseForm()
+	f.requests = append(f.requests, r)
+	if handler, ok := f.handlers[method]; ok {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(handler(r))
+		return
+	}
+	responses := f.responses[method]
+	if len(responses) == 0 {
+		http.Error(w, "unexpected method "+method, http.StatusNotFound)
+		return
+	}
+	response := responses[0]
+	if len(responses) > 1 {
+		f.responses[method] = responses[1:]
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(response)
+}
+
+func (f *fakeSlackAPI) callCount(method string) (count int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, call := range f.calls {
+		if call == method {
+			count++
+		}
+	}
+	return
+}
+
+// formValues returns the value of the form key in each call of the method, in order
+func (f *fakeSlackAPI) formValues(method, key string) (values []string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i, call := range f.calls {
+		if call == method {
+			values = append(values, f.requests[i].Form.Get(key))
+		}
+	}
+	return
+}
+
+func TestSendMessageToChannelJoinsOnNotInChannel(t *testing.T) {
+	api := &fakeSlackAPI{responses: map[string][]map[string]any{
+		"chat.postMessage": {
+			{"ok": false, "error": "not_in_channel"},
+			{"ok": true, "channel": "C0123456789", "ts": "1700000000.000100"},
+		},
+		"conversations.list": {
+			{"ok": true, "channels": []map[string]any{{"id": "C0123456789", "name": "ci"}}},
+		},
+		"conversations.join": {
+			{"ok": true, "channel": map[string]any{"id": "C0123456789"}},
+		},
+	}}
+	client := newFakeSlackClient(t, api)
+
+	respChannel, respTimestamp, err := sendMessageToChannel(context.Background(), Config{}, client, "#ci", "build failed")
+	if err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	if respChannel != "C0123456789" || respTimestamp != "1700000000.000100" {
+		t.Errorf("got channel %q and timestamp %q", respChannel, respTimestamp)
+	}
+	if got := api.callCount("conversations.join"); got != 1 {
+		t.Errorf("got %d joins, want 1", got)
+	}
+	if got := api.callCount("chat.postMessage"); got != 2 {
+		t.Errorf("got %d posts, want 2", got)
+	}
+}
+
+func TestSendMessageToChannelExplainsChannelNotFound(t *testing.T) {
+	api := &fakeSlackAPI{responses: map[string][]map[string]any{
+		"chat.postMessage": {{"ok": false, "error": "channel_not_found"}},
+	}}
+	client := newFakeSlackClient(t, api)
+
+	_, _, err := sendMessageToChannel(context.Background(), Config{}, client, "#missing", "build failed")
+	if !errors.Is(err, ErrChannelNotFound) {
+		t.Errorf("got error %v, want %v", err, ErrChannelNotFound)
+	}
+	if !isSlackError(err, "channel_not_found") {
+		t.Errorf("got error %v, want it to still wrap the slack error", err)
+	}
+	if got := api.callCount("conversations.join"); got != 0 {
+		t.Errorf("got %d joins, want none", got)
+	}
+}
+
+func TestSlackTeamIDAppliesToEveryPost(t *testing.T) {
+	config := Config{
+		SlackTeamID:          "T0OURS",
+		SlackChannelName:     "#ci",
+		SlackFallbackChannel: "#ci-fallback",
+		SlackThreadTs:        "1690000000.000100",
+	}
+	tests := []struct {
+		name        string
+		post        func(client *slack.Client) error
+		wantChannel string
+	}{
+		{
+			name: "fallback channel",
+			post: func(client *slack.Client) error {
+				notifier := &SlackNotifier{config: config, client: client, channel: "C0BROKEN", summary: &RunSummary{}}
+				return notifier.Notify(context.Background(), Notification{Text: "build failed"})
+			},
+			wantChannel: "C0OURFALLBACK",
+		},
+		{
+			name: "test mode",
+			post: func(client *slack.Client) error {
+				return runTestNotification(context.Background(), config, client, &RunSummary{})
+			},
+			wantChannel: "C0OURCI",
+		},
+		{
+			name: "resolve mode",
+			post: func(client *slack.Client) error {
+				return runResolveMode(context.Background(), config, client, Commit{sha: "abc123"}, &RunSummary{})
+			},
+			wantChannel: "C0OURCI",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Setenv("GITHUB_OUTPUT", "")
+			api := &fakeSlackAPI{handlers: map[string]func(r *http.Request) map[string]any{
+				"conversations.list": func(r *http.Request) map[string]any {
+					// The same names exist in another workspace of the org
+					channels := []map[string]any{{"id": "C0THEIRCI", "name": "ci"}, {"id": "C0THEIRFALLBACK", "name": "ci-fallback"}}
+					if r.Form.Get("team_id") == "T0OURS" {
+						channels = []map[string]any{{"id": "C0OURCI", "name": "ci"}, {"id": "C0OURFALLBACK", "name": "ci-fallback"}}
+					}
+					return map[string]any{"ok": true, "channels": channels}
+				},
+				"chat.postMessage": func(r *http.Request) map[string]any {
+					if r.Form.Get("channel") == "C0BROKEN" {
+						return map[string]any{"ok": false, "error": "is_archived"}
+					}
+					return map[string]any{"ok": true, "channel": r.Form.Get("channel"), "ts": "1700000000.000100"}
+				},
+			}}
+
+			err := test.post(newFakeSlackClient(t, api))
+			if err != nil {
+				t.Fatalf("got error %v", err)
+			}
+			channels := api.formValues("chat.postMessage", "channel")
+			if len(channels) == 0 || channels[len(channels)-1] != test.wantChannel {
+				t.Errorf("got posts to %v, want the last one to %s", channels, test.wantChannel)
+			}
+			for _, teamID := range api.formValues("conversations.list", "team_id") {
+				if teamID != "T0OURS" {
+					t.Errorf("got channels listed in team %q, want T0OURS", teamID)
+				}
+			}
+		})
+	}
+}
+
+func TestIsValidChannelOverride(t *testing.T) {
+	tests := []struct {
+		slackChannel string
+		want         bool
+	}{
+		{slackChannel: "#deploys", want: true},
+		{slackChannel: "team-ci_alerts", want: true},
+		{slackChannel: "C0123ABCD", want: true},
+		{slackChannel: "", want: false},
+		{slackChannel: "#", want: false},
+		{slackChannel: "<!channel>", want: false},
+		{slackChannel: "<#C0123ABCD|ci>", want: false},
+		{slackChannel: "@here", want: false},
+		{slackChannel: "@jdoe", want: false},
+		{slackChannel: "#ci alerts", want: false},
+		{slackChannel: " #ci", want: false},
+		{slackChannel: "#Deploys", want: false},
+		{slackChannel: "#ci\n#other", want: false},
+		{slackChannel: "#" + strings.Repeat("a", 80), want: true},
+		{slackChannel: "#" + strings.Repeat("a", 81), want: false},
+		{slackChannel: "D0123ABCD", want: false},
+		{slackChannel: "G0123ABCD", want: false},
+		{slackChannel: "U0123ABCD", want: false},
+		{slackChannel: "C0123", want: false},
+		{slackChannel: "c0123abcd", want: true},
+	}
+	for _, test := range tests {
+		t.Run(test.slackChannel, func(t *testing.T) {
+			if got := isValidChannelOverride(test.slackChannel); got != test.want {
+				t.Errorf("got %t, want %t", got, test.want)
+			}
+		})
+	}
+}
+
+func TestParseNotifyChannelDirective(t *testing.T) {
+	tests := []struct {
+		name          string
+		commitMessage string
+		want          string
+		wantFound     bool
+	}{
+		{name: "none", commitMessage: "Fix the build\n\nBody"},
+		{name: "trailer", commitMessage: "Fix the build\n\nNotify-Channel: #deploys", want: "#deploys", wantFound: true},
+		{name: "case and spacing", commitMessage: "Fix\n\nnotify-channel:\t#deploys  ", want: "#deploys", wantFound: true},
+		{name: "trailing whitespace", commitMessage: "Fix\n\nNotify-Channel: #deploys \t\n", want: "#deploys", wantFound: true},
+		{name: "multiple, the last wins", commitMessage: "Fix\n\nNotify-Channel: #first\nNotify-Channel: #second", want: "#second", wantFound: true},
+		{name: "not at the start of a line", commitMessage: "Fix\n\nsee Notify-Channel: #deploys"},
+		{name: "several words", commitMessage: "Fix\n\nNotify-Channel: #deploys now"},
+		{name: "empty", commitMessage: "Fix\n\nNotify-Channel:", want: "", wantFound: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, found := parseNotifyChannelDirective(test.commitMessage)
+			if got != test.want || found != test.wantFound {
+				t.Errorf("got %q and found %t, want %q and %t", got, found, test.want, test.wantFound)
+			}
+		})
+	}
+}
+
+func TestBuildThreadOptions(t *testing.T) {
+	tests := []struct {
+		name          string
+		config        Config
+		wantThreadTs  string
+		wantBroadcast string
+	}{
+		{name: "no thread", config: Config{PostTarget: PostTargetRoot}},
+		{name: "thread", config: Config{SlackThreadTs: "1700000000.000100", PostTarget: PostTargetThread}, wantThreadTs: "1700000000.000100"},
+		{name: "thread and channel", config: Config{SlackThreadTs: "1700000000.000100", PostTarget: PostTargetRoot}, wantThreadTs: "1700000000.000100", wantBroadcast: "true"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			api := &fakeSlackAPI{responses: map[string][]map[string]any{
+				"chat.postMessage": {{"ok": true, "channel": "C0123456789", "ts": "1700000000.000200"}},
+			}}
+			_, _, err := sendMessageToChannel(context.Background(), test.config, newFakeSlackClient(t, api), "#ci", "build failed", buildThreadOptions(test.config)...)
+			if err != nil {
+				t.Fatalf("got error %v", err)
+			}
+			if got := api.formValues("chat.postMessage", "thread_ts"); len(got) != 1 || got[0] != test.wantThreadTs {
+				t.Errorf("got thread_ts %q, want %q", got, test.wantThreadTs)
+			}
+			if got := api.formValues("chat.postMessage", "reply_broadcast"); len(got) != 1 || got[0] != test.wantBroadcast {
+				t.Errorf("got reply_broadcast %q, want %q", got, test.wantBroadcast)
+			}
+		})
+	}
+}
+
+func TestBuildRunMetadata(t *testing.T) {
+	config := Config{GithubRepository: "owner/repo", GithubRunID: "1234"}
+	got := buildRunMetadata(config, Commit{sha: "abc123"}, CommitStatus{Name: "build", Conclusion: "failure"})
+	want := slack.SlackMetadata{
+		EventType: MessageMetadataEventType,
+		EventPayload: map[string]interface{}{
+			"repository": "owner/repo",
+			"run_id":     "1234",
+			"sha":        "abc123",
+			"conclusion": "failure",
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	// The metadata is posted along with the message, as Slack expects it
+	api := &fakeSlackAPI{responses: map[string][]map[string]any{
+		"chat.postMessage": {{"ok": true, "channel": "C0123456789", "ts": "1700000000.000100"}},
+	}}
+	_, _, err := sendMessageToChannel(context.Background(), config, newFakeSlackClient(t, api), "#ci", "build failed", slack.MsgOptionMetadata(got))
+	if err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	posted := api.formValues("chat.postMessage", "metadata")
+	var postedMetadata slack.SlackMetadata
+	if len(posted) != 1 || json.Unmarshal([]byte(posted[0]), &postedMetadata) != nil || !reflect.DeepEqual(postedMetadata, want) {
+		t.Errorf("got metadata %q posted, want %+v", posted, want)
+	}
+}
+
+func TestIsLatestChannelMessage(t *testing.T) {
+	tests := []struct {
+		name     string
+		messages []map[string]any
+		want     bool
+	}{
+		{name: "same text", messages: []map[string]any{{"ts": "1700000000.000100", "text": "build failed"}}, want: true},
+		{name: "other text", messages: []map[string]any{{"ts": "1700000000.000100", "text": "build fixed"}}, want: false},
+		{name: "same text with other case", messages: []map[string]any{{"ts": "1700000000.000100", "text": "Build failed"}}, want: false},
+		{name: "empty channel", messages: []map[string]any{}, want: false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			api := &fakeSlackAPI{responses: map[string][]map[string]any{
+				"conversations.list":    {{"ok": true, "channels": []map[string]any{{"id": "C0123456789", "name": "ci"}}}},
+				"conversations.history": {{"ok": true, "messages": test.messages}},
+			}}
+
+			latest, err := isLatestChannelMessage(newFakeSlackClient(t, api), "", "#ci", "build failed")
+			if err != nil {
+				t.Fatalf("got error %v", err)
+			}
+			if latest != test.want {
+				t.Errorf("got %t, want %t", latest, test.want)
+			}
+			if channels := api.formValues("conversations.history", "channel"); !reflect.DeepEqual(channels, []string{"C0123456789"}) {
+				t.Errorf("got history of %v, want the resolved channel ID", channels)
+			}
+			if limits := api.formValues("conversations.history", "limit"); !reflect.DeepEqual(limits, []string{"1"}) {
+				t.Errorf("got limits %v, want only the latest message", limits)
+			}
+		})
+	}
+}
+
+func TestIsLatestChannelMessageReturnsHistoryError(t *testing.T) {
+	api := &fakeSlackAPI{responses: map[string][]map[string]any{
+		"conversations.history": {{"ok": false, "error": "missing_scope"}},
+	}}
+
+	_, err := isLatestChannelMessage(newFakeSlackClient(t, api), "", "C0123456789", "build failed")
+	if !isSlackError(err, "missing_scope") {
+		t.Errorf("got error %v, want missing_scope", err)
+	}
+	if got := api.callCount("conversations.list"); got != 0 {
+		t.Errorf("got %d channel lookups, want none for a channel ID", got)
+	}
+}
+
+func TestIsMessageDelivered(t *testing.T) {
+	tests := []struct {
+		name       string
+		threadTs   string
+		messages   []map[string]any
+		want       bool
+		wantMethod string
+	}{
+		{name: "in the channel", messages: []map[string]any{{"ts": "1700000000.000100"}}, want: true, wantMethod: "conversations.history"},
+		{name: "not in the channel", messages: []map[string]any{}, want: false, wantMethod: "conversations.history"},
+		{name: "other message in the channel", messages: []map[string]any{{"ts": "1700000000.000200"}}, want: false, wantMethod: "conversations.history"},
+		{
+			name:       "in the thread",
+			threadTs:   "1690000000.000100",
+			messages:   []map[string]any{{"ts": "1690000000.000100"}, {"ts": "1700000000.000100"}},
+			want:       true,
+			wantMethod: "conversations.replies",
+		},
+		{
+			name:       "only the parent in the thread",
+			threadTs:   "1690000000.000100",
+			messages:   []map[string]any{{"ts": "1690000000.000100"}},
+			want:       false,
+			wantMethod: "conversations.replies",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			api := &fakeSlackAPI{responses: map[string][]map[string]any{
+				test.wantMethod: {{"ok": true, "messages": test.messages}},
+			}}
+
+			delivered, err := isMessageDelivered(context.Background(), newFakeSlackClient(t, api), "C0123456789", test.threadTs, "1700000000.000100")
+			if err != nil {
+				t.Fatalf("got error %v", err)
+			}
+			if delivered != test.want {
+				t.Errorf("got %t, want %t", delivered, test.want)
+			}
+			if got := api.formValues(test.wantMethod, "channel"); !reflect.DeepEqual(got, []string{"C0123456789"}) {
+				t.Errorf("got %s calls for %v, want one for the channel", test.wantMethod, got)
+			}
+			for _, key := range []string{"oldest", "latest"} {
+				if got := api.formValues(test.wantMethod, key); !reflect.DeepEqual(got, []string{"1700000000.000100"}) {
+					t.Errorf("got %s %v, want the message ts", key, got)
+				}
+			}
+		})
+	}
+}
+
+func TestIsMessageDeliveredReturnsError(t *testing.T) {
+	api := &fakeSlackAPI{responses: map[string][]map[string]any{
+		"conversations.replies": {{"ok": false, "error": "thread_not_found"}},
+	}}
+
+	delivered, err := isMessageDelivered(context.Background(), newFakeSlackClient(t, api), "C0123456789", "1690000000.000100", "1700000000.000100")
+	if !isSlackError(err, "thread_not_found") {
+		t.Errorf("got error %v, want thread_not_found", err)
+	}
+	if delivered {
+		t.Error("got delivered, want not delivered on error")
+	}
+}
+
+func TestIsChannelMember(t *testing.T) {
+	pages := map[string]map[string]any{
+		"":      {"ok": true, "members": []string{"U0JOHN", "U0PAT"}, "response_metadata": map[string]any{"next_cursor": "page2"}},
+		"page2": {"ok": true, "members": []string{"U0JANE"}, "response_metadata": map[string]any{"next_cursor": ""}},
+	}
+	tests := []struct {
+		name      string
+		userID    string
+		want      bool
+		wantPages int
+	}{
+		{name: "on the first page", userID: "U0JOHN", want: true, wantPages: 1},
+		{name: "on the last page", userID: "U0JANE", want: true, wantPages: 2},
+		{name: "not a member", userID: "U0GHOST", want: false, wantPages: 2},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			api := &fakeSlackAPI{handlers: map[string]func(r *http.Request) map[string]any{
+				"conversations.members": func(r *http.Request) map[string]any {
+					return pages[r.Form.Get("cursor")]
+				},
+			}}
+
+			member, err := isChannelMember(context.Background(), newFakeSlackClient(t, api), "", "C0123456789", test.userID)
+			if err != nil {
+				t.Fatalf("got error %v", err)
+			}
+			if member != test.want {
+				t.Errorf("got %t, want %t", member, test.want)
+			}
+			if got := api.callCount("conversations.members"); got != test.wantPages {
+				t.Errorf("got %d pages, want %d", got, test.wantPages)
+			}
+		})
+	}
+}
+
+func TestIsChannelMemberReturnsError(t *testing.T) {
+	api := &fakeSlackAPI{responses: map[string][]map[string]any{
+		"conversations.members": {{"ok": false, "error": "channel_not_found"}},
+	}}
+
+	member, err := isChannelMember(context.Background(), newFakeSlackClient(t, api), "", "C0123456789", "U0JANE")
+	if !isSlackError(err, "channel_not_found") || member {
+		t.Errorf("got member %t and error %v, want channel_not_found", member, err)
+	}
+}
+
+func TestHasRunFailureBeenPosted(t *testing.T) {
+	metadata := func(runID, conclusion string) map[string]any {
+		return map[string]any{
+			"event_type":    MessageMetadataEventType,
+			"event_payload": map[string]any{"repository": "o/r", "run_id": runID, "sha": "abc123", "conclusion": conclusion},
+		}
+	}
+	tests := []struct {
+		name     string
+		messages []map[string]any
+		want     bool
+	}{
+		{name: "failure of the run", messages: []map[string]any{{"ts": "1", "text": "ok"}, {"ts": "2", "metadata": metadata("1234", "failure")}}, want: true},
+		{name: "success of the run", messages: []map[string]any{{"ts": "2", "metadata": metadata("1234", "success")}}, want: false},
+		{name: "failure of another run", messages: []map[string]any{{"ts": "2", "metadata": metadata("1233", "failure")}}, want: false},
+		{
+			name:     "other event type",
+			messages: []map[string]any{{"ts": "2", "metadata": map[string]any{"event_type": "deploy_finished", "event_payload": map[string]any{"run_id": "1234", "conclusion": "failure"}}}},
+			want:     false,
+		},
+		{name: "no metadata", messages: []map[string]any{{"ts": "2", "text": "The commit has failed"}}, want: false},
+		{name: "empty channel", messages: []map[string]any{}, want: false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			api := &fakeSlackAPI{responses: map[string][]map[string]any{
+				"conversations.history": {{"ok": true, "messages": test.messages}},
+			}}
+			config := Config{FailureConclusions: []string{"failure", "error"}}
+
+			posted, err := hasRunFailureBeenPosted(config, newFakeSlackClient(t, api), "C0123456789", "1234")
+			if err != nil {
+				t.Fatalf("got error %v", err)
+			}
+			if posted != test.want {
+				t.Errorf("got %t, want %t", posted, test.want)
+			}
+			if got := api.formValues("conversations.history", "include_all_metadata"); !reflect.DeepEqual(got, []string{"1"}) {
+				t.Errorf("got include_all_metadata %v, want the metadata asked for", got)
+			}
+		})
+	}
+}
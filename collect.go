@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+const (
+	ModeCollect = "collect"
+	ModeFlush   = "flush"
+
+	// CollectFileNameFormat is the file in STATE_DIR the statuses of a workflow run are collected in, by run ID
+	CollectFileNameFormat = "actions-notify-slack-collect-%s.jsonl"
+)
+
+// CollectedStatus is a line of the collect file, one per MODE=collect run
+type CollectedStatus struct {
+	Name        string    `json:"name"`
+	JobName     string    `json:"jobName"`
+	StepName    string    `json:"stepName"`
+	Conclusion  string    `json:"conclusion"`
+	Url         string    `json:"url"`
+	Sha         string    `json:"sha"`
+	CollectedAt time.Time `json:"collectedAt"`
+}
+
+func getCollectFilePath(config Config) (path string, err error) {
+	if config.GithubRunID == "" {
+		err = fmt.Errorf("%w: GITHUB_RUN_ID is empty, the statuses of the run can't be told apart", ErrNoConfig)
+		return
+	}
+	path = filepath.Join(config.StateDir, fmt.Sprintf(CollectFileNameFormat, filepath.Base(config.GithubRunID)))
+	return
+}
+
+// runCollectMode appends the status to the collect file of the run, for MODE=flush to post them all in one message.
+// Jobs of a matrix may collect at the same time, so each status is a single JSON line written with a single append,
+// which the OS does not interleave with the appends of other processes.
+func runCollectMode(config Config, commit Commit, commitStatus CommitStatus) (err error) {
+	path, err := getCollectFilePath(config)
+	if err != nil {
+		return
+	}
+
+	line, err := json.Marshal(CollectedStatus{
+		Name:        commitStatus.Name,
+		JobName:     commitStatus.JobName,
+		StepName:    commitStatus.StepName,
+		Conclusion:  commitStatus.Conclusion,
+		Url:         commitStatus.Url,
+		Sha:         commit.sha,
+		CollectedAt: time.Now(),
+	})
+	if err != nil {
+		return
+	}
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return
+	}
+	defer func() {
+		closeErr := file.Close()
+		if err == nil {
+			err = closeErr
+		}
+	}()
+	_, err = file.Write(append(line, '\n'))
+	if err != nil {
+		return
+	}
+	slog.Info("status collected", "status", commitStatus.DisplayName(), "conclusion", commitStatus.Conclusion, "file", path)
+	return
+}
+
+// loadCollectedStatuses reads the statuses collected for the run, in the order they were collected. A status collected
+// more than once, e.g. by a re-run job, only keeps its latest conclusion.
+func loadCollectedStatuses(path string) (statuses []CommitStatus, err error) {
+	content, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		err = nil
+		return
+	}
+	if err != nil {
+		return
+	}
+
+	indexes := map[string]int{}
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var collected CollectedStatus
+		err = json.Unmarshal(scanner.Bytes(), &collected)
+		if err != nil {
+			return
+		}
+
+		status := CommitStatus{
+			Name:       collected.Name,
+			JobName:    collected.JobName,
+			StepName:   collected.StepName,
+			Conclusion: collected.Conclusion,
+			Url:        collected.Url,
+		}
+		key := status.DisplayName()
+		if i, ok := indexes[key]; ok {
+			statuses[i] = status
+			continue
+		}
+		indexes[key] = len(statuses)
+		statuses = append(statuses, status)
+	}
+	err = scanner.Err()
+	return
+}
+
+// runFlushMode posts a single message with all the statuses collected for the run, e.g. from a final job of a
+// fan-out workflow, and removes the collect file once it is posted
+func runFlushMode(ctx context.Context, config Config, client *slack.Client, commit Commit, pullRequest PullRequest, summary *RunSummary) (err error) {
+	path, err := getCollectFilePath(config)
+	if err != nil {
+		return
+	}
+	statuses, err := loadCollectedStatuses(path)
+	if err != nil {
+		err = fmt.Errorf("reading collected statuses: %w", err)
+		return
+	}
+	if len(statuses) == 0 {
+		slog.Info("no status was collected for the run, nothing to post", "runId", config.GithubRunID)
+		return
+	}
+
+	// The message takes the emoji of the worst conclusion
+	overallStatus := CommitStatus{Conclusion: "success"}
+	for _, status := range statuses {
+		if status.Failed(config.FailureConclusions) {
+			overallStatus.Conclusion = status.Conclusion
+			break
+		}
+	}
+
+	userResolver := newSlackUserResolver(ctx, config, client)
+	message := buildStatusTableMessage(config, userResolver, commit, overallStatus, statuses, pullRequest)
+	message = truncateMessage(message+buildFooter(config), config.MessageMaxLength)
+	respChannel, respTimestamp, err := sendMessageToChannel(ctx, config, client, config.SlackChannelName, message, buildThreadOptions(config)...)
+	summary.SlackUserIDs = userResolver.resolvedUserIDs
+	if err != nil {
+		return
+	}
+	summary.addMessage(respChannel, respTimestamp)
+	slog.Info("collected statuses posted", "channel", respChannel, "timestamp", respTimestamp, "statuses", len(statuses))
+
+	err = os.Remove(path)
+	if err != nil {
+		slog.Warn("got error removing the collect file, a new flush would post the statuses again", "error", err)
+		err = nil
+	}
+	return
+}
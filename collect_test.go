@@ -0,0 +1,72 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestCollectAndLoadStatuses(t *testing.T) {
+	config := Config{StateDir: t.TempDir(), GithubRunID: "42"}
+	commit := Commit{sha: "abc123"}
+	collected := []CommitStatus{
+		{Name: "build", Conclusion: "success"},
+		{Name: "tests", JobName: "linux", Conclusion: "failure"},
+		{Name: "lint", Conclusion: "success"},
+		{Name: "tests", JobName: "linux", Conclusion: "success"},
+	}
+	for _, status := range collected {
+		err := runCollectMode(config, commit, status)
+		if err != nil {
+			t.Fatalf("got error collecting %s: %v", status.Name, err)
+		}
+	}
+
+	path, err := getCollectFilePath(config)
+	if err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	statuses, err := loadCollectedStatuses(path)
+	if err != nil {
+		t.Fatalf("got error loading statuses: %v", err)
+	}
+	want := []CommitStatus{
+		{Name: "build", Conclusion: "success"},
+		{Name: "tests", JobName: "linux", Conclusion: "success"},
+		{Name: "lint", Conclusion: "success"},
+	}
+	if len(statuses) != len(want) {
+		t.Fatalf("got %d statuses, want %d: %+v", len(statuses), len(want), statuses)
+	}
+	for i := range want {
+		if statuses[i].DisplayName() != want[i].DisplayName() || statuses[i].Conclusion != want[i].Conclusion {
+			t.Errorf("status %d: got %+v, want %+v", i, statuses[i], want[i])
+		}
+	}
+}
+
+func TestLoadCollectedStatusesWithoutFile(t *testing.T) {
+	statuses, err := loadCollectedStatuses(filepath.Join(t.TempDir(), "missing.jsonl"))
+	if err != nil || len(statuses) != 0 {
+		t.Errorf("got %+v and error %v, want nothing", statuses, err)
+	}
+}
+
+func TestGetCollectFilePathNeedsRunID(t *testing.T) {
+	_, err := getCollectFilePath(Config{StateDir: t.TempDir()})
+	if !errors.Is(err, ErrNoConfig) {
+		t.Errorf("got error %v, want %v", err, ErrNoConfig)
+	}
+
+	path, err := getCollectFilePath(Config{StateDir: "/state", GithubRunID: "../42"})
+	if err != nil || filepath.Dir(path) != "/state" {
+		t.Errorf("got %q and error %v, want a file in the state dir", path, err)
+	}
+}
+
+func TestValidateConfigCollectWithoutSlack(t *testing.T) {
+	err := validateConfig(Config{Mode: ModeCollect})
+	if err != nil {
+		t.Errorf("got error %v, want collect to need no Slack settings", err)
+	}
+}
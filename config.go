@@ -0,0 +1,531 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// RedactedValue replaces secrets when the config is printed
+	RedactedValue = "[REDACTED]"
+
+	DefaultGithubServerURL    = "https://github.com"
+	DefaultGithubAPIURL       = "https://api.github.com"
+	DefaultHTTPTimeoutSeconds = 30
+	DefaultMaxRetries         = 2
+	DefaultPostConcurrency    = 3
+	DefaultStateTTLHours      = 24 * 7
+	DefaultDiffStatMaxLines   = 10
+	// DefaultMessageMaxLength is well under the 40k characters Slack accepts, longer messages are hardly read
+	DefaultMessageMaxLength = 4000
+
+	// DefaultSuccessEmojiPool is used by RANDOM_SUCCESS_REACTION when SUCCESS_EMOJI_POOL is not set
+	DefaultSuccessEmojiPool = ":tada:,:rocket:,:sparkles:,:partying_face:,:raised_hands:,:confetti_ball:"
+
+	// PR_MENTION_POLICY values, telling whom to ping when a commit of someone else's pull request fails
+	PRMentionPolicyCommitAuthor = "commit-author"
+	PRMentionPolicyBoth         = "both"
+	PRMentionPolicyPRAuthor     = "pr-author"
+
+	// ON_UNRESOLVED_USER values, telling what to do when an author has no Slack user
+	OnUnresolvedUserSilent   = "silent"
+	OnUnresolvedUserAnnotate = "annotate"
+	OnUnresolvedUserSkip     = "skip"
+
+	// NON_MEMBER_ACTION values, telling what REQUIRE_AUTHOR_MEMBERSHIP does when the author is not in the channel
+	NonMemberActionDM   = "dm"
+	NonMemberActionSkip = "skip"
+
+	// TITLE_SOURCE values, telling what the title of a commit is in messages
+	TitleSourceCommitFirstLine     = "commit-first-line"
+	TitleSourcePRTitle             = "pr-title"
+	TitleSourceConventionalSubject = "conventional-subject"
+
+	// AUTHOR_DISPLAY values, telling how author mentions show the author
+	AuthorDisplayGithubUsername = "github-username"
+	AuthorDisplaySlackName      = "slack-name"
+
+	// DefaultFailureConclusions are the conclusions of failed check runs and commit statuses
+	DefaultFailureConclusions = "failure,error"
+
+	// DefaultBotAuthorPattern matches GitHub App accounts such as dependabot[bot]
+	DefaultBotAuthorPattern = `\[bot\]$`
+)
+
+// Config holds the settings of a run, resolved from the environment and defaults
+type Config struct {
+	Mode                  string `json:"mode"`
+	DumpConfig            bool   `json:"dumpConfig"`
+	ValidateOnly          bool   `json:"validateOnly"`
+	UseGit                bool   `json:"useGit"`
+	Quiet                 bool   `json:"quiet"`
+	Notifier              string `json:"notifier"`
+	WebhookURL            string `json:"webhookUrl"`
+	WebhookSigningSecret  string `json:"webhookSigningSecret"`
+	EscalateAfter         int    `json:"escalateAfter"`
+	IncidentWebhookURL    string `json:"incidentWebhookUrl"`
+	LogLevel              string `json:"logLevel"`
+	GithubAccessToken     string `json:"githubAccessToken"`
+	SlackAccessToken      string `json:"slackAccessToken"`
+	SlackAppToken         string `json:"slackAppToken"`
+	SlackChannelName      string `json:"slackChannelName"`
+	SlackTeamID           string `json:"slackTeamId"`
+	SlackFallbackChannel  string `json:"slackFallbackChannel"`
+	SlackThreadTs         string `json:"slackThreadTs"`
+	PostTarget            string `json:"postTarget"`
+	PrimaryEmailDomain    string `json:"primaryEmailDomain"`
+	SlackGithubFieldID    string `json:"slackGithubFieldId"`
+	AuthorCooldownMinutes int    `json:"authorCooldownMinutes"`
+	MaxCommitAgeMinutes   int    `json:"maxCommitAgeMinutes"`
+	StateDir              string `json:"stateDir"`
+	StateTTLHours         int    `json:"stateTTLHours"`
+	FirstFailureOnly      bool   `json:"firstFailureOnly"`
+	ThreadByCommit        bool   `json:"threadByCommit"`
+	ShowTrend             bool   `json:"showTrend"`
+	UpdateChannelTopic    bool   `json:"updateChannelTopic"`
+	SkipIfDuplicate       bool   `json:"skipIfDuplicate"`
+	VerifyDelivery        bool   `json:"verifyDelivery"`
+	EmitPermalink         bool   `json:"emitPermalink"`
+	AttachMetadata        bool   `json:"attachMetadata"`
+	GithubRunID           string `json:"githubRunId"`
+	GithubRunAttempt      string `json:"githubRunAttempt"`
+	GithubRunNumber       string `json:"githubRunNumber"`
+	GithubServerURL       string `json:"githubServerUrl"`
+	// GithubAPIURL and GithubGraphQLURL are where the GitHub REST and GraphQL APIs are, also for GitHub Enterprise
+	GithubAPIURL          string `json:"githubApiUrl"`
+	GithubGraphQLURL      string `json:"githubGraphqlUrl"`
+	GithubRepository      string `json:"githubRepository"`
+	RunnerOS              string `json:"runnerOs"`
+	RunnerName            string `json:"runnerName"`
+	HTTPTimeoutSeconds    int    `json:"httpTimeoutSeconds"`
+	CACertFile            string `json:"caCertFile"`
+	HTTPUserAgent         string `json:"httpUserAgent"`
+	Timezone              string `json:"timezone"`
+	TimeFormat            string `json:"timeFormat"`
+	QuietHours            string `json:"quietHours"`
+	ScheduleQuietFailures bool   `json:"scheduleQuietFailures"`
+	NotifyOnCancelled     bool   `json:"notifyOnCancelled"`
+	NotifyDraftPRs        bool   `json:"notifyDraftPRs"`
+	DebugGithubHTTP       bool   `json:"debugGithubHttp"`
+	MaxRetries            int    `json:"maxRetries"`
+	GithubMaxRetries      int    `json:"githubMaxRetries"`
+	SlackMaxRetries       int    `json:"slackMaxRetries"`
+	SSOEmptyRetries       int    `json:"ssoEmptyRetries"`
+	PostConcurrency       int    `json:"postConcurrency"`
+	MessageFormat         string `json:"messageFormat"`
+	CompactMobile         bool   `json:"compactMobile"`
+	PreviewToAuthor       bool   `json:"previewToAuthor"`
+	PersonalizedGreeting  bool   `json:"personalizedGreeting"`
+	ShowDiffStat          bool   `json:"showDiffStat"`
+	DiffStatMaxLines      int    `json:"diffStatMaxLines"`
+	MessageMaxLength      int    `json:"messageMaxLength"`
+	OutputFormat          string `json:"outputFormat"`
+	BotAuthorPattern      string `json:"botAuthorPattern"`
+	ShowFooter            bool   `json:"showFooter"`
+	SuccessMention        string `json:"successMention"`
+	RandomSuccessReaction bool   `json:"randomSuccessReaction"`
+	AuthorPrefixEmoji     string `json:"authorPrefixEmoji"`
+	FailureMention        string `json:"failureMention"`
+	Environment           string `json:"environment"`
+	LastGoodSHA           string `json:"lastGoodSha"`
+	PRMentionPolicy       string `json:"prMentionPolicy"`
+	OnUnresolvedUser      string `json:"onUnresolvedUser"`
+	TitleSource           string `json:"titleSource"`
+	AuthorDisplay         string `json:"authorDisplay"`
+	RequireMembership     bool   `json:"requireMembership"`
+	NonMemberAction       string `json:"nonMemberAction"`
+	Severity              string `json:"severity"`
+
+	// SuccessEmojiPool are the emoji RANDOM_SUCCESS_REACTION picks from
+	SuccessEmojiPool []string `json:"successEmojiPool"`
+	// GithubOrganizations are the organizations whose SSO is searched for the author email, in order
+	GithubOrganizations []string `json:"githubOrganizations"`
+	// AllowedMentionDomains are the lowercase domains of ALLOWED_MENTION_DOMAINS
+	AllowedMentionDomains []string `json:"allowedMentionDomains"`
+	// GithubRequestTimeoutSeconds and SlackRequestTimeoutSeconds are the deadlines of each attempt of a call
+	GithubRequestTimeoutSeconds int `json:"githubRequestTimeoutSeconds"`
+	SlackRequestTimeoutSeconds  int `json:"slackRequestTimeoutSeconds"`
+	// SlackWorkflowWebhookURL is the trigger URL of a Workflow Builder workflow, which anyone holding it can start
+	SlackWorkflowWebhookURL string `json:"slackWorkflowWebhookUrl"`
+	// NotifyRules are the parsed NOTIFY_RULES, telling which statuses are notified for which conclusions
+	NotifyRules []NotifyRule `json:"notifyRules"`
+	// FailureConclusions are the lowercase conclusions of FAILURE_CONCLUSIONS, treated as failures
+	FailureConclusions []string `json:"failureConclusions"`
+	// MutedAuthors are the GitHub usernames of MUTED_AUTHORS, whose commits are never notified
+	MutedAuthors []string `json:"mutedAuthors"`
+	// ConclusionEmojiMap maps conclusions like "failure" to the emoji leading their messages
+	ConclusionEmojiMap map[string]string `json:"conclusionEmojiMap"`
+	// EnvThemeMap maps lowercase environment names to their theme, the defaults merged with ENV_THEME_MAP
+	EnvThemeMap map[string]Theme `json:"envThemeMap"`
+	// Templates are the TEMPLATE_<CONCLUSION> messages, keyed by lowercase conclusion
+	Templates map[string]string `json:"templates"`
+	// AttachmentFields are the templated fields shown in an attachment below the message
+	AttachmentFields []AttachmentFieldTemplate `json:"attachmentFields"`
+
+	// Location is the loaded Timezone
+	Location *time.Location `json:"-"`
+	// BotAuthorRegexp is the compiled BotAuthorPattern
+	BotAuthorRegexp *regexp.Regexp `json:"-"`
+	// QuietHoursWindow is the parsed QuietHours, empty if not set
+	QuietHoursWindow QuietHours `json:"-"`
+}
+
+func buildConfig() (config Config) {
+	config = Config{
+		Mode:                  os.Getenv("MODE"),
+		DumpConfig:            os.Getenv("DUMP_CONFIG") == "true",
+		ValidateOnly:          os.Getenv("VALIDATE_ONLY") == "true",
+		UseGit:                os.Getenv("USE_GIT") == "true",
+		Quiet:                 os.Getenv("QUIET") == "true",
+		Notifier:              os.Getenv("NOTIFIER"),
+		WebhookURL:            os.Getenv("WEBHOOK_URL"),
+		WebhookSigningSecret:  os.Getenv("WEBHOOK_SIGNING_SECRET"),
+		EscalateAfter:         getIntFromEnv("ESCALATE_AFTER"),
+		IncidentWebhookURL:    os.Getenv("INCIDENT_WEBHOOK_URL"),
+		LogLevel:              os.Getenv("LOG_LEVEL"),
+		GithubAccessToken:     os.Getenv("GITHUB_ACCESS_TOKEN"),
+		SlackAccessToken:      os.Getenv("SLACK_ACCESS_TOKEN"),
+		SlackAppToken:         os.Getenv("SLACK_APP_TOKEN"),
+		SlackChannelName:      os.Getenv("SLACK_CHANNEL_NAME"),
+		SlackTeamID:           os.Getenv("SLACK_TEAM_ID"),
+		SlackFallbackChannel:  os.Getenv("SLACK_FALLBACK_CHANNEL"),
+		SlackThreadTs:         os.Getenv("SLACK_THREAD_TS"),
+		PostTarget:            os.Getenv("POST_TARGET"),
+		PrimaryEmailDomain:    os.Getenv("PRIMARY_EMAIL_DOMAIN"),
+		SlackGithubFieldID:    os.Getenv("SLACK_GITHUB_FIELD_ID"),
+		AuthorCooldownMinutes: getIntFromEnv("AUTHOR_COOLDOWN_MINUTES"),
+		MaxCommitAgeMinutes:   getIntFromEnv("MAX_COMMIT_AGE_MINUTES"),
+		StateDir:              os.Getenv("STATE_DIR"),
+		StateTTLHours:         getIntFromEnv("STATE_TTL_HOURS"),
+		FirstFailureOnly:      os.Getenv("FIRST_FAILURE_ONLY") == "true",
+		ThreadByCommit:        os.Getenv("THREAD_BY_COMMIT") == "true",
+		ShowTrend:             os.Getenv("SHOW_TREND") == "true",
+		UpdateChannelTopic:    os.Getenv("UPDATE_CHANNEL_TOPIC") == "true",
+		SkipIfDuplicate:       os.Getenv("SKIP_IF_DUPLICATE") == "true",
+		VerifyDelivery:        os.Getenv("VERIFY_DELIVERY") == "true",
+		EmitPermalink:         os.Getenv("EMIT_PERMALINK") == "true",
+		AttachMetadata:        os.Getenv("ATTACH_METADATA") == "true",
+		GithubRunID:           os.Getenv("GITHUB_RUN_ID"),
+		GithubRunAttempt:      os.Getenv("GITHUB_RUN_ATTEMPT"),
+		GithubRunNumber:       os.Getenv("GITHUB_RUN_NUMBER"),
+		GithubServerURL:       strings.TrimSuffix(os.Getenv("GITHUB_SERVER_URL"), "/"),
+		GithubAPIURL:          strings.TrimSuffix(os.Getenv("GITHUB_API_URL"), "/"),
+		GithubGraphQLURL:      strings.TrimSuffix(os.Getenv("GITHUB_GRAPHQL_URL"), "/"),
+		GithubRepository:      os.Getenv("GITHUB_REPOSITORY"),
+		RunnerOS:              os.Getenv("RUNNER_OS"),
+		RunnerName:            os.Getenv("RUNNER_NAME"),
+		HTTPTimeoutSeconds:    getIntFromEnv("HTTP_TIMEOUT_SECONDS"),
+		CACertFile:            os.Getenv("CA_CERT_FILE"),
+		HTTPUserAgent:         os.Getenv("HTTP_USER_AGENT"),
+		Timezone:              os.Getenv("TIMEZONE"),
+		TimeFormat:            os.Getenv("TIME_FORMAT"),
+		QuietHours:            os.Getenv("QUIET_HOURS"),
+		ScheduleQuietFailures: os.Getenv("SCHEDULE_QUIET_FAILURES") == "true",
+		NotifyOnCancelled:     os.Getenv("NOTIFY_ON_CANCELLED") == "true",
+		NotifyDraftPRs:        os.Getenv("NOTIFY_DRAFT_PRS") == "true",
+		DebugGithubHTTP:       os.Getenv("DEBUG_GITHUB_HTTP") == "true",
+		MaxRetries:            DefaultMaxRetries,
+		SSOEmptyRetries:       getIntFromEnv("SSO_EMPTY_RETRIES"),
+		PostConcurrency:       getIntFromEnv("POST_CONCURRENCY"),
+		MessageFormat:         os.Getenv("MESSAGE_FORMAT"),
+		CompactMobile:         os.Getenv("COMPACT_MOBILE") == "true",
+		PreviewToAuthor:       os.Getenv("PREVIEW_TO_AUTHOR") == "true",
+		PersonalizedGreeting:  os.Getenv("PERSONALIZED_GREETING") == "true",
+		ShowDiffStat:          os.Getenv("SHOW_DIFF_STAT") == "true",
+		DiffStatMaxLines:      getIntFromEnv("DIFF_STAT_MAX_LINES"),
+		MessageMaxLength:      getIntFromEnv("MESSAGE_MAX_LENGTH"),
+		OutputFormat:          os.Getenv("OUTPUT_FORMAT"),
+		BotAuthorPattern:      os.Getenv("BOT_AUTHOR_PATTERN"),
+		ShowFooter:            os.Getenv("SHOW_FOOTER") == "true",
+		SuccessMention:        os.Getenv("SUCCESS_MENTION"),
+		RandomSuccessReaction: os.Getenv("RANDOM_SUCCESS_REACTION") == "true",
+		AuthorPrefixEmoji:     strings.TrimSpace(os.Getenv("AUTHOR_PREFIX_EMOJI")),
+		FailureMention:        os.Getenv("FAILURE_MENTION"),
+		Environment:           os.Getenv("ENVIRONMENT"),
+		LastGoodSHA:           os.Getenv("LAST_GOOD_SHA"),
+		PRMentionPolicy:       os.Getenv("PR_MENTION_POLICY"),
+		OnUnresolvedUser:      os.Getenv("ON_UNRESOLVED_USER"),
+		TitleSource:           os.Getenv("TITLE_SOURCE"),
+		AuthorDisplay:         os.Getenv("AUTHOR_DISPLAY"),
+		RequireMembership:     os.Getenv("REQUIRE_AUTHOR_MEMBERSHIP") == "true",
+		NonMemberAction:       os.Getenv("NON_MEMBER_ACTION"),
+		Severity:              strings.ToLower(os.Getenv("SEVERITY")),
+		Location:              time.UTC,
+	}
+
+	if config.Notifier == "" {
+		// TARGET is an alias of NOTIFIER
+		config.Notifier = os.Getenv("TARGET")
+	}
+	if config.Notifier == "" {
+		config.Notifier = NotifierSlack
+	}
+	if config.GithubServerURL == "" {
+		config.GithubServerURL = DefaultGithubServerURL
+	}
+	if config.GithubAPIURL == "" {
+		config.GithubAPIURL = DefaultGithubAPIURL
+	}
+	// GitHub Enterprise Server serves REST under /api/v3 and GraphQL under /api/graphql
+	if config.GithubGraphQLURL == "" && strings.HasSuffix(config.GithubAPIURL, "/api/v3") {
+		config.GithubGraphQLURL = strings.TrimSuffix(config.GithubAPIURL, "/v3") + "/graphql"
+	} else if config.GithubGraphQLURL == "" {
+		config.GithubGraphQLURL = config.GithubAPIURL + "/graphql"
+	}
+	// GitHub asks API clients to identify themselves, anonymous ones get stricter rate limits
+	if config.HTTPUserAgent == "" {
+		config.HTTPUserAgent = "actions-notify-slack/" + Version
+	}
+	if config.HTTPTimeoutSeconds == 0 {
+		config.HTTPTimeoutSeconds = DefaultHTTPTimeoutSeconds
+	}
+	if os.Getenv("MAX_RETRIES") != "" {
+		config.MaxRetries = getIntFromEnv("MAX_RETRIES")
+	}
+	// Each service falls back to the global setting
+	config.GithubMaxRetries = config.MaxRetries
+	if os.Getenv("GITHUB_MAX_RETRIES") != "" {
+		config.GithubMaxRetries = getIntFromEnv("GITHUB_MAX_RETRIES")
+	}
+	config.SlackMaxRetries = config.MaxRetries
+	if os.Getenv("SLACK_MAX_RETRIES") != "" {
+		config.SlackMaxRetries = getIntFromEnv("SLACK_MAX_RETRIES")
+	}
+	// 0 is a valid setting, for no limit
+	if os.Getenv("MESSAGE_MAX_LENGTH") == "" {
+		config.MessageMaxLength = DefaultMessageMaxLength
+	}
+	if config.DiffStatMaxLines == 0 {
+		config.DiffStatMaxLines = DefaultDiffStatMaxLines
+	}
+	if config.StateTTLHours == 0 {
+		config.StateTTLHours = DefaultStateTTLHours
+	}
+	if config.PostConcurrency == 0 {
+		config.PostConcurrency = DefaultPostConcurrency
+	}
+	if config.PostTarget == "" {
+		config.PostTarget = PostTargetThread
+	}
+	if config.PostTarget != PostTargetThread && config.PostTarget != PostTargetRoot {
+		slog.Warn("got invalid POST_TARGET value, using thread", "value", config.PostTarget)
+		config.PostTarget = PostTargetThread
+	}
+	if config.PRMentionPolicy == "" {
+		// MENTION_PR_AUTHOR predates the policy
+		config.PRMentionPolicy = PRMentionPolicyCommitAuthor
+		if os.Getenv("MENTION_PR_AUTHOR") == "true" {
+			config.PRMentionPolicy = PRMentionPolicyBoth
+		}
+	}
+	switch config.PRMentionPolicy {
+	case PRMentionPolicyCommitAuthor, PRMentionPolicyBoth, PRMentionPolicyPRAuthor:
+	default:
+		slog.Warn("got invalid PR_MENTION_POLICY value, using commit-author", "value", config.PRMentionPolicy)
+		config.PRMentionPolicy = PRMentionPolicyCommitAuthor
+	}
+	switch config.OnUnresolvedUser {
+	case OnUnresolvedUserSilent, OnUnresolvedUserAnnotate, OnUnresolvedUserSkip:
+	case "":
+		config.OnUnresolvedUser = OnUnresolvedUserSilent
+	default:
+		slog.Warn("got invalid ON_UNRESOLVED_USER value, using silent", "value", config.OnUnresolvedUser)
+		config.OnUnresolvedUser = OnUnresolvedUserSilent
+	}
+	switch config.TitleSource {
+	case TitleSourceCommitFirstLine, TitleSourcePRTitle, TitleSourceConventionalSubject:
+	case "":
+		config.TitleSource = TitleSourceCommitFirstLine
+	default:
+		slog.Warn("got invalid TITLE_SOURCE value, using commit-first-line", "value", config.TitleSource)
+		config.TitleSource = TitleSourceCommitFirstLine
+	}
+	if config.AuthorDisplay != AuthorDisplayGithubUsername && config.AuthorDisplay != AuthorDisplaySlackName {
+		if config.AuthorDisplay != "" {
+			slog.Warn("got invalid AUTHOR_DISPLAY value, using github-username", "value", config.AuthorDisplay)
+		}
+		config.AuthorDisplay = AuthorDisplayGithubUsername
+	}
+	if config.NonMemberAction != NonMemberActionDM && config.NonMemberAction != NonMemberActionSkip {
+		if config.NonMemberAction != "" {
+			slog.Warn("got invalid NON_MEMBER_ACTION value, using dm", "value", config.NonMemberAction)
+		}
+		config.NonMemberAction = NonMemberActionDM
+	}
+	switch config.Severity {
+	case "", SeverityInfo, SeverityWarning, SeverityCritical:
+	default:
+		slog.Warn("got invalid SEVERITY value, ignoring it", "value", config.Severity)
+		config.Severity = ""
+	}
+	if config.Timezone == "" {
+		config.Timezone = "UTC"
+	}
+	location, err := time.LoadLocation(config.Timezone)
+	if err != nil {
+		slog.Warn("got invalid TIMEZONE value, using UTC", "error", err)
+		config.Timezone = "UTC"
+	} else {
+		config.Location = location
+	}
+	if config.QuietHours != "" {
+		config.QuietHoursWindow, err = parseQuietHours(config.QuietHours)
+		if err != nil {
+			slog.Warn("got invalid QUIET_HOURS value, ignoring it", "error", err)
+			config.QuietHoursWindow = QuietHours{}
+		}
+	}
+	if config.TimeFormat == "" {
+		config.TimeFormat = time.RFC3339
+	}
+	conclusionEmojiMap := os.Getenv("CONCLUSION_EMOJI_MAP")
+	if conclusionEmojiMap != "" {
+		err = json.Unmarshal([]byte(conclusionEmojiMap), &config.ConclusionEmojiMap)
+		if err != nil {
+			slog.Warn("got invalid CONCLUSION_EMOJI_MAP value, ignoring it", "error", err)
+			config.ConclusionEmojiMap = nil
+		}
+	}
+	config.SlackWorkflowWebhookURL = os.Getenv("SLACK_WORKFLOW_WEBHOOK_URL")
+	config.GithubRequestTimeoutSeconds = getIntFromEnv("GITHUB_REQUEST_TIMEOUT")
+	config.SlackRequestTimeoutSeconds = getIntFromEnv("SLACK_REQUEST_TIMEOUT")
+	config.Templates = buildTemplates()
+	config.EnvThemeMap = map[string]Theme{}
+	for environment, theme := range DefaultEnvThemes {
+		config.EnvThemeMap[environment] = theme
+	}
+	envThemeMap := os.Getenv("ENV_THEME_MAP")
+	if envThemeMap != "" {
+		var customThemes map[string]Theme
+		err = json.Unmarshal([]byte(envThemeMap), &customThemes)
+		if err != nil {
+			slog.Warn("got invalid ENV_THEME_MAP value, using the default themes", "error", err)
+		}
+		for environment, theme := range customThemes {
+			config.EnvThemeMap[strings.ToLower(environment)] = theme
+		}
+	}
+	attachmentFields := os.Getenv("ATTACHMENT_FIELDS")
+	if attachmentFields != "" {
+		err = json.Unmarshal([]byte(attachmentFields), &config.AttachmentFields)
+		if err != nil {
+			slog.Warn("got invalid ATTACHMENT_FIELDS value, ignoring it", "error", err)
+			config.AttachmentFields = nil
+		}
+	}
+	notifyRules := os.Getenv("NOTIFY_RULES")
+	if notifyRules != "" {
+		config.NotifyRules, err = parseNotifyRules(notifyRules)
+		if err != nil {
+			slog.Warn("got invalid NOTIFY_RULES value, ignoring it", "error", err)
+			config.NotifyRules = nil
+		}
+	}
+	for _, organization := range strings.Split(os.Getenv("GITHUB_ORGANIZATIONS"), ",") {
+		organization = strings.TrimSpace(organization)
+		if organization != "" {
+			config.GithubOrganizations = append(config.GithubOrganizations, organization)
+		}
+	}
+	if len(config.GithubOrganizations) == 0 {
+		config.GithubOrganizations = []string{GitHubOrganization}
+	}
+	successEmojiPool := os.Getenv("SUCCESS_EMOJI_POOL")
+	if successEmojiPool == "" {
+		successEmojiPool = DefaultSuccessEmojiPool
+	}
+	for _, emoji := range strings.Split(successEmojiPool, ",") {
+		emoji = strings.TrimSpace(emoji)
+		if emoji != "" {
+			config.SuccessEmojiPool = append(config.SuccessEmojiPool, emoji)
+		}
+	}
+	if len(config.SuccessEmojiPool) == 0 {
+		config.SuccessEmojiPool = strings.Split(DefaultSuccessEmojiPool, ",")
+	}
+	for _, domain := range strings.Split(os.Getenv("ALLOWED_MENTION_DOMAINS"), ",") {
+		domain = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(domain), "@"))
+		if domain != "" {
+			config.AllowedMentionDomains = append(config.AllowedMentionDomains, domain)
+		}
+	}
+	failureConclusions := os.Getenv("FAILURE_CONCLUSIONS")
+	if failureConclusions == "" {
+		failureConclusions = DefaultFailureConclusions
+	}
+	for _, conclusion := range strings.Split(failureConclusions, ",") {
+		conclusion = strings.ToLower(strings.TrimSpace(conclusion))
+		if conclusion != "" {
+			config.FailureConclusions = append(config.FailureConclusions, conclusion)
+		}
+	}
+	for _, username := range strings.Split(os.Getenv("MUTED_AUTHORS"), ",") {
+		username = strings.TrimPrefix(strings.TrimSpace(username), "@")
+		if username != "" {
+			config.MutedAuthors = append(config.MutedAuthors, username)
+		}
+	}
+	if config.BotAuthorPattern == "" {
+		config.BotAuthorPattern = DefaultBotAuthorPattern
+	}
+	config.BotAuthorRegexp, err = regexp.Compile(config.BotAuthorPattern)
+	if err != nil {
+		slog.Warn("got invalid BOT_AUTHOR_PATTERN value, using the default", "error", err)
+		config.BotAuthorPattern = DefaultBotAuthorPattern
+		config.BotAuthorRegexp = regexp.MustCompile(DefaultBotAuthorPattern)
+	}
+
+	if config.StateDir == "" {
+		config.StateDir = os.Getenv("RUNNER_TEMP")
+	}
+	if config.StateDir == "" {
+		config.StateDir = os.TempDir()
+	}
+	return
+}
+
+// getIntFromEnv parses an env var holding a non-negative number, returning zero if it is unset or invalid
+func getIntFromEnv(key string) (number int) {
+	value := os.Getenv(key)
+	if value == "" {
+		return
+	}
+	number, err := strconv.Atoi(value)
+	if err != nil || number < 0 {
+		slog.Warn("got invalid value, ignoring it", "key", key, "value", value)
+		number = 0
+		return
+	}
+	return
+}
+
+// dumpConfig prints the config as JSON, with secrets redacted
+func dumpConfig(config Config) (err error) {
+	secrets := []*string{
+		&config.GithubAccessToken,
+		&config.SlackAccessToken,
+		&config.SlackAppToken,
+		&config.WebhookSigningSecret,
+		&config.SlackWorkflowWebhookURL,
+		&config.IncidentWebhookURL,
+		&config.WebhookURL,
+	}
+	for _, secret := range secrets {
+		if *secret != "" {
+			*secret = RedactedValue
+		}
+	}
+
+	content, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return
+	}
+	fmt.Println(string(content))
+	return
+}
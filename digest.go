@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// DigestCommit is a commit as listed in COMMITS_JSON
+type DigestCommit struct {
+	Url            string `json:"url"`
+	Sha            string `json:"sha"`
+	AuthorUsername string `json:"authorUsername"`
+	AuthorEmail    string `json:"authorEmail"`
+	CommitMessage  string `json:"commitMessage"`
+}
+
+// buildDigestCommits reads the commits to notify together in a single message, e.g. those of a batch push
+func buildDigestCommits(ctx context.Context, config Config, httpClient *http.Client) (commits []Commit, err error) {
+	commitsJSON := os.Getenv("COMMITS_JSON")
+	if commitsJSON == "" {
+		return
+	}
+
+	var digestCommits []DigestCommit
+	err = json.Unmarshal([]byte(commitsJSON), &digestCommits)
+	if err != nil {
+		return
+	}
+
+	for _, digestCommit := range digestCommits {
+		commit := Commit{
+			url:            digestCommit.Url,
+			sha:            digestCommit.Sha,
+			authorUsername: digestCommit.AuthorUsername,
+			authorEmail:    digestCommit.AuthorEmail,
+			commitMessage:  digestCommit.CommitMessage,
+			coAuthors:      parseCoAuthors(digestCommit.CommitMessage, ""),
+		}
+		commits = append(commits, completeCommit(ctx, config, httpClient, commit))
+	}
+	return
+}
+
+// DigestAuthorGroup is an author of the digest and their commits, so they are mentioned once however many they pushed
+type DigestAuthorGroup struct {
+	mention string
+	commits []Commit
+}
+
+// buildFailedJobDigestMessage lists all the commits that share the failed status, grouped by author
+func buildFailedJobDigestMessage(config Config, userResolver *SlackUserResolver, commits []Commit, commitStatus CommitStatus, pullRequest PullRequest) (message string) {
+	message = fmt.Sprintf("%s The pipeline step <%s|%s> has failed for %d commits%s%s%s:",
+		getConclusionEmoji(config, commitStatus, ":warning:"),
+		commitStatus.Url,
+		commitStatus.DisplayName(),
+		len(commits),
+		buildPullRequestClause(pullRequest),
+		buildRunnerClause(config),
+		buildTimingClause(config, commitStatus),
+	)
+	for _, group := range groupDigestCommitsByAuthor(config, userResolver, commits) {
+		message += "\n• " + group.mention
+		for _, commit := range group.commits {
+			message += "\n    ◦ " + commit.getCommitLink()
+		}
+	}
+	return
+}
+
+// groupDigestCommitsByAuthor groups the commits by the Slack user of their main author, or by GitHub username for
+// authors not found in Slack, keeping the order in which authors first appear
+func groupDigestCommitsByAuthor(config Config, userResolver *SlackUserResolver, commits []Commit) (groups []DigestAuthorGroup) {
+	groupIndexes := map[string]int{}
+	for _, commit := range commits {
+		authors := resolveAuthors(userResolver, commit)
+		if len(authors) == 0 {
+			authors = []Author{{}}
+		}
+		author := authors[0]
+		key := "github:" + strings.ToLower(author.username)
+		if author.slackUser != nil && author.slackUser.ID != "" {
+			key = "slack:" + author.slackUser.ID
+		}
+
+		i, ok := groupIndexes[key]
+		if !ok {
+			i = len(groups)
+			groupIndexes[key] = i
+			groups = append(groups, DigestAuthorGroup{mention: buildAuthorMention(config, author)})
+		}
+		groups[i].commits = append(groups[i].commits, commit)
+	}
+	return
+}
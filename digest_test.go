@@ -0,0 +1,69 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGroupDigestCommitsByAuthor(t *testing.T) {
+	config := Config{GithubServerURL: DefaultGithubServerURL}
+	userResolver, _ := newFakeUserDirectory(t, config, map[string]string{
+		"jane@example.com":      "U0JANE",
+		"jane@home.example.com": "U0JANE",
+		"john@example.com":      "U0JOHN",
+	})
+	commits := []Commit{
+		{sha: "1", authorUsername: "jdoe", authorEmail: "jane@example.com"},
+		{sha: "2", authorUsername: "jsmith", authorEmail: "john@example.com"},
+		{sha: "3", authorUsername: "psmith", authorEmail: "pat@gmail.com"},
+		// Another GitHub account of the same Slack user
+		{sha: "4", authorUsername: "jane-home", authorEmail: "jane@home.example.com"},
+		// Not found in Slack, grouped by GitHub username whatever its case
+		{sha: "5", authorUsername: "PSmith", authorEmail: "pat@other.example.com"},
+		{sha: "6", authorUsername: "jsmith", authorEmail: "john@example.com"},
+	}
+
+	type group struct {
+		mention string
+		shas    []string
+	}
+	var got []group
+	for _, digestGroup := range groupDigestCommitsByAuthor(config, userResolver, commits) {
+		var shas []string
+		for _, commit := range digestGroup.commits {
+			shas = append(shas, commit.sha)
+		}
+		got = append(got, group{mention: digestGroup.mention, shas: shas})
+	}
+	want := []group{
+		{mention: "<@U0JANE> (<https://github.com/jdoe|jdoe>)", shas: []string{"1", "4"}},
+		{mention: "<@U0JOHN> (<https://github.com/jsmith|jsmith>)", shas: []string{"2", "6"}},
+		{mention: "<https://github.com/psmith|psmith>", shas: []string{"3", "5"}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got groups %+v, want %+v", got, want)
+	}
+}
+
+func TestBuildFailedJobDigestMessage(t *testing.T) {
+	config := Config{GithubServerURL: DefaultGithubServerURL}
+	userResolver, _ := newFakeUserDirectory(t, config, map[string]string{"jane@example.com": "U0JANE"})
+	commits := []Commit{
+		{url: "https://github.com/o/r/commit/1", sha: "1", authorUsername: "jdoe", authorEmail: "jane@example.com", commitMessage: "Fix <b> tags\n\nDetails"},
+		{url: "https://github.com/o/r/commit/2", sha: "2", authorUsername: "psmith", authorEmail: "pat@gmail.com", commitMessage: "Bump deps"},
+		{url: "https://github.com/o/r/commit/3", sha: "3", authorUsername: "jdoe", authorEmail: "jane@example.com", commitMessage: "Add tests"},
+	}
+	status := CommitStatus{Name: "build", Conclusion: "failure", Url: "https://ci.example.com/run/1"}
+	pullRequest := PullRequest{number: "42", title: "Batch", url: "https://github.com/o/r/pull/42"}
+
+	got := buildFailedJobDigestMessage(config, userResolver, commits, status, pullRequest)
+	want := ":warning: The pipeline step <https://ci.example.com/run/1|build> has failed for 3 commits (PR <https://github.com/o/r/pull/42|#42: Batch>):" +
+		"\n• <@U0JANE> (<https://github.com/jdoe|jdoe>)" +
+		"\n    ◦ <https://github.com/o/r/commit/1|\"_Fix &lt;b&gt; tags_\">" +
+		"\n    ◦ <https://github.com/o/r/commit/3|\"_Add tests_\">" +
+		"\n• <https://github.com/psmith|psmith>" +
+		"\n    ◦ <https://github.com/o/r/commit/2|\"_Bump deps_\">"
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
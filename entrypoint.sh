@@ -15,6 +15,6 @@ STATUS_CONCLUSION=${8} \
 STATUS_URL=${9} \
 STATUS_NAME=${10} \
 STATUS_DESCRIPTION=${11} \
-/usr/local/go/bin/go run /main.go
+/usr/local/go/bin/go run /*.go
 
 echo 'Running entrypoint done'
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Sentinel errors of the main failure paths, to be checked with errors.Is
+var (
+	ErrNoConfig        = errors.New("missing configuration")
+	ErrSlackAuth       = errors.New("slack authentication failed")
+	ErrChannelNotFound = errors.New("slack channel not found")
+	ErrSSONotFound     = errors.New("author not found in github SSO")
+)
+
+// Exit codes of the run, so wrapping scripts can tell failures apart
+const (
+	ExitCodeError           = 1
+	ExitCodeNoConfig        = 2
+	ExitCodeSlackAuth       = 3
+	ExitCodeChannelNotFound = 4
+)
+
+// slackAuthErrorCodes are the Slack API errors meaning the token is unusable
+var slackAuthErrorCodes = []string{"not_authed", "invalid_auth", "account_inactive", "token_revoked", "token_expired"}
+
+// wrapSlackAuthError wraps the error with ErrSlackAuth if it is about the token
+func wrapSlackAuthError(err error) error {
+	for _, code := range slackAuthErrorCodes {
+		if isSlackError(err, code) {
+			return fmt.Errorf("%w: %w", ErrSlackAuth, err)
+		}
+	}
+	return err
+}
+
+// getExitCode maps the error to the exit code of the run
+func getExitCode(err error) int {
+	switch {
+	case errors.Is(err, ErrNoConfig):
+		return ExitCodeNoConfig
+	case errors.Is(err, ErrSlackAuth):
+		return ExitCodeSlackAuth
+	case errors.Is(err, ErrChannelNotFound):
+		return ExitCodeChannelNotFound
+	default:
+		return ExitCodeError
+	}
+}
+
+// validateConfig checks that the settings every notification needs are there
+func validateConfig(config Config) (err error) {
+	// Collecting only writes the status to a file, it posts nothing
+	if config.Mode == ModeCollect {
+		return
+	}
+
+	var missing []error
+	if config.Notifier == NotifierSlack && config.SlackAccessToken == "" {
+		missing = append(missing, fmt.Errorf("%w: SLACK_ACCESS_TOKEN is empty", ErrNoConfig))
+	}
+	if config.Notifier == NotifierSlack && config.SlackChannelName == "" {
+		missing = append(missing, fmt.Errorf("%w: SLACK_CHANNEL_NAME is empty", ErrNoConfig))
+	}
+	if config.Notifier == NotifierWebhook && config.WebhookURL == "" {
+		missing = append(missing, fmt.Errorf("%w: WEBHOOK_URL is empty", ErrNoConfig))
+	}
+	if config.Notifier == NotifierWorkflow && config.SlackWorkflowWebhookURL == "" {
+		missing = append(missing, fmt.Errorf("%w: SLACK_WORKFLOW_WEBHOOK_URL is empty", ErrNoConfig))
+	}
+	err = errors.Join(missing...)
+	return
+}
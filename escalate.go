@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// IncidentEvent is the JSON body posted to INCIDENT_WEBHOOK_URL when a status keeps failing
+type IncidentEvent struct {
+	Summary             string `json:"summary"`
+	Repository          string `json:"repository"`
+	Status              string `json:"status"`
+	Conclusion          string `json:"conclusion"`
+	Url                 string `json:"url"`
+	Sha                 string `json:"sha"`
+	ConsecutiveFailures int    `json:"consecutiveFailures"`
+}
+
+func getFailureStreakKey(repository, statusName string) string {
+	return fmt.Sprintf("failures:%s:%s", repository, statusName)
+}
+
+// trackFailureStreak counts the consecutive failures of the status in the state, resetting the count when it
+// succeeds, and returns the current count
+func trackFailureStreak(config Config, commitStatus CommitStatus) (streak int, err error) {
+	state, err := loadState(config.StateDir)
+	if err != nil {
+		return
+	}
+
+	key := getFailureStreakKey(config.GithubRepository, commitStatus.Name)
+	if commitStatus.Failed(config.FailureConclusions) {
+		state.ConsecutiveFailures[key]++
+		state.FailuresUpdatedAt[key] = time.Now()
+	} else {
+		delete(state.ConsecutiveFailures, key)
+		delete(state.FailuresUpdatedAt, key)
+	}
+	streak = state.ConsecutiveFailures[key]
+	err = saveState(config.StateDir, time.Duration(config.StateTTLHours)*time.Hour, state)
+	return
+}
+
+// escalateFailure posts an incident event, e.g. to a PagerDuty or Opsgenie integration, for a status that failed
+// streak times in a row. Only the streak reaching ESCALATE_AFTER is escalated, the next failures belong to the same
+// incident.
+func escalateFailure(ctx context.Context, config Config, httpClient *http.Client, commit Commit, commitStatus CommitStatus, streak int) (err error) {
+	escalateAfter := getEscalateAfter(config)
+	if escalateAfter == 0 || streak != escalateAfter {
+		return
+	}
+
+	event := IncidentEvent{
+		Summary:             fmt.Sprintf("%s failed %d times in a row in %s", commitStatus.DisplayName(), streak, config.GithubRepository),
+		Repository:          config.GithubRepository,
+		Status:              commitStatus.Name,
+		Conclusion:          commitStatus.Conclusion,
+		Url:                 commitStatus.Url,
+		Sha:                 commit.sha,
+		ConsecutiveFailures: streak,
+	}
+	body, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+
+	err = postWebhook(ctx, config, httpClient, config.IncidentWebhookURL, body)
+	if err != nil {
+		return
+	}
+	slog.Info("failure escalated to incident webhook", "status", commitStatus.Name, "consecutiveFailures", streak)
+	return
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTrackFailureStreak(t *testing.T) {
+	config := Config{
+		StateDir:           t.TempDir(),
+		StateTTLHours:      24,
+		GithubRepository:   "owner/repo",
+		FailureConclusions: []string{"failure", "error"},
+	}
+	tests := []struct {
+		status     string
+		conclusion string
+		want       int
+	}{
+		{status: "build", conclusion: "failure", want: 1},
+		{status: "build", conclusion: "error", want: 2},
+		{status: "lint", conclusion: "failure", want: 1},
+		{status: "build", conclusion: "failure", want: 3},
+		{status: "build", conclusion: "success", want: 0},
+		{status: "build", conclusion: "failure", want: 1},
+		{status: "lint", conclusion: "failure", want: 2},
+	}
+	for i, test := range tests {
+		streak, err := trackFailureStreak(config, CommitStatus{Name: test.status, Conclusion: test.conclusion})
+		if err != nil {
+			t.Fatalf("run %d: got error %v", i, err)
+		}
+		if streak != test.want {
+			t.Errorf("run %d, %s %s: got streak %d, want %d", i, test.status, test.conclusion, streak, test.want)
+		}
+	}
+}
+
+func TestEscalateFailure(t *testing.T) {
+	tests := []struct {
+		name     string
+		severity string
+		streak   int
+		want     bool
+	}{
+		{name: "below the threshold", streak: 2, want: false},
+		{name: "at the threshold", streak: 3, want: true},
+		{name: "above the threshold", streak: 4, want: false},
+		{name: "critical at the first failure", severity: SeverityCritical, streak: 1, want: true},
+		{name: "info never", severity: SeverityInfo, streak: 3, want: false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var events []IncidentEvent
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				var event IncidentEvent
+				if err := json.Unmarshal(body, &event); err != nil {
+					t.Errorf("got invalid event %s: %v", body, err)
+				}
+				events = append(events, event)
+			}))
+			defer server.Close()
+
+			config := Config{
+				EscalateAfter:      3,
+				Severity:           test.severity,
+				IncidentWebhookURL: server.URL,
+				GithubRepository:   "owner/repo",
+			}
+			commit := Commit{sha: "abc123"}
+			status := CommitStatus{Name: "build", Conclusion: "failure", Url: "https://ci.example.com/run/1"}
+			err := escalateFailure(context.Background(), config, server.Client(), commit, status, test.streak)
+			if err != nil {
+				t.Fatalf("got error %v", err)
+			}
+			if !test.want {
+				if len(events) != 0 {
+					t.Errorf("got events %+v, want none", events)
+				}
+				return
+			}
+			want := IncidentEvent{
+				Summary:             fmt.Sprintf("build failed %d times in a row in owner/repo", test.streak),
+				Repository:          "owner/repo",
+				Status:              "build",
+				Conclusion:          "failure",
+				Url:                 "https://ci.example.com/run/1",
+				Sha:                 "abc123",
+				ConsecutiveFailures: test.streak,
+			}
+			if len(events) != 1 || events[0] != want {
+				t.Errorf("got events %+v, want %+v", events, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// GitLogFormat prints the SHA, author name, author email and message of a commit, separated by NUL bytes since the
+// message can hold anything else
+const GitLogFormat = "%H%x00%an%x00%ae%x00%B"
+
+// readCommitFromGit reads the last commit of the repository in the working directory, for runs outside GitHub
+// Actions. Git does not know the GitHub username of the author, only their name, so the username is left empty.
+func readCommitFromGit(ctx context.Context) (commit Commit, err error) {
+	_, err = exec.LookPath("git")
+	if err != nil {
+		err = fmt.Errorf("git is not installed: %w", err)
+		return
+	}
+
+	output, err := exec.CommandContext(ctx, "git", "log", "-1", "--format="+GitLogFormat).Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			err = fmt.Errorf("git log failed, is the working directory a git repository? %s", strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return
+	}
+
+	parts := strings.SplitN(string(output), "\x00", 4)
+	if len(parts) != 4 {
+		err = fmt.Errorf("got unexpected git log output %q", output)
+		return
+	}
+	commit = Commit{
+		sha:           parts[0],
+		authorName:    parts[1],
+		authorEmail:   parts[2],
+		commitMessage: strings.TrimSpace(parts[3]),
+	}
+	return
+}
+
+// fillCommitFromGit fills the fields of the commit that were not given with those of the last git commit
+func fillCommitFromGit(ctx context.Context, commit Commit) (Commit, error) {
+	gitCommit, err := readCommitFromGit(ctx)
+	if err != nil {
+		return commit, err
+	}
+	if commit.sha == "" {
+		commit.sha = gitCommit.sha
+	}
+	if commit.authorName == "" {
+		commit.authorName = gitCommit.authorName
+	}
+	if commit.authorEmail == "" {
+		commit.authorEmail = gitCommit.authorEmail
+	}
+	if commit.commitMessage == "" {
+		commit.commitMessage = gitCommit.commitMessage
+	}
+	return commit, nil
+}
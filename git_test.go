@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"os/exec"
+	"regexp"
+	"testing"
+)
+
+func TestReadCommitFromGit(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	repoDir := t.TempDir()
+	gitCommand := func(args ...string) {
+		cmd := exec.Command("git", append([]string{"-c", "user.name=Jane \"JD\" Doe", "-c", "user.email=jane@example.com", "-c", "commit.gpgsign=false"}, args...)...)
+		cmd.Dir = repoDir
+		cmd.Env = append(os.Environ(), "GIT_CONFIG_GLOBAL=/dev/null", "GIT_CONFIG_NOSYSTEM=1")
+		output, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %v: %v: %s", args, err, output)
+		}
+	}
+	gitCommand("init", "-q")
+	gitCommand("commit", "-q", "--allow-empty", "-m", "Fix the login redirect\n\nCo-authored-by: Bob <bob@example.com>")
+
+	workingDir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Chdir(repoDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.Chdir(workingDir) })
+
+	commit, err := fillCommitFromGit(context.Background(), Commit{authorEmail: "jane@corp.example.com"})
+	if err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	if len(commit.sha) != 40 {
+		t.Errorf("got sha %q, want a full SHA", commit.sha)
+	}
+	if commit.authorName != "Jane \"JD\" Doe" || commit.authorUsername != "" {
+		t.Errorf("got name %q and username %q, want the git name and no username", commit.authorName, commit.authorUsername)
+	}
+	if commit.authorEmail != "jane@corp.example.com" {
+		t.Errorf("got email %q, want the one given to be kept", commit.authorEmail)
+	}
+	if commit.commitMessage != "Fix the login redirect\n\nCo-authored-by: Bob <bob@example.com>" {
+		t.Errorf("got message %q", commit.commitMessage)
+	}
+
+	// The git name is neither looked up in GitHub SSO nor linked as a GitHub profile
+	config := Config{
+		GithubServerURL:     DefaultGithubServerURL,
+		GithubAccessToken:   "ghp_test",
+		GithubOrganizations: []string{"acme"},
+		BotAuthorRegexp:     regexp.MustCompile(DefaultBotAuthorPattern),
+	}
+	httpClient := &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		t.Errorf("got request to %s, want no GitHub call", req.URL)
+		return nil, errors.New("unexpected request")
+	})}
+	commit = completeCommit(context.Background(), config, httpClient, commit)
+	if commit.ssoResolved {
+		t.Error("got SSO resolved without a GitHub username")
+	}
+	mention := buildAuthorMention(config, Author{username: commit.authorUsername, name: commit.authorName, email: commit.authorEmail})
+	if mention != "Jane \"JD\" Doe" {
+		t.Errorf("got mention %q, want the git name", mention)
+	}
+
+	err = os.Chdir(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = readCommitFromGit(context.Background())
+	if err == nil {
+		t.Error("got no error outside a git repository")
+	}
+}
+
+func TestBuildGithubSSOQueryBody(t *testing.T) {
+	tests := []struct {
+		name      string
+		login     string
+		cursor    string
+		wantAfter any
+	}{
+		{name: "first page", login: "jdoe", cursor: "", wantAfter: nil},
+		{name: "next page", login: "jdoe", cursor: "Y3Vyc29yOjU=", wantAfter: "Y3Vyc29yOjU="},
+		{name: "login with quotes", login: `Jane "JD" Doe\`, cursor: "", wantAfter: nil},
+	}
+	for _, test := range tests {
+		body, err := buildGithubSSOQueryBody("acme", test.login, test.cursor)
+		if err != nil {
+			t.Fatalf("%s: got error %v", test.name, err)
+		}
+		var request GraphQLRequest
+		err = json.Unmarshal(body, &request)
+		if err != nil {
+			t.Fatalf("%s: got invalid JSON %s: %v", test.name, body, err)
+		}
+		if request.Query != GithubSSOQuery {
+			t.Errorf("%s: got query %q", test.name, request.Query)
+		}
+		variables := request.Variables
+		if variables["organization"] != "acme" || variables["login"] != test.login || variables["first"] != float64(SSOIdentitiesPageSize) || variables["after"] != test.wantAfter {
+			t.Errorf("%s: got variables %v", test.name, variables)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/socketmode"
+)
+
+const (
+	ModeListen = "listen"
+
+	// RerunActionID is the action ID of the interactive button that re-runs a workflow
+	RerunActionID = "rerun-workflow"
+)
+
+// RerunRequest is the value carried by a re-run button, identifying the workflow to dispatch
+type RerunRequest struct {
+	Repository string `json:"repository"`
+	Workflow   string `json:"workflow"`
+	Ref        string `json:"ref"`
+}
+
+// Listener handles the interactive components of posted messages, connected to Slack via socket mode
+type Listener struct {
+	config       Config
+	httpClient   *http.Client
+	slackClient  *slack.Client
+	socketClient *socketmode.Client
+}
+
+// runListener connects to Slack via socket mode and handles interactive button clicks until the connection is closed.
+// It is only used when MODE=listen, sending notifications does not go through here.
+func runListener(config Config, httpClient *http.Client) {
+	slog.Info("Running actions-notify-slack listener", "version", Version)
+
+	if config.SlackAppToken == "" {
+		slog.Error("got empty SLACK_APP_TOKEN, an app-level token is required to listen in socket mode")
+		os.Exit(1)
+	}
+	slackClient := slack.New(config.SlackAccessToken,
+		slack.OptionHTTPClient(httpClient),
+		slack.OptionAppLevelToken(config.SlackAppToken))
+	listener := Listener{
+		config:       config,
+		httpClient:   httpClient,
+		slackClient:  slackClient,
+		socketClient: socketmode.New(slackClient),
+	}
+
+	go func() {
+		for event := range listener.socketClient.Events {
+			listener.handleSocketEvent(event)
+		}
+	}()
+
+	err := listener.socketClient.Run()
+	if err != nil {
+		slog.Error("got error running socket mode client", "error", err)
+		os.Exit(1)
+	}
+}
+
+func (l Listener) handleSocketEvent(event socketmode.Event) {
+	// Slack redelivers the requests that are not acknowledged within 3 seconds, whether we handle them or not, so ack
+	// them all before doing any work
+	if event.Request != nil {
+		l.socketClient.Ack(*event.Request)
+	}
+
+	switch event.Type {
+	case socketmode.EventTypeConnecting:
+		slog.Info("connecting to slack in socket mode")
+	case socketmode.EventTypeConnectionError:
+		slog.Warn("got error connecting to slack in socket mode, retrying")
+	case socketmode.EventTypeConnected:
+		slog.Info("connected to slack in socket mode")
+	case socketmode.EventTypeInteractive:
+		callback, ok := event.Data.(slack.InteractionCallback)
+		if !ok {
+			slog.Warn("got unexpected interactive event data, ignoring", "data", event.Data)
+			return
+		}
+		l.handleInteraction(callback)
+	}
+}
+
+func (l Listener) handleInteraction(callback slack.InteractionCallback) {
+	if callback.Type != slack.InteractionTypeBlockActions {
+		return
+	}
+	for _, action := range callback.ActionCallback.BlockActions {
+		if action.ActionID != RerunActionID {
+			continue
+		}
+
+		var rerunRequest RerunRequest
+		err := json.Unmarshal([]byte(action.Value), &rerunRequest)
+		if err != nil {
+			slog.Error("got error unmarshalling re-run button value", "error", err)
+			continue
+		}
+
+		reply := fmt.Sprintf(":repeat: <@%s> triggered a re-run of `%s` on `%s`", callback.User.ID, rerunRequest.Workflow, rerunRequest.Ref)
+		err = l.dispatchWorkflow(rerunRequest)
+		if err != nil {
+			slog.Error("got error dispatching workflow", "error", err)
+			reply = fmt.Sprintf(":x: <@%s> could not re-run `%s` on `%s`: %s", callback.User.ID, rerunRequest.Workflow, rerunRequest.Ref, err)
+		}
+
+		_, _, err = l.slackClient.PostMessage(callback.Channel.ID,
+			slack.MsgOptionText(reply, false),
+			slack.MsgOptionTS(callback.Message.Timestamp))
+		if err != nil {
+			slog.Error("got error posting re-run reply to slack thread", "error", err)
+		}
+	}
+}
+
+// dispatchWorkflow triggers a workflow_dispatch event for the workflow via the GitHub API
+func (l Listener) dispatchWorkflow(rerunRequest RerunRequest) (err error) {
+	if rerunRequest.Repository == "" || rerunRequest.Workflow == "" || rerunRequest.Ref == "" {
+		err = errors.New("re-run request needs a repository, workflow and ref")
+		return
+	}
+
+	requestBody, err := json.Marshal(map[string]string{"ref": rerunRequest.Ref})
+	if err != nil {
+		return
+	}
+	url := fmt.Sprintf("%s/repos/%s/actions/workflows/%s/dispatches", l.config.GithubAPIURL, rerunRequest.Repository, rerunRequest.Workflow)
+	req, err := http.NewRequest("POST", url, bytes.NewBuffer(requestBody))
+	if err != nil {
+		return
+	}
+	req.Header.Add("Authorization", "Bearer "+l.config.GithubAccessToken)
+	req.Header.Add("Accept", "application/vnd.github+json")
+	req.Header.Set("User-Agent", l.config.HTTPUserAgent)
+
+	resp, err := l.httpClient.Do(req)
+	if err != nil {
+		return
+	}
+	defer func() {
+		closeErr := resp.Body.Close()
+		if closeErr != nil {
+			slog.Warn("got error closing github API response body", "error", closeErr)
+		}
+	}()
+
+	if resp.StatusCode != http.StatusNoContent {
+		body, _ := io.ReadAll(resp.Body)
+		err = fmt.Errorf("got status %d from github API: %s", resp.StatusCode, body)
+	}
+	return
+}
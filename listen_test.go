@@ -0,0 +1,45 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestListenerDispatchWorkflow(t *testing.T) {
+	var path, authorization, userAgent string
+	var body map[string]string
+	apiURL, httpClient, requests := newFakeGithubAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		path, authorization, userAgent = r.URL.Path, r.Header.Get("Authorization"), r.Header.Get("User-Agent")
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("got invalid body: %v", err)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+	listener := Listener{
+		config:     Config{GithubAccessToken: "ghp_test", GithubAPIURL: apiURL + "/api/v3", HTTPUserAgent: "acme-ci/2.0"},
+		httpClient: httpClient,
+	}
+
+	err := listener.dispatchWorkflow(RerunRequest{Repository: "owner/repo", Workflow: "ci.yml", Ref: "main"})
+	if err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	if path != "/api/v3/repos/owner/repo/actions/workflows/ci.yml/dispatches" {
+		t.Errorf("got request to %s, want the dispatches of the workflow on the configured API", path)
+	}
+	if authorization != "Bearer ghp_test" || body["ref"] != "main" {
+		t.Errorf("got authorization %q and body %v", authorization, body)
+	}
+	if userAgent != "acme-ci/2.0" {
+		t.Errorf("got User-Agent %q, want HTTP_USER_AGENT", userAgent)
+	}
+
+	err = listener.dispatchWorkflow(RerunRequest{Repository: "owner/repo", Workflow: "ci.yml"})
+	if err == nil {
+		t.Error("got no error for a re-run request without a ref")
+	}
+	if got := requests.Load(); got != 1 {
+		t.Errorf("got %d requests, want none for the invalid re-run request", got-1)
+	}
+}
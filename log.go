@@ -0,0 +1,60 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// Version is reported in the startup banner
+const Version = "v1"
+
+// setupLogger configures the default logger from LOG_LEVEL and QUIET, before the rest of the config is built so its
+// warnings follow them too. Quiet mode only keeps errors, so wrapping workflows get clean logs but failures still show
+// up. Logs go to stderr, leaving stdout to the OUTPUT_FORMAT=json summary.
+func setupLogger(logLevel string, quiet bool) {
+	level := slog.LevelInfo
+	switch strings.ToLower(logLevel) {
+	case "debug":
+		level = slog.LevelDebug
+	case "warn":
+		level = slog.LevelWarn
+	case "error":
+		level = slog.LevelError
+	}
+	if quiet {
+		level = slog.LevelError
+	}
+
+	handler := slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: level,
+		ReplaceAttr: func(groups []string, attr slog.Attr) slog.Attr {
+			// The runner already timestamps every log line
+			if attr.Key == slog.TimeKey && len(groups) == 0 {
+				return slog.Attr{}
+			}
+			return attr
+		},
+	})
+	slog.SetDefault(slog.New(handler))
+}
+
+// getCorrelationID identifies this run in aggregated logs: the workflow run and attempt when running in Actions, a
+// random ID otherwise
+func getCorrelationID(config Config) string {
+	if config.GithubRunID != "" && config.GithubRunAttempt != "" {
+		return config.GithubRunID + "-" + config.GithubRunAttempt
+	}
+	if config.GithubRunID != "" {
+		return config.GithubRunID
+	}
+
+	randomBytes := make([]byte, 8)
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(randomBytes)
+}
@@ -2,31 +2,132 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"hash/fnv"
 	"io"
+	"log/slog"
 	"net/http"
+	"net/mail"
 	"os"
+	"regexp"
+	"slices"
 	"strings"
+	"time"
+	"unicode/utf8"
 
 	"github.com/slack-go/slack"
 )
 
 const (
+	// GitHubOrganization is where authors are looked up in SSO unless GITHUB_ORGANIZATIONS says otherwise
 	GitHubOrganization = "masmovil"
 	PublishJobName     = "mas-stack/publish:master"
+
+	UnknownConclusionEmoji = ":grey_question:"
+
+	// SSOIdentitiesPageSize is how many SAML identities are requested per user, since a user may have several
+	SSOIdentitiesPageSize = 5
+	// SSOMaxPages bounds how many pages of identities are read looking for the one of the author
+	SSOMaxPages = 10
+	// SSOEmptyRetryDelay is how long to wait before looking an author missing from SSO up again
+	SSOEmptyRetryDelay = 10 * time.Second
+
+	// CodeFence opens and closes the code blocks of messages
+	CodeFence = "```"
 )
 
 type Commit struct {
 	url            string
+	sha            string
 	authorUsername string
-	authorEmail    string
-	commitMessage  string
+	// authorName is the name of the author in git, only known when it is read with USE_GIT. It is no GitHub username.
+	authorName    string
+	authorEmail   string
+	commitMessage string
+	// timestamp is when the commit was made, zero if unknown
+	timestamp time.Time
+
+	// title is the title picked by TITLE_SOURCE, if any
+	title string
+	// coAuthors are the other authors credited in the commit trailers or COMMIT_CO_AUTHORS
+	coAuthors []Author
+	// ssoResolved is whether authorEmail was replaced with the author email in GitHub SSO
+	ssoResolved bool
+
+	// notifyChannel is the channel asked for by a Notify-Channel trailer in the commit message, if any
+	notifyChannel string
 }
 
+// getCommitMessageTitle returns the title picked by TITLE_SOURCE, or the first line of the commit message
 func (c Commit) getCommitMessageTitle() string {
-	return strings.Split(c.commitMessage, "\n")[0]
+	if c.title != "" {
+		return c.title
+	}
+	return getFirstLine(c.commitMessage)
+}
+
+// getFirstLine returns the first line of the text, without the carriage return of a CRLF line ending
+func getFirstLine(text string) string {
+	return strings.TrimSuffix(strings.Split(text, "\n")[0], "\r")
+}
+
+// conventionalCommitRegexp matches a Conventional Commit subject like "feat(api)!: add tokens", capturing the
+// description after the type and scope
+var conventionalCommitRegexp = regexp.MustCompile(`^[a-zA-Z]+(?:\([^)]*\))?!?:[ \t]*(\S.*)$`)
+
+// buildCommitTitle picks the title shown for the commit according to TITLE_SOURCE, falling back to the first line of
+// the commit message when the source has nothing, e.g. there is no pull request
+func buildCommitTitle(config Config, commit Commit, pullRequest PullRequest) (title string) {
+	title = getFirstLine(commit.commitMessage)
+	switch config.TitleSource {
+	case TitleSourcePRTitle:
+		if pullRequest.title != "" {
+			title = pullRequest.title
+		}
+	case TitleSourceConventionalSubject:
+		if match := conventionalCommitRegexp.FindStringSubmatch(title); match != nil {
+			title = match[1]
+		}
+	}
+	return
+}
+
+// getCommitLink returns the commit title linking to the commit, or just the title if the commit URL is unknown
+func (c Commit) getCommitLink() string {
+	title := escapeMrkdwn(c.getCommitMessageTitle())
+	if c.url == "" {
+		return fmt.Sprintf("\"_%s_\"", title)
+	}
+	return fmt.Sprintf("<%s|\"_%s_\">", c.url, title)
+}
+
+// escapeMrkdwn escapes the characters Slack reserves for its markup, so user provided text like "A < B" is shown as
+// is. It must only be applied to the text, not to the <url|text> links built around it.
+func escapeMrkdwn(text string) string {
+	return mrkdwnReplacer.Replace(text)
+}
+
+var mrkdwnReplacer = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// PullRequest is the pull request that triggered the build, if any
+type PullRequest struct {
+	number string
+	title  string
+	url    string
+	// author is the GitHub username of whoever opened the pull request, which may not be the commit author
+	author      string
+	authorEmail string
+	// reviewers are the GitHub usernames of the reviewers requested on the pull request
+	reviewers []string
+	// draft is whether the pull request is a draft, whose failures are expected while it's being worked on
+	draft bool
+}
+
+func (p PullRequest) isPresent() bool {
+	return p.number != "" && p.url != ""
 }
 
 type CommitStatus struct {
@@ -34,14 +135,32 @@ type CommitStatus struct {
 	Description string
 	Conclusion  string
 	Url         string
+	JobName     string
+	StepName    string
+	StartedAt   time.Time
+	CompletedAt time.Time
+}
+
+// DisplayName returns the job and step that reported the status if both are known, since Name alone is ambiguous
+// in matrix workflows
+func (o CommitStatus) DisplayName() string {
+	if o.JobName != "" && o.StepName != "" {
+		return fmt.Sprintf("job \"%s\" / step \"%s\"", o.JobName, o.StepName)
+	}
+	return o.Name
 }
 
 func (o CommitStatus) Succeeded() bool {
 	return o.Conclusion == "success"
 }
 
-func (o CommitStatus) Failed() bool {
-	return o.Conclusion == "failure" || o.Conclusion == "error"
+// Failed reports whether the conclusion is one of the FAILURE_CONCLUSIONS
+func (o CommitStatus) Failed(failureConclusions []string) bool {
+	return slices.Contains(failureConclusions, o.Conclusion)
+}
+
+func (o CommitStatus) Cancelled() bool {
+	return o.Conclusion == "cancelled"
 }
 
 // GithubUserSSO is used to unmarshall GitHub API response
@@ -55,8 +174,15 @@ type GithubUserSSO struct {
 							SamlIdentity struct {
 								NameId string `json:"nameId"`
 							} `json:"samlIdentity"`
+							User struct {
+								Login string `json:"login"`
+							} `json:"user"`
 						} `json:"node"`
 					} `json:"edges"`
+					PageInfo struct {
+						HasNextPage bool   `json:"hasNextPage"`
+						EndCursor   string `json:"endCursor"`
+					} `json:"pageInfo"`
 				} `json:"externalIdentities"`
 			} `json:"samlIdentityProvider"`
 		} `json:"organization"`
@@ -64,183 +190,1245 @@ type GithubUserSSO struct {
 }
 
 func main() {
-	fmt.Println("Running actions-notify-slack")
+	setupLogger(os.Getenv("LOG_LEVEL"), os.Getenv("QUIET") == "true")
+	config := buildConfig()
 
-	slackClient := getSlackClient()
-	commit := buildCommit()
+	if config.DumpConfig {
+		err := dumpConfig(config)
+		if err != nil {
+			slog.Error("got error dumping config", "error", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	httpClient, err := buildHTTPClient(config)
+	if err != nil {
+		slog.Error("got error building http client", "error", err)
+		os.Exit(1)
+	}
+
+	err = resolveSecretRefs(context.Background(), &config, httpClient)
+	if err != nil {
+		slog.Error("got error resolving tokens from secret manager", "error", err)
+		os.Exit(1)
+	}
+
+	if config.Mode == ModeListen {
+		runListener(config, httpClient)
+		return
+	}
+
+	slog.Info("Running actions-notify-slack", "version", Version, "correlationId", getCorrelationID(config))
+
+	summary := &RunSummary{}
+	defer printSummary(config, summary)
+
+	err = validateConfig(config)
+	if err != nil {
+		slog.Error("got invalid configuration, aborting", "error", err)
+		exitWithError(config, summary, err)
+	}
+
+	ctx := context.Background()
+	slackClient := getSlackClient(config, httpClient)
+	if config.Mode == ModeTest {
+		err = runTestNotification(ctx, config, slackClient, summary)
+		if err != nil {
+			slog.Error("got error sending test notification", "error", err)
+			exitWithError(config, summary, err)
+		}
+		return
+	}
+	commit := buildCommit(ctx, config, httpClient)
+	summary.SSOResolved = commit.ssoResolved
+	if config.ValidateOnly {
+		err = runValidation(ctx, config, slackClient, commit)
+		if err != nil {
+			slog.Error("validation failed", "error", err)
+			exitWithError(config, summary, err)
+		}
+		return
+	}
+	digestCommits, err := buildDigestCommits(ctx, config, httpClient)
+	if err != nil {
+		slog.Warn("got error reading COMMITS_JSON, notifying only the commit", "error", err)
+	}
 	commitStatus := buildCommitStatus()
+	statuses, err := buildStatuses()
+	if err != nil {
+		slog.Warn("got error reading STATUSES_JSON, ignoring it", "error", err)
+	}
+	pullRequest := buildPullRequest()
+	commit.title = buildCommitTitle(config, commit, pullRequest)
+	for i := range digestCommits {
+		// The pull request title would be the same for all the commits of the digest
+		digestCommits[i].title = buildCommitTitle(config, digestCommits[i], PullRequest{})
+	}
+	messageRefs, err := buildMessageRefs()
+	if err != nil {
+		slog.Warn("got error reading SLACK_MESSAGE_REFS, posting new messages instead", "error", err)
+		messageRefs = nil
+	}
+
+	if config.Mode == ModeSummary {
+		err = runSummaryMode(ctx, config, slackClient, commit, commitStatus)
+		if err != nil {
+			slog.Error("got error updating the summary message", "error", err)
+			exitWithError(config, summary, err)
+		}
+		return
+	}
+
+	if config.Mode == ModeResolve {
+		err = runResolveMode(ctx, config, slackClient, commit, summary)
+		if err != nil {
+			slog.Error("got error posting the resolution", "error", err)
+			exitWithError(config, summary, err)
+		}
+		return
+	}
+
+	if config.Mode == ModeCollect {
+		err = runCollectMode(config, commit, commitStatus)
+		if err != nil {
+			slog.Error("got error collecting the status", "error", err)
+			exitWithError(config, summary, err)
+		}
+		return
+	}
+
+	if config.Mode == ModeFlush {
+		err = runFlushMode(ctx, config, slackClient, commit, pullRequest, summary)
+		if err != nil {
+			slog.Error("got error posting the collected statuses", "error", err)
+			exitWithError(config, summary, err)
+		}
+		return
+	}
+
+	// Failure streaks count the results that are not notified too, so a success filtered out still resets them.
+	// Cancelled runs tell nothing about the status and are left out.
+	escalateAfter := getEscalateAfter(config)
+	streak := 0
+	if escalateAfter > 0 && config.IncidentWebhookURL != "" && !commitStatus.Cancelled() {
+		streak, err = trackFailureStreak(config, commitStatus)
+		if err != nil {
+			slog.Warn("got error tracking consecutive failures", "error", err)
+		}
+	}
+
+	// Status board channels show the state of the repository in their topic whatever is posted, so a success that is
+	// not notified still turns it green again
+	if config.UpdateChannelTopic {
+		topicChannel := config.SlackChannelName
+		if commit.notifyChannel != "" {
+			topicChannel = commit.notifyChannel
+		}
+		err = updateChannelTopic(ctx, config, slackClient, topicChannel, commitStatus)
+		if err != nil {
+			slog.Warn("got error updating the channel topic", "error", err)
+		}
+	}
+
+	if !isNotifiedByRules(config.NotifyRules, commitStatus) {
+		slog.Info("no notify rule matches the status, skipping notification", "status", commitStatus.Name, "conclusion", commitStatus.Conclusion)
+		return
+	}
+
+	if isSkippedCancellation(config, commitStatus) {
+		slog.Info("status was cancelled, skipping notification")
+		return
+	}
+
+	if isSkippedDraft(config, pullRequest) {
+		slog.Info("pull request is a draft, skipping notification", "pr", pullRequest.number)
+		return
+	}
+
+	// Muted authors, like service accounts, have their failures handled elsewhere
+	if isMutedAuthor(config, commit.authorUsername) {
+		slog.Info("commit author is muted, skipping notification", "author", commit.authorUsername)
+		return
+	}
+
+	// Re-runs of old workflows would otherwise notify about commits nobody is working on anymore
+	maxCommitAge := time.Duration(config.MaxCommitAgeMinutes) * time.Minute
+	if isCommitStale(commit, maxCommitAge, time.Now()) {
+		slog.Info("commit is too old, skipping notification", "timestamp", commit.timestamp, "maxAge", maxCommitAge)
+		return
+	}
+
+	// Keep failing and a human has to be paged, not just pinged in Slack
+	err = escalateFailure(ctx, config, httpClient, commit, commitStatus, streak)
+	if err != nil {
+		slog.Error("got error escalating failure to incident webhook", "error", err)
+		summary.addError(err)
+	}
+
+	// Only failures are worth a ping during quiet hours
+	now := time.Now().In(config.Location)
+	inQuietHours := config.QuietHoursWindow.contains(now)
+	if inQuietHours && !commitStatus.Failed(config.FailureConclusions) {
+		slog.Info("in quiet hours, skipping notification", "quietHours", config.QuietHours)
+		return
+	}
 
 	// Notify publish success to slack user via direct message
 	if commitStatus.Name == PublishJobName {
-		message := buildSuccessPublishDirectMessage(commit, commitStatus)
-		sendMessageToUser(slackClient, commit.authorEmail, message)
+		message, ok := buildTemplatedMessage(config, newSlackUserResolver(ctx, config, slackClient), commit, commitStatus, pullRequest)
+		if !ok {
+			message = buildSuccessPublishDirectMessage(config, commit, commitStatus, pullRequest)
+		}
+		// No conclusion mentions, nobody else would be notified of them in a direct message
+		message += buildFooter(config)
+		message = truncateMessage(message, config.MessageMaxLength)
+		respChannel, respTimestamp, err := sendMessageToUser(ctx, config, slackClient, commit.authorEmail, message)
+		if err == nil {
+			summary.addMessage(respChannel, respTimestamp)
+		}
+		summary.addError(err)
 	}
 
-	// Notify failed job result to Slack channel
-	if commitStatus.Failed() {
-		message := buildFailedJobChannelMessage(slackClient, commit, commitStatus)
-		sendMessageToChannel(slackClient, os.Getenv("SLACK_CHANNEL_NAME"), message)
+	// Notify failed job result to Slack channel, and the other results NOTIFY_RULES ask for
+	failed := commitStatus.Failed(config.FailureConclusions)
+	if failed || isPostedByRules(config, commitStatus) {
+		slackChannel := config.SlackChannelName
+		if commit.notifyChannel != "" {
+			slog.Info("using channel from the commit message", "channel", commit.notifyChannel)
+			slackChannel = commit.notifyChannel
+		}
+
+		// In an Enterprise Grid org the channel name is ambiguous, use the ID of the channel in our workspace instead
+		if config.SlackTeamID != "" {
+			slackChannel, err = resolveChannelID(slackClient, config.SlackTeamID, slackChannel)
+			if err != nil {
+				slog.Error("got error resolving slack channel in team, aborting", "error", err)
+				exitWithError(config, summary, err)
+			}
+		}
+
+		// Skip the message if the author was notified recently, to avoid spamming on a burst of failed commits
+		cooldown := time.Duration(config.AuthorCooldownMinutes) * time.Minute
+		cooldownKey := getCooldownKey(commit.authorUsername, slackChannel)
+		state := State{LastNotifiedAt: map[string]time.Time{}, CommitThreads: map[string]CommitThread{}}
+		if cooldown > 0 || config.ThreadByCommit {
+			state, err = loadState(config.StateDir)
+			if err != nil {
+				slog.Warn("got error loading state, ignoring previous notifications", "error", err)
+			}
+		}
+		if cooldown > 0 && isInCooldown(state, cooldownKey, cooldown, time.Now()) {
+			slog.Info("author was notified recently, skipping message", "author", commit.authorUsername, "cooldown", cooldown)
+			return
+		}
+
+		// Reply in the thread of the first status notified for the commit, so its check results are grouped together
+		threadKey := getCommitThreadKey(config.GithubRepository, commit.sha, slackChannel)
+		recordThread := false
+		if config.ThreadByCommit && config.SlackThreadTs == "" && commit.sha != "" {
+			thread, ok := state.CommitThreads[threadKey]
+			if ok {
+				slog.Info("replying in the thread of the commit", "sha", commit.sha, "threadTs", thread.Ts)
+				config.SlackThreadTs = thread.Ts
+			}
+			recordThread = !ok
+		}
+
+		// Critical failures can't stay hidden in a thread
+		if config.Severity == SeverityCritical {
+			config.PostTarget = PostTargetRoot
+		}
+
+		var messageOptions []slack.MsgOption
+
+		// Only notify the first failure of a run, to avoid one message per failed step in fan-out pipelines
+		if failed && config.FirstFailureOnly && config.GithubRunID != "" {
+			posted, err := hasRunFailureBeenPosted(config, slackClient, slackChannel, config.GithubRunID)
+			if err != nil {
+				slog.Warn("got error looking for previous failures of the run, notifying anyway", "error", err)
+			}
+			if posted {
+				slog.Info("a failure was already notified for the run, skipping message", "runId", config.GithubRunID)
+				return
+			}
+		}
+		if config.AttachMetadata || (config.FirstFailureOnly && config.GithubRunID != "") {
+			messageOptions = append(messageOptions, slack.MsgOptionMetadata(buildRunMetadata(config, commit, commitStatus)))
+		}
+
+		userResolver := newSlackUserResolver(ctx, config, slackClient)
+		message, skip := buildChannelMessage(config, userResolver, commit, commitStatus, pullRequest, digestCommits, statuses, os.Getenv("DIFF_STAT"))
+		if skip {
+			return
+		}
+		notification := buildNotification(config, commit, commitStatus, message)
+		message = notification.Text
+		// Only ping people in the channels they belong to, authors that can't be found in Slack are posted as usual
+		var authorUser *slack.User
+		var authorID string
+		if config.RequireMembership {
+			if authors := resolveAuthors(userResolver, commit); len(authors) > 0 && authors[0].slackUser != nil {
+				authorUser = authors[0].slackUser
+				authorID = authorUser.ID
+			}
+		}
+		if authorID != "" {
+			member, err := isChannelMember(ctx, slackClient, config.SlackTeamID, slackChannel, authorID)
+			if err != nil {
+				slog.Warn("got error checking the author is a channel member, posting anyway", "error", err)
+			} else if !member && config.NonMemberAction == NonMemberActionSkip {
+				slog.Info("author is not a member of the channel, skipping message", "channel", slackChannel)
+				return
+			} else if !member {
+				slog.Info("author is not a member of the channel, sending a direct message instead", "channel", slackChannel)
+				respChannel, respTimestamp, err := postMessage(ctx, config, slackClient, authorID, slack.MsgOptionText(addGreeting(config, authorUser, message), false), slack.MsgOptionAsUser(true))
+				summary.SlackUserIDs = userResolver.resolvedUserIDs
+				if err != nil {
+					slog.Error("got error posting message to slack user", "error", err)
+					exitWithError(config, summary, err)
+				}
+				summary.addMessage(respChannel, respTimestamp)
+				return
+			}
+		}
+		if config.SkipIfDuplicate && len(messageRefs) == 0 {
+			duplicate, err := isLatestChannelMessage(slackClient, config.SlackTeamID, slackChannel, message)
+			if err != nil {
+				slog.Warn("got error reading the latest channel message, posting anyway", "error", err)
+			}
+			if duplicate {
+				slog.Info("the latest channel message is the same, skipping message", "channel", slackChannel)
+				return
+			}
+		}
+		if config.PreviewToAuthor {
+			sendPreviewToAuthor(ctx, config, slackClient, resolveAuthors(userResolver, commit), slackChannel, message)
+		}
+		var postAt time.Time
+		if inQuietHours && config.ScheduleQuietFailures {
+			postAt = config.QuietHoursWindow.endAfter(now)
+		}
+		var notifier Notifier
+		notifier, err = buildNotifier(config, httpClient, slackClient, slackChannel, messageRefs, messageOptions, postAt, summary)
+		if err != nil {
+			slog.Error("got error building notifier, aborting", "error", err)
+			exitWithError(config, summary, err)
+		}
+		err = notifier.Notify(ctx, notification)
+		summary.SlackUserIDs = userResolver.resolvedUserIDs
+		if err != nil {
+			exitWithError(config, summary, err)
+		}
+		if config.ShowTrend && config.Notifier == NotifierSlack && len(summary.Messages) > 0 && postAt.IsZero() {
+			trend, err := buildTrend()
+			if err != nil {
+				slog.Warn("got error reading TREND_DATA, not showing the trend", "error", err)
+			} else if len(trend) > 0 {
+				uploadTrend(ctx, config, slackClient, summary.Messages[len(summary.Messages)-1], trend)
+			}
+		}
+		if recordThread && len(summary.Messages) > 0 && postAt.IsZero() {
+			ref := summary.Messages[len(summary.Messages)-1]
+			state.CommitThreads[threadKey] = CommitThread{Channel: ref.Channel, Ts: ref.Ts, PostedAt: time.Now()}
+		}
+		if cooldown > 0 {
+			state.LastNotifiedAt[cooldownKey] = time.Now()
+		}
+		if cooldown > 0 || recordThread {
+			err = saveState(config.StateDir, time.Duration(config.StateTTLHours)*time.Hour, state)
+			if err != nil {
+				slog.Error("got error saving state", "error", err)
+			}
+		}
 	}
 
 	return
 }
 
-func getSlackClient() (client *slack.Client) {
-	accessToken := os.Getenv("SLACK_ACCESS_TOKEN")
-	client = slack.New(accessToken)
+// exitWithError ends the run with the exit code of the error. The summary is printed first, since exiting skips the
+// deferred calls.
+func exitWithError(config Config, summary *RunSummary, err error) {
+	summary.addError(err)
+	printSummary(config, summary)
+	os.Exit(getExitCode(err))
+}
+
+func getSlackClient(config Config, httpClient *http.Client) (client *slack.Client) {
+	slackHTTPClient := *httpClient
+	slackHTTPClient.Transport = &slackWarningTransport{base: httpClient.Transport}
+	client = slack.New(config.SlackAccessToken, slack.OptionHTTPClient(&slackHTTPClient))
 	return client
 }
 
-func buildFailedJobChannelMessage(client *slack.Client, commit Commit, commitStatus CommitStatus) (message string) {
-	slackUser, err := client.GetUserByEmail(commit.authorEmail)
-	if err != nil {
-		fmt.Println("got error getting slack user by email, defaulting to nil:", err)
-		slackUser = nil
+// buildNotification wraps the channel message into the notification handed to the notifier: the message gets the
+// theme emoji and is truncated, and the fields and color are added
+func buildNotification(config Config, commit Commit, commitStatus CommitStatus, message string) (notification Notification) {
+	theme := getMessageTheme(config, commitStatus)
+	if theme.Emoji != "" {
+		message = theme.Emoji + " " + message
+	}
+	notification = Notification{
+		Text:   truncateMessage(message, config.MessageMaxLength),
+		Fields: buildNotificationFields(config, commit, commitStatus),
+		Status: commitStatus,
+		Commit: commit,
+		Color:  theme.Color,
 	}
-	userMention := buildUserMention(slackUser, commit.authorUsername)
+	return
+}
 
-	message = fmt.Sprintf(":warning: The commit <%s|\"_%s_\"> by %s has failed the pipeline step <%s|%s>",
-		commit.url,
-		commit.getCommitMessageTitle(),
+// buildChannelMessage renders the message posted to the channel about the status, in the format the settings ask for
+// in this order: a digest of several commits, a table of statuses, a template, the compact mobile line, or the
+// default message. It returns skip if ON_UNRESOLVED_USER says not to post it.
+func buildChannelMessage(config Config, userResolver *SlackUserResolver, commit Commit, commitStatus CommitStatus, pullRequest PullRequest, digestCommits []Commit, statuses []CommitStatus, diffStat string) (message string, skip bool) {
+	failed := commitStatus.Failed(config.FailureConclusions)
+	compact := false
+	switch {
+	case failed && len(digestCommits) > 0:
+		message = buildFailedJobDigestMessage(config, userResolver, digestCommits, commitStatus, pullRequest)
+	case config.MessageFormat == MessageFormatTable && len(statuses) > 0:
+		message = buildStatusTableMessage(config, userResolver, commit, commitStatus, statuses, pullRequest)
+	case hasTemplate(config, commitStatus):
+		message, _ = buildTemplatedMessage(config, userResolver, commit, commitStatus, pullRequest)
+	case !failed:
+		message = buildStatusChannelMessage(config, userResolver, commit, commitStatus, pullRequest)
+	case config.CompactMobile:
+		message = buildCompactMobileMessage(config, userResolver, commit, commitStatus)
+		compact = true
+	default:
+		message = buildFailedJobChannelMessage(config, userResolver, commit, commitStatus, pullRequest)
+	}
+
+	// Unmapped authors usually point at a broken SSO or email setup, which some teams prefer to hear about
+	if len(userResolver.unresolvedAuthors) > 0 {
+		switch config.OnUnresolvedUser {
+		case OnUnresolvedUserSkip:
+			slog.Info("slack user not found for an author, skipping message", "authors", userResolver.unresolvedAuthors)
+			skip = true
+			return
+		case OnUnresolvedUserAnnotate:
+			message += " (Slack user not found)"
+		}
+	}
+	message += buildConclusionMentionClause(config, commitStatus)
+	// The compact line has to stay a single line, so the footer and diff stat lines are left out
+	if compact {
+		return
+	}
+	message += buildFooter(config)
+	if len(digestCommits) == 0 {
+		message += buildDiffStatBlock(config, diffStat)
+	}
+	return
+}
+
+func buildFailedJobChannelMessage(config Config, userResolver *SlackUserResolver, commit Commit, commitStatus CommitStatus, pullRequest PullRequest) (message string) {
+	// With the pr-author policy only the owner of the pull request is pinged, the commit authors are just named
+	authors := resolveAuthors(userResolver, commit)
+	if config.PRMentionPolicy == PRMentionPolicyPRAuthor && isOtherPullRequestAuthor(commit, pullRequest) {
+		for i := range authors {
+			authors[i].slackUser = nil
+		}
+	}
+	userMention := buildAuthorsMention(config, authors)
+
+	message = fmt.Sprintf("%s The commit %s%s by %s has failed the pipeline step <%s|%s>%s%s%s%s%s",
+		getConclusionEmoji(config, commitStatus, ":warning:"),
+		commit.getCommitLink(),
+		buildPullRequestClause(pullRequest),
 		userMention,
 		commitStatus.Url,
-		commitStatus.Name,
+		commitStatus.DisplayName(),
+		buildRunnerClause(config),
+		buildTimingClause(config, commitStatus),
+		buildCompareClause(config, commit),
+		buildPullRequestAuthorClause(config, userResolver, commit, pullRequest),
+		buildPullRequestReviewersClause(config, commit, pullRequest),
+	)
+	return
+}
+
+// buildStatusChannelMessage announces a result that is not a failure, posted to the channel when NOTIFY_RULES ask for
+// it, e.g. a successful deploy
+func buildStatusChannelMessage(config Config, userResolver *SlackUserResolver, commit Commit, commitStatus CommitStatus, pullRequest PullRequest) (message string) {
+	statusEmoji := ":large_yellow_circle:"
+	statusDescription := fmt.Sprintf("finished as `%s`", commitStatus.Conclusion)
+	if commitStatus.Succeeded() {
+		statusEmoji = ":large_green_circle:"
+		if config.RandomSuccessReaction {
+			statusEmoji = pickSuccessEmoji(config.SuccessEmojiPool, commit.sha)
+		}
+		statusDescription = "succeeded"
+	}
+
+	message = fmt.Sprintf("%s The pipeline step <%s|%s> has %s for the commit %s%s by %s%s%s",
+		getConclusionEmoji(config, commitStatus, statusEmoji),
+		commitStatus.Url,
+		commitStatus.DisplayName(),
+		statusDescription,
+		commit.getCommitLink(),
+		buildPullRequestClause(pullRequest),
+		buildAuthorsMention(config, resolveAuthors(userResolver, commit)),
+		buildRunnerClause(config),
+		buildTimingClause(config, commitStatus),
 	)
 	return
 }
 
-func buildSuccessPublishDirectMessage(commit Commit, commitStatus CommitStatus) (message string) {
+// buildPullRequestAuthorClause mentions the author of the pull request too when the PR_MENTION_POLICY asks for it,
+// e.g. when someone else pushed to their branch. It is empty if they are the commit author, even under another GitHub
+// account or as a co-author, as long as it is the same Slack user.
+func buildPullRequestAuthorClause(config Config, userResolver *SlackUserResolver, commit Commit, pullRequest PullRequest) (clause string) {
+	if config.PRMentionPolicy == PRMentionPolicyCommitAuthor || !isOtherPullRequestAuthor(commit, pullRequest) {
+		return
+	}
+	slackUser := userResolver.resolveUser(pullRequest.authorEmail, pullRequest.author)
+	// With the pr-author policy the commit authors are not pinged, so there is nothing to double
+	if config.PRMentionPolicy == PRMentionPolicyBoth && hasSlackUser(resolveAuthors(userResolver, commit), slackUser) {
+		slog.Debug("pull request author is already mentioned as a commit author", "author", pullRequest.author)
+		return
+	}
+	clause = ", cc PR author " + buildUserMention(config, slackUser, pullRequest.author)
+	return
+}
+
+// buildPullRequestReviewersClause names the reviewers requested on the pull request of someone else, along with its
+// author, so they know the failure is not theirs to fix. Reviewers are linked to their GitHub profiles without a ping.
+func buildPullRequestReviewersClause(config Config, commit Commit, pullRequest PullRequest) (clause string) {
+	if config.PRMentionPolicy == PRMentionPolicyCommitAuthor || !isOtherPullRequestAuthor(commit, pullRequest) || len(pullRequest.reviewers) == 0 {
+		return
+	}
+	var reviewers []string
+	for _, reviewer := range pullRequest.reviewers {
+		reviewers = append(reviewers, buildUserMention(config, nil, reviewer))
+	}
+	clause = ", reviewers " + strings.Join(reviewers, ", ")
+	return
+}
+
+// isOtherPullRequestAuthor reports whether the commit belongs to a pull request opened by someone else
+func isOtherPullRequestAuthor(commit Commit, pullRequest PullRequest) bool {
+	return pullRequest.isPresent() && pullRequest.author != "" && !strings.EqualFold(pullRequest.author, commit.authorUsername)
+}
+
+// buildCompareClause links the changes since LAST_GOOD_SHA, the last commit that passed, or returns an empty string if
+// it or the repository are unknown
+func buildCompareClause(config Config, commit Commit) (clause string) {
+	if config.LastGoodSHA == "" || commit.sha == "" || config.GithubRepository == "" || config.LastGoodSHA == commit.sha {
+		return
+	}
+	compareUrl := fmt.Sprintf("%s/%s/compare/%s...%s", config.GithubServerURL, config.GithubRepository, config.LastGoodSHA, commit.sha)
+	clause = fmt.Sprintf(" (<%s|view changes since last green>)", compareUrl)
+	return
+}
+
+func buildSuccessPublishDirectMessage(config Config, commit Commit, commitStatus CommitStatus, pullRequest PullRequest) (message string) {
 	statusEmoji := ":large_yellow_circle:"
 	statusDescription := "was aborted"
 	if commitStatus.Succeeded() {
 		statusEmoji = ":large_green_circle:"
+		if config.RandomSuccessReaction {
+			statusEmoji = pickSuccessEmoji(config.SuccessEmojiPool, commit.sha)
+		}
 		statusDescription = "was successful"
-	} else if commitStatus.Failed() {
+	} else if commitStatus.Failed(config.FailureConclusions) {
 		statusEmoji = ":red_circle:"
 		statusDescription = "failed"
 	}
 
-	message = fmt.Sprintf("%s The CI job <%s|%s> for <%s|\"_%s_\"> %s",
-		statusEmoji,
+	message = fmt.Sprintf("%s The CI job <%s|%s> for %s%s %s%s%s",
+		getConclusionEmoji(config, commitStatus, statusEmoji),
 		commitStatus.Url,
-		commitStatus.Name,
-		commit.url,
-		commit.getCommitMessageTitle(),
+		commitStatus.DisplayName(),
+		commit.getCommitLink(),
+		buildPullRequestClause(pullRequest),
 		statusDescription,
+		buildRunnerClause(config),
+		buildTimingClause(config, commitStatus),
 	)
 	return
 }
 
-func buildUserMention(slackUser *slack.User, githubAuthorUsername string) (mention string) {
-	githubAuthorUrl := "https://github.com/" + githubAuthorUsername
-	if slackUser != nil {
-		mention += fmt.Sprintf("<@%s> (<%s|%s>)", slackUser.ID, githubAuthorUrl, githubAuthorUsername)
-	} else {
-		mention += fmt.Sprintf("<%s|%s>", githubAuthorUrl, githubAuthorUsername)
+// pickSuccessEmoji picks an emoji from the pool for the commit. The pick is derived from the SHA, so re-runs of the
+// same commit get the same emoji.
+func pickSuccessEmoji(pool []string, sha string) string {
+	hash := fnv.New32a()
+	hash.Write([]byte(sha))
+	return pool[hash.Sum32()%uint32(len(pool))]
+}
+
+// buildRunnerClause names the runner the job ran on, like " on runner Linux (GitHub Actions 2)", to tell the legs of a
+// matrix apart. It is empty outside GitHub Actions.
+func buildRunnerClause(config Config) (clause string) {
+	switch {
+	case config.RunnerOS != "" && config.RunnerName != "":
+		clause = fmt.Sprintf(" on runner %s (%s)", escapeMrkdwn(config.RunnerOS), escapeMrkdwn(config.RunnerName))
+	case config.RunnerOS != "":
+		clause = " on runner " + escapeMrkdwn(config.RunnerOS)
+	case config.RunnerName != "":
+		clause = " on runner " + escapeMrkdwn(config.RunnerName)
+	}
+	return
+}
+
+// buildTimingClause tells when the status completed and how long it took, as far as it is known
+func buildTimingClause(config Config, commitStatus CommitStatus) (clause string) {
+	if !commitStatus.CompletedAt.IsZero() {
+		clause += " at " + commitStatus.CompletedAt.In(config.Location).Format(config.TimeFormat)
+	}
+	if !commitStatus.StartedAt.IsZero() && commitStatus.CompletedAt.After(commitStatus.StartedAt) {
+		clause += fmt.Sprintf(" after %s", commitStatus.CompletedAt.Sub(commitStatus.StartedAt).Round(time.Second))
+	}
+	return
+}
+
+// getConclusionEmoji returns the emoji configured for the conclusion of the status. Without CONCLUSION_EMOJI_MAP the
+// message default is used, and conclusions missing from the map get UnknownConclusionEmoji.
+func getConclusionEmoji(config Config, commitStatus CommitStatus, defaultEmoji string) string {
+	if theme, ok := getSeverityTheme(config, commitStatus); ok {
+		return theme.Emoji
+	}
+	if len(config.ConclusionEmojiMap) == 0 {
+		return defaultEmoji
 	}
-	return mention
+	emoji, ok := config.ConclusionEmojiMap[commitStatus.Conclusion]
+	if !ok {
+		return UnknownConclusionEmoji
+	}
+	return emoji
+}
+
+// buildConclusionMentionClause mentions the people configured for the conclusion of the status in channel messages,
+// e.g. a release manager on the successes NOTIFY_RULES post, independently of the author mention
+func buildConclusionMentionClause(config Config, commitStatus CommitStatus) (clause string) {
+	mentions := ""
+	if commitStatus.Succeeded() {
+		mentions = config.SuccessMention
+	} else if commitStatus.Failed(config.FailureConclusions) {
+		mentions = config.FailureMention
+	}
+
+	var formattedMentions []string
+	for _, mention := range strings.Split(mentions, ",") {
+		mention = strings.TrimSpace(mention)
+		if mention != "" {
+			formattedMentions = append(formattedMentions, formatMention(mention))
+		}
+	}
+	if len(formattedMentions) == 0 {
+		return
+	}
+	clause = " cc " + strings.Join(formattedMentions, " ")
+	return
 }
 
+// userGroupIDRegexp matches Slack user group IDs, telling them from user handles that happen to start with an S
+var userGroupIDRegexp = regexp.MustCompile(`^S[A-Z0-9]+$`)
+
+// formatMention turns a Slack user or user group ID, or a special mention like "here", into mention syntax
+func formatMention(mention string) string {
+	switch {
+	case strings.HasPrefix(mention, "<"):
+		// Already in Slack syntax
+		return mention
+	case mention == "here" || mention == "@here" || mention == "channel" || mention == "@channel":
+		return "<!" + strings.TrimPrefix(mention, "@") + ">"
+	case userGroupIDRegexp.MatchString(mention):
+		return "<!subteam^" + mention + ">"
+	default:
+		return "<@" + strings.TrimPrefix(mention, "@") + ">"
+	}
+}
+
+// buildFooter returns a last line with the run metadata, like "owner/repo · run #42 · attempt 2", or an empty string
+// if the footer is disabled
+func buildFooter(config Config) (footer string) {
+	if !config.ShowFooter {
+		return
+	}
+
+	var parts []string
+	if config.GithubRepository != "" {
+		parts = append(parts, config.GithubRepository)
+	}
+	if config.GithubRunNumber != "" {
+		run := "run #" + config.GithubRunNumber
+		if config.GithubRepository != "" && config.GithubRunID != "" {
+			runUrl := fmt.Sprintf("%s/%s/actions/runs/%s", config.GithubServerURL, config.GithubRepository, config.GithubRunID)
+			run = fmt.Sprintf("<%s|%s>", runUrl, run)
+		}
+		parts = append(parts, run)
+	}
+	if config.GithubRunAttempt != "" && config.GithubRunAttempt != "1" {
+		parts = append(parts, "attempt "+config.GithubRunAttempt)
+	}
+	if len(parts) == 0 {
+		return
+	}
+	footer = "\n" + strings.Join(parts, " · ")
+	return
+}
+
+// truncateMessage cuts the message to at most maxLength characters, ending it with an ellipsis, so long digests or
+// commit titles stay readable and under the Slack limits. It cuts on rune boundaries, and may break a link at the end.
+// A code block left open by the cut, like the diff stat, is closed so the rest of the message isn't formatted as code.
+func truncateMessage(message string, maxLength int) string {
+	if maxLength <= 0 || utf8.RuneCountInString(message) <= maxLength {
+		return message
+	}
+	runes := []rune(message)
+	truncated := string(runes[:maxLength-1])
+	if strings.Count(truncated, CodeFence)%2 == 0 {
+		return truncated + "…"
+	}
+	// Make room for the closing fence, the shorter cut may remove the opening one though
+	closingFence := "\n" + CodeFence
+	truncated = string(runes[:max(maxLength-1-utf8.RuneCountInString(closingFence), 0)])
+	if strings.Count(truncated, CodeFence)%2 == 0 {
+		return truncated + "…"
+	}
+	return truncated + "…" + closingFence
+}
+
+// buildDiffStatBlock renders DIFF_STAT, the output of git diff --stat, as a code block below the message. Beyond
+// DIFF_STAT_MAX_LINES files the rest are counted instead of listed, keeping the closing summary line.
+func buildDiffStatBlock(config Config, diffStat string) (block string) {
+	if !config.ShowDiffStat || strings.TrimSpace(diffStat) == "" {
+		return
+	}
+
+	var lines []string
+	for _, line := range strings.Split(strings.TrimRight(diffStat, "\n"), "\n") {
+		if strings.TrimSpace(line) != "" {
+			lines = append(lines, strings.TrimRight(line, " \t"))
+		}
+	}
+	var summary string
+	if last := lines[len(lines)-1]; strings.Contains(last, "changed") {
+		summary = last
+		lines = lines[:len(lines)-1]
+	}
+	if config.DiffStatMaxLines > 0 && len(lines) > config.DiffStatMaxLines {
+		hidden := len(lines) - config.DiffStatMaxLines
+		lines = append(lines[:config.DiffStatMaxLines], fmt.Sprintf(" ... and %d more", hidden))
+	}
+	if summary != "" {
+		lines = append(lines, summary)
+	}
+	block = "\n```\n" + escapeMrkdwn(strings.Join(lines, "\n")) + "\n```"
+	return
+}
+
+// buildPullRequestClause links the pull request of the commit, or returns an empty string if there is none
+func buildPullRequestClause(pullRequest PullRequest) (clause string) {
+	if !pullRequest.isPresent() {
+		return
+	}
+	linkText := "#" + pullRequest.number
+	if pullRequest.title != "" {
+		linkText += ": " + escapeMrkdwn(pullRequest.title)
+	}
+	clause = fmt.Sprintf(" (PR <%s|%s>)", pullRequest.url, linkText)
+	return
+}
+
+// buildUserMention mentions the Slack user by ID, or names them by handle if Slack returned a user without an ID that
+// the resolver could not complete, falling back to the GitHub profile link when there is no Slack user at all. Only an
+// ID pings, messages are posted without link_names so that e.g. "@channel" in a commit title stays text. The profile
+// is on GITHUB_SERVER_URL, for GitHub Enterprise. With AUTHOR_DISPLAY=slack-name the link shows the Slack name instead
+// of the GitHub username.
+func buildUserMention(config Config, slackUser *slack.User, githubAuthorUsername string) (mention string) {
+	githubAuthorUrl := config.GithubServerURL + "/" + githubAuthorUsername
+	githubAuthorText := escapeMrkdwn(githubAuthorUsername)
+	if slackName := getSlackUserName(slackUser); config.AuthorDisplay == AuthorDisplaySlackName && slackName != "" {
+		githubAuthorText = escapeMrkdwn(slackName)
+	}
+	switch {
+	case slackUser != nil && slackUser.ID != "":
+		mention += fmt.Sprintf("<@%s> (<%s|%s>)", slackUser.ID, githubAuthorUrl, githubAuthorText)
+	case slackUser != nil && slackUser.Name != "":
+		mention += fmt.Sprintf("@%s (<%s|%s>)", escapeMrkdwn(slackUser.Name), githubAuthorUrl, githubAuthorText)
+	default:
+		mention += fmt.Sprintf("<%s|%s>", githubAuthorUrl, githubAuthorText)
+	}
+	return addAuthorPrefixEmoji(config, mention)
+}
+
+// getSlackUserName returns the name the user chose to be displayed with, or their full name, empty if unknown
+func getSlackUserName(slackUser *slack.User) string {
+	switch {
+	case slackUser == nil:
+		return ""
+	case slackUser.Profile.DisplayName != "":
+		return slackUser.Profile.DisplayName
+	case slackUser.RealName != "":
+		return slackUser.RealName
+	default:
+		return slackUser.Profile.RealName
+	}
+}
+
+// buildCommitStatus reads the status from the environment. The conclusion is lowercased, since some event sources
+// report it as e.g. "SUCCESS".
 func buildCommitStatus() (commitStatus CommitStatus) {
 	commitStatus = CommitStatus{
 		Name:        os.Getenv("STATUS_NAME"),
 		Description: os.Getenv("STATUS_DESCRIPTION"),
-		Conclusion:  os.Getenv("STATUS_CONCLUSION"),
+		Conclusion:  strings.ToLower(strings.TrimSpace(os.Getenv("STATUS_CONCLUSION"))),
 		Url:         os.Getenv("STATUS_URL"),
+		JobName:     os.Getenv("JOB_NAME"),
+		StepName:    os.Getenv("STEP_NAME"),
+		StartedAt:   getTimeFromEnv("STATUS_STARTED_AT"),
+		CompletedAt: getTimeFromEnv("STATUS_COMPLETED_AT"),
+	}
+	return
+}
+
+// isSkippedCancellation reports whether the status was cancelled and NOTIFY_ON_CANCELLED is not set. Cancelled runs
+// usually come from superseded pushes, which are not worth a ping.
+func isSkippedCancellation(config Config, commitStatus CommitStatus) bool {
+	return commitStatus.Cancelled() && !config.NotifyOnCancelled
+}
+
+// isSkippedDraft reports whether the pull request is a draft and NOTIFY_DRAFT_PRS is not set. Draft pull requests are
+// not ready for anyone's attention yet.
+func isSkippedDraft(config Config, pullRequest PullRequest) bool {
+	return pullRequest.draft && !config.NotifyDraftPRs
+}
+
+// isMutedAuthor reports whether the GitHub username is one of MUTED_AUTHORS, ignoring case as GitHub does
+func isMutedAuthor(config Config, username string) bool {
+	return slices.ContainsFunc(config.MutedAuthors, func(mutedAuthor string) bool {
+		return strings.EqualFold(mutedAuthor, username)
+	})
+}
+
+// isCommitStale reports whether the commit is older than maxAge. Commits without a timestamp are never stale, and a
+// zero maxAge disables the check.
+func isCommitStale(commit Commit, maxAge time.Duration, now time.Time) bool {
+	if maxAge <= 0 || commit.timestamp.IsZero() {
+		return false
+	}
+	return now.Sub(commit.timestamp) > maxAge
+}
+
+// getTimeFromEnv parses an env var holding an RFC3339 timestamp, returning the zero time if it is unset or invalid
+func getTimeFromEnv(key string) (timestamp time.Time) {
+	value := os.Getenv(key)
+	if value == "" {
+		return
+	}
+	timestamp, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		slog.Warn("got invalid value, ignoring it", "key", key, "value", value)
+		timestamp = time.Time{}
 	}
 	return
 }
 
-func buildCommit() (commit Commit) {
+func buildPullRequest() (pullRequest PullRequest) {
+	pullRequest = PullRequest{
+		number:      strings.TrimPrefix(os.Getenv("PR_NUMBER"), "#"),
+		title:       os.Getenv("PR_TITLE"),
+		url:         os.Getenv("PR_URL"),
+		author:      os.Getenv("PR_AUTHOR"),
+		authorEmail: os.Getenv("PR_AUTHOR_EMAIL"),
+		draft:       strings.EqualFold(strings.TrimSpace(os.Getenv("PR_DRAFT")), "true"),
+	}
+	for _, reviewer := range strings.Split(os.Getenv("PR_REVIEWERS"), ",") {
+		reviewer = strings.TrimPrefix(strings.TrimSpace(reviewer), "@")
+		if reviewer != "" {
+			pullRequest.reviewers = append(pullRequest.reviewers, reviewer)
+		}
+	}
+	return
+}
+
+func buildCommit(ctx context.Context, config Config, httpClient *http.Client) (commit Commit) {
 	commit = Commit{
 		url:            os.Getenv("COMMIT_URL"),
+		sha:            os.Getenv("COMMIT_SHA"),
 		authorUsername: os.Getenv("COMMIT_AUTHOR_USERNAME"),
 		authorEmail:    os.Getenv("COMMIT_AUTHOR_EMAIL"),
 		commitMessage:  os.Getenv("COMMIT_MESSAGE"),
+		timestamp:      getTimeFromEnv("COMMIT_TIMESTAMP"),
+	}
+
+	// Outside GitHub Actions the commit can be read from the repository itself
+	if config.UseGit && (commit.sha == "" || commit.authorUsername == "" || commit.authorEmail == "" || commit.commitMessage == "") {
+		var err error
+		commit, err = fillCommitFromGit(ctx, commit)
+		if err != nil {
+			slog.Error("got error reading commit from git, using the commit env vars only", "error", err)
+		}
 	}
 
-	authorEmail, err := getAuthorEmailFromGithubSSO(commit.authorUsername)
+	commit.coAuthors = parseCoAuthors(commit.commitMessage, os.Getenv("COMMIT_CO_AUTHORS"))
+
+	notifyChannel, found := parseNotifyChannelDirective(commit.commitMessage)
+	if found && isValidChannelOverride(notifyChannel) {
+		commit.notifyChannel = notifyChannel
+	} else if found {
+		slog.Warn("got invalid channel in Notify-Channel commit trailer, ignoring it", "channel", notifyChannel)
+	}
+
+	commit = completeCommit(ctx, config, httpClient, commit)
+	return
+}
+
+// completeCommit fills in what can be derived from the commit metadata: the URL and the author SSO email
+func completeCommit(ctx context.Context, config Config, httpClient *http.Client, commit Commit) Commit {
+	// Build the commit URL ourselves if it was not given but we know where the commit lives
+	if commit.url == "" && commit.sha != "" && config.GithubRepository != "" {
+		commit.url = fmt.Sprintf("%s/%s/commit/%s", config.GithubServerURL, config.GithubRepository, commit.sha)
+	}
+
+	// Bots have no SSO identity nor Slack user, don't waste lookups on them
+	if config.BotAuthorRegexp.MatchString(commit.authorUsername) {
+		slog.Debug("author is a bot, skipping github SSO lookup", "author", commit.authorUsername)
+		return commit
+	}
+
+	// Without a GitHub username there is nobody to look up, e.g. for a commit read from git
+	if commit.authorUsername == "" {
+		slog.Debug("no github username for the author, skipping github SSO lookup", "author", commit.authorName)
+		return commit
+	}
+
+	// Without a token the request is bound to fail, keep the commit email
+	if config.GithubAccessToken == "" {
+		slog.Debug("no github access token, skipping github SSO lookup", "author", commit.authorUsername)
+		return commit
+	}
+
+	authorEmail, login, err := getAuthorEmailFromGithubSSO(ctx, config, httpClient, commit.authorUsername)
 	if err != nil {
 		// If we are unable to get email from GitHub SSO, we will use the one specified in the commit metadata
-		fmt.Println("got error getting email from github SSO:", err)
-		return
+		slog.Warn("got error getting email from github SSO", "error", err)
+		return commit
 	}
 	// Replace the email from the commit with the one from GitHub SSO
 	commit.authorEmail = authorEmail
+	commit.ssoResolved = true
+	// Usernames are case-insensitive, so the lookup works whatever the case it was given in, but links should use the
+	// canonical one
+	if login != "" && login != commit.authorUsername {
+		slog.Debug("using canonical github login of the author", "author", commit.authorUsername, "login", login)
+		commit.authorUsername = login
+	}
 
-	return
+	return commit
 }
 
-func getAuthorEmailFromGithubSSO(authorUsername string) (authorEmail string, err error) {
-	// Get email from organization SSO, using GitHub username as key
-	queryBody := fmt.Sprintf("{\"query\": \"query {organization(login: \\\"%s\\\"){samlIdentityProvider{externalIdentities(first: 1, login: \\\"%s\\\") {edges {node {samlIdentity {nameId}}}}}}}\"}", GitHubOrganization, authorUsername)
-	req, err := http.NewRequest("POST", "https://api.github.com/graphql", bytes.NewBuffer([]byte(queryBody)))
-	accessToken := os.Getenv("GITHUB_ACCESS_TOKEN")
-	req.Header.Add("Authorization", "Bearer "+accessToken)
+// getAuthorEmailFromGithubSSO looks the author up in the SSO of each configured organization in turn, returning the
+// first email found. The identity of a new hire may not be provisioned yet when their first commit builds, so if no
+// organization knows the author the lookup is retried up to SSO_EMPTY_RETRIES times. The canonical login of the
+// author is returned too.
+func getAuthorEmailFromGithubSSO(ctx context.Context, config Config, httpClient *http.Client, authorUsername string) (authorEmail, login string, err error) {
+	for attempt := 0; ; attempt++ {
+		for _, organization := range config.GithubOrganizations {
+			authorEmail, login, err = getAuthorEmailFromGithubOrganizationSSO(ctx, config, httpClient, organization, authorUsername)
+			if err == nil {
+				return
+			}
+			slog.Debug("author not found in github organization SSO", "organization", organization, "author", authorUsername)
+		}
+		if !errors.Is(err, ErrSSONotFound) || attempt >= config.SSOEmptyRetries {
+			return
+		}
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		fmt.Println("got error while doing request to github API:", err)
-		return
+		slog.Info("author not found in github SSO, retrying", "author", authorUsername, "delay", SSOEmptyRetryDelay)
+		select {
+		case <-ctx.Done():
+			err = ctx.Err()
+			return
+		case <-time.After(SSOEmptyRetryDelay):
+		}
 	}
-	defer func() {
-		closeErr := resp.Body.Close()
-		if closeErr != nil {
-			fmt.Println("got error closing github API response body:", closeErr)
+}
+
+// getAuthorEmailFromGithubOrganizationSSO looks the author up in the SSO of the organization. The login filter should
+// only return identities of the author, but in large orgs it has been seen returning others first, so those are
+// skipped and the next pages read, up to SSOMaxPages.
+func getAuthorEmailFromGithubOrganizationSSO(ctx context.Context, config Config, httpClient *http.Client, organization, authorUsername string) (authorEmail, login string, err error) {
+	cursor := ""
+	for page := 1; ; page++ {
+		var githubAuthorSSO GithubUserSSO
+		githubAuthorSSO, err = getGithubOrganizationSSOPage(ctx, config, httpClient, organization, authorUsername, cursor)
+		if err != nil {
+			return
 		}
-	}()
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		fmt.Println("got error reading github API response body:", err)
+		identities := &githubAuthorSSO.Data.Organization.SAMLIdentityProvider.ExternalIdentities
+		if len(identities.Edges) == 0 {
+			err = fmt.Errorf("%w: no external identity edges", ErrSSONotFound)
+			slog.Warn("got zero external identity edges from github api response", "error", err)
+			return
+		}
+
+		// Identities without a linked user can't be told apart, so they are trusted to be the author's as before
+		matchingEdges := identities.Edges[:0:0]
+		for _, edge := range identities.Edges {
+			if edge.Node.User.Login == "" || strings.EqualFold(edge.Node.User.Login, authorUsername) {
+				matchingEdges = append(matchingEdges, edge)
+			}
+		}
+		if len(matchingEdges) == 0 {
+			if !identities.PageInfo.HasNextPage || page >= SSOMaxPages {
+				err = fmt.Errorf("%w: no external identity for login %s in %d pages", ErrSSONotFound, authorUsername, page)
+				slog.Warn("got only external identities of other users from github api response", "error", err)
+				return
+			}
+			slog.Debug("got external identities of other users, reading the next page", "author", authorUsername, "page", page)
+			cursor = identities.PageInfo.EndCursor
+			continue
+		}
+		identities.Edges = matchingEdges
+
+		authorEmail, err = pickSSOEmail(githubAuthorSSO, config.PrimaryEmailDomain)
+		if err != nil {
+			slog.Warn("got no usable email from github api response", "error", err)
+			return
+		}
+		for _, edge := range identities.Edges {
+			if edge.Node.User.Login != "" {
+				login = edge.Node.User.Login
+				break
+			}
+		}
 		return
 	}
+}
 
-	var githubAuthorSSO GithubUserSSO
-	err = json.Unmarshal(body, &githubAuthorSSO)
+// GithubSSOQuery reads a page of the SAML identities of a login in an organization
+const GithubSSOQuery = `query($organization: String!, $login: String!, $first: Int!, $after: String) {
+  organization(login: $organization) {
+    samlIdentityProvider {
+      externalIdentities(first: $first, login: $login, after: $after) {
+        edges { node { samlIdentity { nameId } user { login } } }
+        pageInfo { hasNextPage endCursor }
+      }
+    }
+  }
+}`
+
+// GraphQLRequest is the body of a GitHub GraphQL API request. The values go in Variables, never in Query, so they don't
+// need any escaping.
+type GraphQLRequest struct {
+	Query     string         `json:"query"`
+	Variables map[string]any `json:"variables"`
+}
+
+// buildGithubSSOQueryBody builds the request of the page of the SAML identities of the author after the cursor, the
+// first one if it is empty
+func buildGithubSSOQueryBody(organization, authorUsername, cursor string) ([]byte, error) {
+	variables := map[string]any{
+		"organization": organization,
+		"login":        authorUsername,
+		"first":        SSOIdentitiesPageSize,
+		"after":        nil,
+	}
+	if cursor != "" {
+		variables["after"] = cursor
+	}
+	return json.Marshal(GraphQLRequest{Query: GithubSSOQuery, Variables: variables})
+}
+
+// getGithubOrganizationSSOPage requests the page of the SAML identities of the author after the cursor, the first one
+// if it is empty
+func getGithubOrganizationSSOPage(ctx context.Context, config Config, httpClient *http.Client, organization, authorUsername, cursor string) (githubAuthorSSO GithubUserSSO, err error) {
+	// Get email from organization SSO, using GitHub username as key
+	queryBody, err := buildGithubSSOQueryBody(organization, authorUsername, cursor)
 	if err != nil {
-		fmt.Println("got error unmarshalling github API response body:", err)
 		return
 	}
-
-	if len(githubAuthorSSO.Data.Organization.SAMLIdentityProvider.ExternalIdentities.Edges) == 0 {
-		err = errors.New("no external identity edges")
-		fmt.Println("got zero external identity edges from github api response:", err)
+	body, err := doGithubGraphQLRequest(ctx, config, httpClient, string(queryBody))
+	if err != nil {
+		slog.Warn("got error while doing request to github API", "error", err)
 		return
 	}
 
-	authorEmail = githubAuthorSSO.Data.Organization.SAMLIdentityProvider.ExternalIdentities.Edges[0].Node.SamlIdentity.NameId
+	err = json.Unmarshal(body, &githubAuthorSSO)
+	if err != nil {
+		slog.Warn("got error unmarshalling github API response body", "error", err)
+	}
+	return
+}
+
+// doGithubGraphQLRequest sends the query to the GitHub GraphQL API and returns the response body, retrying on
+// transient errors
+func doGithubGraphQLRequest(ctx context.Context, config Config, httpClient *http.Client, queryBody string) (body []byte, err error) {
+	err = buildGithubRetryPolicy(config).retry(ctx, func(ctx context.Context) (err error) {
+		req, err := http.NewRequestWithContext(ctx, "POST", config.GithubGraphQLURL, bytes.NewBuffer([]byte(queryBody)))
+		if err != nil {
+			return permanent(err)
+		}
+		req.Header.Add("Authorization", "Bearer "+config.GithubAccessToken)
+		req.Header.Set("User-Agent", config.HTTPUserAgent)
+		if config.DebugGithubHTTP {
+			logDebugRequest(req, queryBody)
+		}
+
+		resp, err := httpClient.Do(req)
+		if err != nil {
+			return
+		}
+		defer func() {
+			closeErr := resp.Body.Close()
+			if closeErr != nil {
+				slog.Warn("got error closing github API response body", "error", closeErr)
+			}
+		}()
+
+		body, err = io.ReadAll(resp.Body)
+		if err != nil {
+			slog.Warn("got error reading github API response body", "error", err)
+			return
+		}
+		if config.DebugGithubHTTP {
+			logDebugResponse(resp, body)
+		}
+		return classifyGithubResponse(resp, body)
+	})
 	return
 }
 
-func sendMessageToChannel(client *slack.Client, slackChannel, message string) {
-	respChannel, respTimestamp, err := client.PostMessage(slackChannel,
+// pickSSOEmail chooses the SAML identity that best represents the author email. Identities whose nameId is not an
+// email are ignored, and if a primary domain is given an identity on that domain is preferred over the others.
+func pickSSOEmail(githubUserSSO GithubUserSSO, primaryDomain string) (email string, err error) {
+	for _, edge := range githubUserSSO.Data.Organization.SAMLIdentityProvider.ExternalIdentities.Edges {
+		nameId := edge.Node.SamlIdentity.NameId
+		if !looksLikeEmail(nameId) {
+			continue
+		}
+		if primaryDomain == "" || strings.HasSuffix(strings.ToLower(nameId), "@"+strings.ToLower(primaryDomain)) {
+			email = nameId
+			return
+		}
+		if email == "" {
+			email = nameId
+		}
+	}
+	if email == "" {
+		err = fmt.Errorf("%w: no external identity with an email nameId", ErrSSONotFound)
+	}
+	return
+}
+
+func looksLikeEmail(s string) bool {
+	address, err := mail.ParseAddress(s)
+	return err == nil && address.Address == s
+}
+
+// sendMessageToChannel posts the message to the channel, joining it if needed, and returns the channel ID and timestamp
+// of the posted message
+func sendMessageToChannel(ctx context.Context, config Config, client *slack.Client, slackChannel, message string, options ...slack.MsgOption) (respChannel, respTimestamp string, err error) {
+	if strings.TrimSpace(message) == "" {
+		err = errors.New("message is empty")
+		slog.Error("got error posting message to slack channel", "error", err)
+		return
+	}
+	// In an Enterprise Grid org the channel name is ambiguous, post to the ID of the channel in our workspace instead
+	if config.SlackTeamID != "" {
+		slackChannel, err = resolveChannelID(client, config.SlackTeamID, slackChannel)
+		if err != nil {
+			slog.Error("got error resolving slack channel in team", "error", err)
+			return
+		}
+	}
+	options = append([]slack.MsgOption{
 		slack.MsgOptionText(message, false),
 		slack.MsgOptionAsUser(true),
-		slack.MsgOptionDisableLinkUnfurl())
+		slack.MsgOptionDisableLinkUnfurl(),
+	}, options...)
+	respChannel, respTimestamp, err = postMessage(ctx, config, client, slackChannel, options...)
+
+	// The bot can join public channels by itself, so try that once before giving up
+	if isSlackError(err, "not_in_channel") {
+		slog.Info("bot is not in slack channel, trying to join it", "channel", slackChannel)
+		err = joinChannel(client, config.SlackTeamID, slackChannel)
+		if err != nil {
+			err = fmt.Errorf("bot is not in slack channel %s and could not join it, invite it to the channel: %w", slackChannel, err)
+			slog.Error("got error posting message to slack channel", "error", err)
+			return
+		}
+		respChannel, respTimestamp, err = postMessage(ctx, config, client, slackChannel, options...)
+	}
+	if isSlackError(err, "channel_not_found") {
+		err = fmt.Errorf("%w: %s, check the channel name and that the bot can see it: %w", ErrChannelNotFound, slackChannel, err)
+	}
+	err = wrapSlackAuthError(err)
 	if err != nil {
-		fmt.Println("got error posting message to slack channel:", err)
+		slog.Error("got error posting message to slack channel", "error", err)
 		return
 	}
-	fmt.Println("message sent to channel", respChannel, "at", respTimestamp)
+	slog.Info("message sent to channel", "channel", respChannel, "timestamp", respTimestamp)
 	return
 }
 
-func sendMessageToUser(client *slack.Client, userEmail string, message string) {
-	slackUser, err := client.GetUserByEmail(userEmail)
+// sendMessageToUser sends the message to the user with the email as a direct message, and returns the channel ID
+// and timestamp of the posted message
+func sendMessageToUser(ctx context.Context, config Config, client *slack.Client, userEmail string, message string) (respChannel, respTimestamp string, err error) {
+	if !looksLikeEmail(userEmail) {
+		err = fmt.Errorf("user email %q does not look like an email", userEmail)
+		slog.Error("user email does not look like an email, aborting", "email", userEmail)
+		return
+	}
+
+	slackUser, err := getUserByEmail(ctx, buildSlackRetryPolicy(config), client, userEmail)
 	if err != nil {
-		fmt.Println("got error getting slack user by email, aborting", err)
+		err = wrapSlackAuthError(err)
+		logScopeError(err, "users:read.email")
+		slog.Error("got error getting slack user by email, aborting", "error", err)
 		return
 	}
 
-	fmt.Println("sending message:", message)
+	message = addGreeting(config, slackUser, message)
+	slog.Info("sending message", "message", message)
 
-	respChannel, respTimestamp, err := client.PostMessage(slackUser.ID, slack.MsgOptionText(message, false), slack.MsgOptionAsUser(true))
+	respChannel, respTimestamp, err = postMessage(ctx, config, client, slackUser.ID, slack.MsgOptionText(message, false), slack.MsgOptionAsUser(true))
 	if err != nil {
-		fmt.Println("got error posting message to slack user:", err)
+		slog.Error("got error posting message to slack user", "error", err)
 		return
 	}
-	fmt.Println("message sent to user", respChannel, "at", respTimestamp)
+	slog.Info("message sent to user", "channel", respChannel, "timestamp", respTimestamp)
+	return
+}
+
+// addGreeting prefixes a direct message with a greeting for the time of day of the user, with PERSONALIZED_GREETING
+func addGreeting(config Config, slackUser *slack.User, message string) string {
+	if !config.PersonalizedGreeting {
+		return message
+	}
+	greeting := buildGreeting(slackUser, time.Now())
+	if greeting == "" {
+		return message
+	}
+	return greeting + "! " + message
+}
+
+// sendPreviewToAuthor sends the message to the commit author as a direct message before it is posted to the
+// channel, so they see how they are mentioned. It is only informative, so errors are logged and the post goes on.
+func sendPreviewToAuthor(ctx context.Context, config Config, client *slack.Client, authors []Author, slackChannel, message string) {
+	if len(authors) == 0 || authors[0].slackUser == nil || authors[0].slackUser.ID == "" {
+		slog.Info("commit author not found in slack, not sending a preview")
+		return
+	}
+
+	slog.Info("sending preview to commit author", "author", authors[0].username, "message", message)
+	preview := fmt.Sprintf(":eyes: Preview of the message about to be posted to %s:\n%s", slackChannel, message)
+	_, _, err := postMessage(ctx, config, client, authors[0].slackUser.ID, slack.MsgOptionText(preview, false), slack.MsgOptionAsUser(true))
+	if err != nil {
+		slog.Warn("got error sending preview to commit author", "error", err)
+	}
+}
+
+// postMessage posts to Slack, retrying on rate limits and transient errors
+func postMessage(ctx context.Context, config Config, client *slack.Client, channel string, options ...slack.MsgOption) (respChannel, respTimestamp string, err error) {
+	err = buildSlackRetryPolicy(config).retry(ctx, func(ctx context.Context) (err error) {
+		respChannel, respTimestamp, err = client.PostMessageContext(ctx, channel, options...)
+		return classifySlackError(err)
+	})
 	return
 }
@@ -0,0 +1,1367 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+func TestTruncateMessage(t *testing.T) {
+	tests := []struct {
+		name      string
+		message   string
+		maxLength int
+		want      string
+	}{
+		{name: "no limit", message: "build failed", maxLength: 0, want: "build failed"},
+		{name: "shorter than the limit", message: "build failed", maxLength: 20, want: "build failed"},
+		{name: "exactly the limit", message: "build failed", maxLength: 12, want: "build failed"},
+		{name: "longer than the limit", message: "build failed", maxLength: 6, want: "build…"},
+		{name: "counts runes, not bytes", message: "ビルド失敗しました", maxLength: 4, want: "ビルド…"},
+		{name: "negative limit", message: "build failed", maxLength: -1, want: "build failed"},
+		{name: "closes an open code block", message: "build failed\n```\n a.go | 2 +-\n b.go | 1 +\n```", maxLength: 24, want: "build failed\n```\n a…\n```"},
+		{name: "closed code block", message: "x\n```\na\n```\nbuild failed badly", maxLength: 18, want: "x\n```\na\n```\nbuild…"},
+		{name: "code block cut away to close it", message: "build failed\n```\n a.go | 2 +-\n```", maxLength: 17, want: "build failed…"},
+	}
+	for _, test := range tests {
+		if got := truncateMessage(test.message, test.maxLength); got != test.want {
+			t.Errorf("%s: got %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestFormatMention(t *testing.T) {
+	tests := []struct {
+		mention string
+		want    string
+	}{
+		{mention: "U012AB3CD", want: "<@U012AB3CD>"},
+		{mention: "@U012AB3CD", want: "<@U012AB3CD>"},
+		{mention: "S012AB3CD", want: "<!subteam^S012AB3CD>"},
+		{mention: "Sam", want: "<@Sam>"},
+		{mention: "here", want: "<!here>"},
+		{mention: "@channel", want: "<!channel>"},
+		{mention: "<!subteam^S012AB3CD|oncall>", want: "<!subteam^S012AB3CD|oncall>"},
+	}
+	for _, test := range tests {
+		if got := formatMention(test.mention); got != test.want {
+			t.Errorf("%q: got %q, want %q", test.mention, got, test.want)
+		}
+	}
+}
+
+func TestBuildConclusionMentionClause(t *testing.T) {
+	config := Config{
+		SuccessMention:     "U0SUCCESS",
+		FailureMention:     "S0ONCALL, here",
+		FailureConclusions: []string{"failure", "error"},
+	}
+	tests := []struct {
+		conclusion string
+		want       string
+	}{
+		{conclusion: "success", want: " cc <@U0SUCCESS>"},
+		{conclusion: "failure", want: " cc <!subteam^S0ONCALL> <!here>"},
+		{conclusion: "cancelled", want: ""},
+	}
+	for _, test := range tests {
+		got := buildConclusionMentionClause(config, CommitStatus{Conclusion: test.conclusion})
+		if got != test.want {
+			t.Errorf("%s: got %q, want %q", test.conclusion, got, test.want)
+		}
+	}
+}
+
+func buildGithubUserSSO(t *testing.T, nameIds ...string) (githubUserSSO GithubUserSSO) {
+	var edges []string
+	for _, nameId := range nameIds {
+		edges = append(edges, fmt.Sprintf(`{"node": {"samlIdentity": {"nameId": %q}}}`, nameId))
+	}
+	body := `{"data": {"organization": {"samlIdentityProvider": {"externalIdentities": {"edges": [` + strings.Join(edges, ",") + `]}}}}}`
+	err := json.Unmarshal([]byte(body), &githubUserSSO)
+	if err != nil {
+		t.Fatalf("got error building the SSO response: %v", err)
+	}
+	return
+}
+
+func TestPickSSOEmail(t *testing.T) {
+	tests := []struct {
+		name          string
+		nameIds       []string
+		primaryDomain string
+		want          string
+		wantErr       error
+	}{
+		{name: "single identity", nameIds: []string{"jane@example.com"}, want: "jane@example.com"},
+		{name: "first email without a primary domain", nameIds: []string{"jane@contractor.io", "jane@example.com"}, want: "jane@contractor.io"},
+		{name: "prefers the primary domain", nameIds: []string{"jane@contractor.io", "jane@Example.com"}, primaryDomain: "example.com", want: "jane@Example.com"},
+		{name: "falls back to another domain", nameIds: []string{"jane@contractor.io"}, primaryDomain: "example.com", want: "jane@contractor.io"},
+		{name: "skips nameIds that are not emails", nameIds: []string{"jdoe", "jane@example.com"}, want: "jane@example.com"},
+		{name: "no email nameId", nameIds: []string{"jdoe"}, wantErr: ErrSSONotFound},
+		{name: "no identity", wantErr: ErrSSONotFound},
+	}
+	for _, test := range tests {
+		got, err := pickSSOEmail(buildGithubUserSSO(t, test.nameIds...), test.primaryDomain)
+		if !errors.Is(err, test.wantErr) || (test.wantErr == nil && err != nil) {
+			t.Errorf("%s: got error %v, want %v", test.name, err, test.wantErr)
+		}
+		if got != test.want {
+			t.Errorf("%s: got %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestBuildUserMention(t *testing.T) {
+	config := Config{GithubServerURL: DefaultGithubServerURL, AuthorDisplay: AuthorDisplayGithubUsername}
+	tests := []struct {
+		name      string
+		slackUser *slack.User
+		want      string
+	}{
+		{name: "slack ID", slackUser: &slack.User{ID: "U0JANE", Name: "jane"}, want: "<@U0JANE> (<https://github.com/jdoe|jdoe>)"},
+		{name: "slack handle only", slackUser: &slack.User{Name: "jane"}, want: "@jane (<https://github.com/jdoe|jdoe>)"},
+		{name: "github link", slackUser: nil, want: "<https://github.com/jdoe|jdoe>"},
+		{name: "user without ID nor handle", slackUser: &slack.User{}, want: "<https://github.com/jdoe|jdoe>"},
+	}
+	for _, test := range tests {
+		if got := buildUserMention(config, test.slackUser, "jdoe"); got != test.want {
+			t.Errorf("%s: got %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestBuildUserMentionAuthorDisplay(t *testing.T) {
+	displayName := &slack.User{ID: "U0JANE", RealName: "Jane Doe", Profile: slack.UserProfile{DisplayName: "jane <3"}}
+	realName := &slack.User{ID: "U0JANE", RealName: "Jane Doe"}
+	profileRealName := &slack.User{ID: "U0JANE", Profile: slack.UserProfile{RealName: "Jane P. Doe"}}
+	noName := &slack.User{ID: "U0JANE"}
+	tests := []struct {
+		name      string
+		env       string
+		slackUser *slack.User
+		want      string
+	}{
+		{name: "github username by default", slackUser: displayName, want: "<@U0JANE> (<https://github.com/jdoe|jdoe>)"},
+		{name: "github username", env: AuthorDisplayGithubUsername, slackUser: displayName, want: "<@U0JANE> (<https://github.com/jdoe|jdoe>)"},
+		{name: "invalid falls back to github username", env: "nickname", slackUser: displayName, want: "<@U0JANE> (<https://github.com/jdoe|jdoe>)"},
+		{name: "slack display name", env: AuthorDisplaySlackName, slackUser: displayName, want: "<@U0JANE> (<https://github.com/jdoe|jane &lt;3>)"},
+		{name: "slack real name", env: AuthorDisplaySlackName, slackUser: realName, want: "<@U0JANE> (<https://github.com/jdoe|Jane Doe>)"},
+		{name: "slack profile real name", env: AuthorDisplaySlackName, slackUser: profileRealName, want: "<@U0JANE> (<https://github.com/jdoe|Jane P. Doe>)"},
+		{name: "slack user without name", env: AuthorDisplaySlackName, slackUser: noName, want: "<@U0JANE> (<https://github.com/jdoe|jdoe>)"},
+		{name: "no slack user", env: AuthorDisplaySlackName, want: "<https://github.com/jdoe|jdoe>"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Setenv("AUTHOR_DISPLAY", test.env)
+			if got := buildUserMention(buildConfig(), test.slackUser, "jdoe"); got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestBuildFailedJobChannelMessagePullRequestAuthor(t *testing.T) {
+	commit := Commit{sha: "abc123", authorUsername: "jdoe", authorEmail: "jane@example.com", commitMessage: "Fix the build"}
+	pullRequest := PullRequest{
+		number:      "12",
+		url:         "https://github.com/owner/repo/pull/12",
+		author:      "psmith",
+		authorEmail: "pat@example.com",
+		reviewers:   []string{"rlee", "kwu"},
+	}
+	reviewers := ", reviewers <https://github.com/rlee|rlee>, <https://github.com/kwu|kwu>"
+	tests := []struct {
+		name        string
+		policy      string
+		pullRequest func(pullRequest PullRequest) PullRequest
+		want        []string
+		notWant     []string
+	}{
+		{
+			name:   "other author with both",
+			policy: PRMentionPolicyBoth,
+			want:   []string{"by <@U0JANE>", ", cc PR author <@U0PAT>", reviewers},
+		},
+		{
+			name:    "other author with pr-author",
+			policy:  PRMentionPolicyPRAuthor,
+			want:    []string{"by <https://github.com/jdoe|jdoe>", ", cc PR author <@U0PAT>", reviewers},
+			notWant: []string{"<@U0JANE>"},
+		},
+		{
+			name:    "other author with commit-author",
+			policy:  PRMentionPolicyCommitAuthor,
+			want:    []string{"by <@U0JANE>"},
+			notWant: []string{"cc PR author", "reviewers", "<@U0PAT>"},
+		},
+		{
+			name:   "same author",
+			policy: PRMentionPolicyBoth,
+			pullRequest: func(pullRequest PullRequest) PullRequest {
+				pullRequest.author, pullRequest.authorEmail = "JDoe", "jane@example.com"
+				return pullRequest
+			},
+			want:    []string{"by <@U0JANE>"},
+			notWant: []string{"cc PR author", "reviewers"},
+		},
+		{
+			name:   "same slack user under another account",
+			policy: PRMentionPolicyBoth,
+			pullRequest: func(pullRequest PullRequest) PullRequest {
+				pullRequest.author, pullRequest.authorEmail = "jdoe-work", "jane@example.com"
+				return pullRequest
+			},
+			want:    []string{"by <@U0JANE>", reviewers},
+			notWant: []string{"cc PR author"},
+		},
+		{
+			name:   "no reviewers",
+			policy: PRMentionPolicyBoth,
+			pullRequest: func(pullRequest PullRequest) PullRequest {
+				pullRequest.reviewers = nil
+				return pullRequest
+			},
+			want:    []string{", cc PR author <@U0PAT>"},
+			notWant: []string{"reviewers"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := Config{PRMentionPolicy: test.policy, GithubServerURL: DefaultGithubServerURL}
+			userResolver, _ := newFakeUserDirectory(t, config, map[string]string{"jane@example.com": "U0JANE", "pat@example.com": "U0PAT"})
+			pullRequest := pullRequest
+			if test.pullRequest != nil {
+				pullRequest = test.pullRequest(pullRequest)
+			}
+			message := buildFailedJobChannelMessage(config, userResolver, commit, CommitStatus{Name: "build", Conclusion: "failure"}, pullRequest)
+			for _, want := range test.want {
+				if !strings.Contains(message, want) {
+					t.Errorf("got %q, want it to contain %q", message, want)
+				}
+			}
+			for _, notWant := range test.notWant {
+				if strings.Contains(message, notWant) {
+					t.Errorf("got %q, want it not to contain %q", message, notWant)
+				}
+			}
+		})
+	}
+}
+
+// newFakeGithubAPI serves the GitHub API with the handler at the returned URL, with a client failing the test on
+// requests sent anywhere else, and the number of requests served
+func newFakeGithubAPI(t *testing.T, handler http.HandlerFunc) (apiURL string, httpClient *http.Client, requests *atomic.Int32) {
+	requests = &atomic.Int32{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		handler(w, r)
+	}))
+	t.Cleanup(server.Close)
+	httpClient = &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		if req.URL.Host != server.Listener.Addr().String() {
+			t.Errorf("got request to %s, want it sent to the configured GitHub API", req.URL)
+			return nil, errors.New("unexpected host")
+		}
+		return http.DefaultTransport.RoundTrip(req)
+	})}
+	apiURL = server.URL
+	return
+}
+
+func TestBuildChannelMessageOnUnresolvedUser(t *testing.T) {
+	tests := []struct {
+		name         string
+		env          string
+		authorEmail  string
+		wantSkip     bool
+		wantAnnotate bool
+	}{
+		{name: "silent by default", authorEmail: "ghost@example.com"},
+		{name: "silent", env: OnUnresolvedUserSilent, authorEmail: "ghost@example.com"},
+		{name: "annotate", env: OnUnresolvedUserAnnotate, authorEmail: "ghost@example.com", wantAnnotate: true},
+		{name: "skip", env: OnUnresolvedUserSkip, authorEmail: "ghost@example.com", wantSkip: true},
+		{name: "invalid falls back to silent", env: "shout", authorEmail: "ghost@example.com"},
+		{name: "annotate a resolved author", env: OnUnresolvedUserAnnotate, authorEmail: "jane@example.com"},
+		{name: "skip a resolved author", env: OnUnresolvedUserSkip, authorEmail: "jane@example.com"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Setenv("ON_UNRESOLVED_USER", test.env)
+			config := buildConfig()
+			userResolver, _ := newFakeUserDirectory(t, config, map[string]string{"jane@example.com": "U0JANE"})
+			commit := Commit{sha: "abc123", authorUsername: "jdoe", authorEmail: test.authorEmail, commitMessage: "Fix build"}
+			status := CommitStatus{Name: "build", Conclusion: "failure", Url: "https://ci.example.com/run/1"}
+
+			message, skip := buildChannelMessage(config, userResolver, commit, status, PullRequest{}, nil, nil, "")
+			if skip != test.wantSkip {
+				t.Fatalf("got skip %t, want %t", skip, test.wantSkip)
+			}
+			if skip {
+				return
+			}
+			if annotated := strings.Contains(message, " (Slack user not found)"); annotated != test.wantAnnotate {
+				t.Errorf("got message %q, want annotated %t", message, test.wantAnnotate)
+			}
+			if !strings.Contains(message, "Fix build") {
+				t.Errorf("got message %q, want the commit in it", message)
+			}
+		})
+	}
+}
+
+func TestBuildCommitWithoutTokenSkipsGithub(t *testing.T) {
+	apiURL, httpClient, requests := newFakeGithubAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("got request to %s, want no GitHub call without a token", r.URL)
+		http.Error(w, "unexpected request", http.StatusUnauthorized)
+	})
+	config := Config{
+		GithubServerURL:     DefaultGithubServerURL,
+		GithubGraphQLURL:    apiURL + "/graphql",
+		GithubOrganizations: []string{"acme", "acme-labs"},
+		BotAuthorRegexp:     regexp.MustCompile(DefaultBotAuthorPattern),
+		SSOEmptyRetries:     2,
+	}
+	t.Setenv("COMMIT_SHA", "abc123")
+	t.Setenv("COMMIT_AUTHOR_USERNAME", "jdoe")
+	t.Setenv("COMMIT_AUTHOR_EMAIL", "jane@users.example.com")
+	t.Setenv("COMMITS_JSON", `[{"sha": "def456", "authorUsername": "psmith", "authorEmail": "pat@users.example.com"}]`)
+
+	commit := buildCommit(context.Background(), config, httpClient)
+	if commit.authorEmail != "jane@users.example.com" || commit.ssoResolved {
+		t.Errorf("got email %q and SSO resolved %t, want the commit email kept", commit.authorEmail, commit.ssoResolved)
+	}
+	digestCommits, err := buildDigestCommits(context.Background(), config, httpClient)
+	if err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	if len(digestCommits) != 1 || digestCommits[0].authorEmail != "pat@users.example.com" {
+		t.Errorf("got digest commits %+v, want the commit email kept", digestCommits)
+	}
+	if got := requests.Load(); got != 0 {
+		t.Errorf("got %d GitHub requests, want none", got)
+	}
+
+	// With a token the same commit is looked up, so the server would have caught the calls
+	config.GithubAccessToken = "ghp_test"
+	config.SSOEmptyRetries = 0
+	apiURL, httpClient, requests = newFakeGithubAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"data": {"organization": {"samlIdentityProvider": {"externalIdentities": {"edges": []}}}}}`))
+	})
+	config.GithubGraphQLURL = apiURL + "/graphql"
+	buildCommit(context.Background(), config, httpClient)
+	if got := requests.Load(); got != 2 {
+		t.Errorf("got %d GitHub requests with a token, want one per organization", got)
+	}
+}
+
+func TestEscapeMrkdwn(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{name: "plain", text: "Fix the build", want: "Fix the build"},
+		{name: "ampersand", text: "Tom & Jerry", want: "Tom &amp; Jerry"},
+		{name: "angle brackets", text: "if a < b && b > c", want: "if a &lt; b &amp;&amp; b &gt; c"},
+		{name: "markup", text: "<!channel> <@U123> <https://x.io|x>", want: "&lt;!channel&gt; &lt;@U123&gt; &lt;https://x.io|x&gt;"},
+		// Text that looks escaped is shown as typed, so it is escaped again
+		{name: "already escaped", text: "&lt;b&gt; &amp;", want: "&amp;lt;b&amp;gt; &amp;amp;"},
+		{name: "other characters kept", text: "*bold* _it_ `code` ~st~ \"q\" 'a'", want: "*bold* _it_ `code` ~st~ \"q\" 'a'"},
+		{name: "empty", text: "", want: ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := escapeMrkdwn(test.text); got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+			if got := mrkdwnUnescaper.Replace(escapeMrkdwn(test.text)); got != test.text {
+				t.Errorf("got %q unescaped, want the text back", got)
+			}
+		})
+	}
+}
+
+func TestLooksLikeEmail(t *testing.T) {
+	tests := []struct {
+		s    string
+		want bool
+	}{
+		{s: "jane@example.com", want: true},
+		{s: "jane.doe+ci@eng.example.com", want: true},
+		{s: "123+octocat@users.noreply.github.com", want: true},
+		{s: "", want: false},
+		{s: "jdoe", want: false},
+		{s: "@jdoe", want: false},
+		{s: "jane@", want: false},
+		{s: "jane doe@example.com", want: false},
+		{s: " jane@example.com", want: false},
+		{s: "Jane <jane@example.com>", want: false},
+		{s: "jane@example.com, john@example.com", want: false},
+	}
+	for _, test := range tests {
+		t.Run(test.s, func(t *testing.T) {
+			if got := looksLikeEmail(test.s); got != test.want {
+				t.Errorf("got %t, want %t", got, test.want)
+			}
+		})
+	}
+}
+
+func TestBuildTimingClause(t *testing.T) {
+	location, err := time.LoadLocation("America/Argentina/Buenos_Aires")
+	if err != nil {
+		t.Skipf("timezone data not available: %v", err)
+	}
+	startedAt := time.Date(2026, 3, 9, 23, 58, 0, 0, time.UTC)
+	completedAt := startedAt.Add(4*time.Minute + 31*time.Second + 400*time.Millisecond)
+	tests := []struct {
+		name   string
+		config Config
+		status CommitStatus
+		want   string
+	}{
+		{name: "unknown times", config: Config{Location: location, TimeFormat: time.RFC3339}},
+		{
+			name:   "in the location",
+			config: Config{Location: location, TimeFormat: time.RFC3339},
+			status: CommitStatus{CompletedAt: completedAt},
+			want:   " at 2026-03-09T21:02:31-03:00",
+		},
+		{
+			name:   "in the location with a custom format",
+			config: Config{Location: location, TimeFormat: "Jan 2 15:04 MST"},
+			status: CommitStatus{StartedAt: startedAt, CompletedAt: completedAt},
+			want:   " at Mar 9 21:02 -03 after 4m31s",
+		},
+		{
+			name:   "utc",
+			config: Config{Location: time.UTC, TimeFormat: time.RFC3339},
+			status: CommitStatus{StartedAt: startedAt, CompletedAt: completedAt},
+			want:   " at 2026-03-10T00:02:31Z after 4m31s",
+		},
+		{
+			name:   "completed before started",
+			config: Config{Location: time.UTC, TimeFormat: time.RFC3339},
+			status: CommitStatus{StartedAt: completedAt, CompletedAt: startedAt},
+			want:   " at 2026-03-09T23:58:00Z",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := buildTimingClause(test.config, test.status); got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestIsSkippedDraft(t *testing.T) {
+	tests := []struct {
+		name           string
+		notifyDraftPRs string
+		prDraft        string
+		want           bool
+	}{
+		{name: "draft by default", prDraft: "true", want: true},
+		{name: "draft in other case", prDraft: " True ", want: true},
+		{name: "draft with NOTIFY_DRAFT_PRS", notifyDraftPRs: "true", prDraft: "true", want: false},
+		{name: "ready for review", prDraft: "false", want: false},
+		{name: "no pull request", want: false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Setenv("NOTIFY_DRAFT_PRS", test.notifyDraftPRs)
+			t.Setenv("PR_DRAFT", test.prDraft)
+			if got := isSkippedDraft(buildConfig(), buildPullRequest()); got != test.want {
+				t.Errorf("got %t, want %t", got, test.want)
+			}
+		})
+	}
+}
+
+func TestIsMutedAuthor(t *testing.T) {
+	tests := []struct {
+		name     string
+		env      string
+		username string
+		want     bool
+	}{
+		{name: "listed", env: "ci-bot,deployer", username: "deployer", want: true},
+		{name: "other case", env: "CI-Bot", username: "ci-bot", want: true},
+		{name: "with @ and spaces", env: " @ci-bot , @deployer ", username: "ci-bot", want: true},
+		{name: "not listed", env: "ci-bot", username: "jdoe", want: false},
+		{name: "prefix only", env: "ci", username: "ci-bot", want: false},
+		{name: "nobody muted", env: "", username: "jdoe", want: false},
+		{name: "empty entries", env: ",,", username: "", want: false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Setenv("MUTED_AUTHORS", test.env)
+			if got := isMutedAuthor(buildConfig(), test.username); got != test.want {
+				t.Errorf("got %t, want %t", got, test.want)
+			}
+		})
+	}
+}
+
+func TestIsCommitStale(t *testing.T) {
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name      string
+		timestamp time.Time
+		maxAge    time.Duration
+		want      bool
+	}{
+		{name: "recent", timestamp: now.Add(-time.Minute), maxAge: time.Hour, want: false},
+		{name: "old", timestamp: now.Add(-2 * time.Hour), maxAge: time.Hour, want: true},
+		{name: "exactly at the threshold", timestamp: now.Add(-time.Hour), maxAge: time.Hour, want: false},
+		{name: "just past the threshold", timestamp: now.Add(-time.Hour - time.Second), maxAge: time.Hour, want: true},
+		{name: "zero threshold", timestamp: now.Add(-24 * time.Hour), maxAge: 0, want: false},
+		{name: "negative threshold", timestamp: now.Add(-24 * time.Hour), maxAge: -time.Hour, want: false},
+		{name: "no timestamp", maxAge: time.Hour, want: false},
+		{name: "in the future", timestamp: now.Add(time.Hour), maxAge: time.Hour, want: false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := isCommitStale(Commit{timestamp: test.timestamp}, test.maxAge, now); got != test.want {
+				t.Errorf("got %t, want %t", got, test.want)
+			}
+		})
+	}
+}
+
+func TestBuildCommitStatus(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		want CommitStatus
+	}{
+		{
+			name: "all set",
+			env: map[string]string{
+				"STATUS_NAME":         "build",
+				"STATUS_DESCRIPTION":  "Build and test",
+				"STATUS_CONCLUSION":   "failure",
+				"STATUS_URL":          "https://ci.example.com/run/1",
+				"JOB_NAME":            "test",
+				"STEP_NAME":           "go test",
+				"STATUS_STARTED_AT":   "2024-05-01T10:00:00Z",
+				"STATUS_COMPLETED_AT": "2024-05-01T10:05:30+02:00",
+			},
+			want: CommitStatus{
+				Name:        "build",
+				Description: "Build and test",
+				Conclusion:  "failure",
+				Url:         "https://ci.example.com/run/1",
+				JobName:     "test",
+				StepName:    "go test",
+				StartedAt:   time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC),
+				CompletedAt: time.Date(2024, 5, 1, 8, 5, 30, 0, time.UTC),
+			},
+		},
+		{
+			name: "conclusion is normalized",
+			env:  map[string]string{"STATUS_NAME": "build", "STATUS_CONCLUSION": " Failure\n"},
+			want: CommitStatus{Name: "build", Conclusion: "failure"},
+		},
+		{
+			name: "invalid timestamps are ignored",
+			env:  map[string]string{"STATUS_NAME": "build", "STATUS_STARTED_AT": "yesterday", "STATUS_COMPLETED_AT": "1714557600"},
+			want: CommitStatus{Name: "build"},
+		},
+		{
+			name: "nothing set",
+			env:  map[string]string{},
+			want: CommitStatus{},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for _, key := range []string{"STATUS_NAME", "STATUS_DESCRIPTION", "STATUS_CONCLUSION", "STATUS_URL", "JOB_NAME", "STEP_NAME", "STATUS_STARTED_AT", "STATUS_COMPLETED_AT"} {
+				t.Setenv(key, test.env[key])
+			}
+			got := buildCommitStatus()
+			if !got.StartedAt.Equal(test.want.StartedAt) || !got.CompletedAt.Equal(test.want.CompletedAt) {
+				t.Errorf("got times %v and %v, want %v and %v", got.StartedAt, got.CompletedAt, test.want.StartedAt, test.want.CompletedAt)
+			}
+			got.StartedAt, got.CompletedAt = test.want.StartedAt, test.want.CompletedAt
+			if got != test.want {
+				t.Errorf("got %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestIsSkippedCancellation(t *testing.T) {
+	tests := []struct {
+		name       string
+		env        string
+		conclusion string
+		want       bool
+	}{
+		{name: "cancelled by default", conclusion: "cancelled", want: true},
+		{name: "cancelled with NOTIFY_ON_CANCELLED", env: "true", conclusion: "cancelled", want: false},
+		{name: "cancelled with NOTIFY_ON_CANCELLED not true", env: "yes", conclusion: "cancelled", want: true},
+		{name: "failure by default", conclusion: "failure", want: false},
+		{name: "failure with NOTIFY_ON_CANCELLED", env: "true", conclusion: "failure", want: false},
+		{name: "success by default", conclusion: "success", want: false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Setenv("NOTIFY_ON_CANCELLED", test.env)
+			got := isSkippedCancellation(buildConfig(), CommitStatus{Name: "build", Conclusion: test.conclusion})
+			if got != test.want {
+				t.Errorf("got %t, want %t", got, test.want)
+			}
+		})
+	}
+}
+
+func TestFailureConclusions(t *testing.T) {
+	tests := []struct {
+		name        string
+		env         string
+		conclusions map[string]bool
+	}{
+		{
+			name:        "default",
+			conclusions: map[string]bool{"failure": true, "error": true, "timed_out": false, "success": false, "cancelled": false},
+		},
+		{
+			name:        "with timed_out",
+			env:         " Failure, TIMED_OUT ,,action_required",
+			conclusions: map[string]bool{"failure": true, "timed_out": true, "action_required": true, "error": false, "success": false},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Setenv("FAILURE_CONCLUSIONS", test.env)
+			config := buildConfig()
+			for conclusion, want := range test.conclusions {
+				if got := (CommitStatus{Conclusion: conclusion}).Failed(config.FailureConclusions); got != want {
+					t.Errorf("%s: got failed %t, want %t", conclusion, got, want)
+				}
+			}
+		})
+	}
+
+	// A timed out status is then notified like any failure, with the failure emoji and the mentions
+	config := Config{FailureConclusions: []string{"failure", "timed_out"}, FailureMention: "S0ONCALL", GithubServerURL: DefaultGithubServerURL}
+	userResolver, _ := newFakeUserDirectory(t, config, map[string]string{"jane@example.com": "U0JANE"})
+	commit := Commit{sha: "abc123", authorUsername: "jdoe", authorEmail: "jane@example.com", commitMessage: "Fix the build"}
+	message, _ := buildChannelMessage(config, userResolver, commit, CommitStatus{Name: "build", Conclusion: "timed_out"}, PullRequest{}, nil, nil, "")
+	for _, want := range []string{":warning:", "has failed the pipeline step", "<@U0JANE>", "<!subteam^S0ONCALL>"} {
+		if !strings.Contains(message, want) {
+			t.Errorf("got %q, want it to contain %q", message, want)
+		}
+	}
+}
+
+func TestBuildCommitTitle(t *testing.T) {
+	pullRequest := PullRequest{number: "12", url: "https://github.com/owner/repo/pull/12", title: "Add API tokens"}
+	tests := []struct {
+		name          string
+		titleSource   string
+		commitMessage string
+		pullRequest   PullRequest
+		want          string
+	}{
+		{name: "first line", commitMessage: "feat(api): add tokens\n\nBody", want: "feat(api): add tokens"},
+		{name: "crlf", commitMessage: "Fix the build\r\n\r\nBody", want: "Fix the build"},
+		{name: "pr title", titleSource: TitleSourcePRTitle, commitMessage: "wip", pullRequest: pullRequest, want: "Add API tokens"},
+		{name: "pr title without pr", titleSource: TitleSourcePRTitle, commitMessage: "wip\n\nBody", want: "wip"},
+		{name: "conventional", titleSource: TitleSourceConventionalSubject, commitMessage: "fix: handle empty tokens", want: "handle empty tokens"},
+		{name: "conventional with scope and breaking change", titleSource: TitleSourceConventionalSubject, commitMessage: "feat(scope)!: drop v1", want: "drop v1"},
+		{name: "conventional breaking change", titleSource: TitleSourceConventionalSubject, commitMessage: "refactor!: rename the env vars", want: "rename the env vars"},
+		{name: "conventional multiline", titleSource: TitleSourceConventionalSubject, commitMessage: "feat(api): add tokens\r\n\r\nfix: not a subject", want: "add tokens"},
+		{name: "no type", titleSource: TitleSourceConventionalSubject, commitMessage: "Add tokens", want: "Add tokens"},
+		{name: "no description", titleSource: TitleSourceConventionalSubject, commitMessage: "feat: ", want: "feat: "},
+		{name: "colon later in the title", titleSource: TitleSourceConventionalSubject, commitMessage: "Fix the build: again", want: "Fix the build: again"},
+		{name: "empty", titleSource: TitleSourceConventionalSubject, want: ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := Config{TitleSource: test.titleSource}
+			if got := buildCommitTitle(config, Commit{commitMessage: test.commitMessage}, test.pullRequest); got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestBuildDiffStatBlock(t *testing.T) {
+	var manyFiles []string
+	for i := 1; i <= 12; i++ {
+		manyFiles = append(manyFiles, fmt.Sprintf(" pkg/file%d.go | %d +", i, i))
+	}
+	manyFilesStat := strings.Join(manyFiles, "\n") + "\n 12 files changed, 78 insertions(+)\n"
+	tests := []struct {
+		name     string
+		config   Config
+		diffStat string
+		want     string
+	}{
+		{name: "disabled", config: Config{DiffStatMaxLines: 10}, diffStat: " a.go | 1 +\n 1 file changed, 1 insertion(+)\n"},
+		{name: "zero files", config: Config{ShowDiffStat: true, DiffStatMaxLines: 10}, diffStat: ""},
+		{name: "blank", config: Config{ShowDiffStat: true, DiffStatMaxLines: 10}, diffStat: " \n\n"},
+		{
+			name:     "one file",
+			config:   Config{ShowDiffStat: true, DiffStatMaxLines: 10},
+			diffStat: " a.go | 2 +-  \n 1 file changed, 1 insertion(+), 1 deletion(-)\n",
+			want:     "\n```\n a.go | 2 +-\n 1 file changed, 1 insertion(+), 1 deletion(-)\n```",
+		},
+		{
+			name:     "many files",
+			config:   Config{ShowDiffStat: true, DiffStatMaxLines: 10},
+			diffStat: manyFilesStat,
+			want:     "\n```\n" + strings.Join(manyFiles[:10], "\n") + "\n ... and 2 more\n 12 files changed, 78 insertions(+)\n```",
+		},
+		{
+			name:     "many files without a limit",
+			config:   Config{ShowDiffStat: true},
+			diffStat: manyFilesStat,
+			want:     "\n```\n" + strings.Join(manyFiles, "\n") + "\n 12 files changed, 78 insertions(+)\n```",
+		},
+		{
+			name:     "without summary",
+			config:   Config{ShowDiffStat: true, DiffStatMaxLines: 1},
+			diffStat: " a.go | 1 +\n b.go | 1 +",
+			want:     "\n```\n a.go | 1 +\n ... and 1 more\n```",
+		},
+		{
+			name:     "escaped",
+			config:   Config{ShowDiffStat: true, DiffStatMaxLines: 10},
+			diffStat: " {old => new}<1>.go | 1 +\n",
+			want:     "\n```\n {old =&gt; new}&lt;1&gt;.go | 1 +\n```",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := buildDiffStatBlock(test.config, test.diffStat); got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+// ssoPage is a page of SAML identities as the GitHub GraphQL API returns it, the identities given as login and nameId
+func ssoPage(hasNextPage bool, endCursor string, identities ...[2]string) map[string]any {
+	edges := []map[string]any{}
+	for _, identity := range identities {
+		edges = append(edges, map[string]any{"node": map[string]any{
+			"samlIdentity": map[string]any{"nameId": identity[1]},
+			"user":         map[string]any{"login": identity[0]},
+		}})
+	}
+	return map[string]any{"data": map[string]any{"organization": map[string]any{"samlIdentityProvider": map[string]any{
+		"externalIdentities": map[string]any{
+			"edges":    edges,
+			"pageInfo": map[string]any{"hasNextPage": hasNextPage, "endCursor": endCursor},
+		},
+	}}}}
+}
+
+// newFakeGithubGraphQLAPI answers the SSO queries sent to the returned GraphQL URL with the page the function returns
+// for the variables of the query
+func newFakeGithubGraphQLAPI(t *testing.T, page func(variables map[string]any) map[string]any) (graphQLURL string, httpClient *http.Client, requests *atomic.Int32) {
+	apiURL, httpClient, requests := newFakeGithubAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/graphql" || r.Header.Get("Authorization") != "Bearer ghp_test" {
+			t.Errorf("got request to %s with authorization %q", r.URL.Path, r.Header.Get("Authorization"))
+		}
+		var request GraphQLRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			t.Errorf("got invalid GraphQL request: %v", err)
+		}
+		_ = json.NewEncoder(w).Encode(page(request.Variables))
+	})
+	graphQLURL = apiURL + "/graphql"
+	return
+}
+
+func TestDoGithubGraphQLRequestSetsUserAgent(t *testing.T) {
+	tests := []struct {
+		name string
+		env  string
+		want string
+	}{
+		{name: "default", want: "actions-notify-slack/" + Version},
+		{name: "overridden", env: "acme-ci/2.0", want: "acme-ci/2.0"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var userAgent string
+			apiURL, httpClient, _ := newFakeGithubAPI(t, func(w http.ResponseWriter, r *http.Request) {
+				userAgent = r.Header.Get("User-Agent")
+				_, _ = w.Write([]byte(`{"data": {}}`))
+			})
+			t.Setenv("HTTP_USER_AGENT", test.env)
+			t.Setenv("GITHUB_API_URL", apiURL)
+			t.Setenv("GITHUB_GRAPHQL_URL", "")
+			config := buildConfig()
+
+			_, err := doGithubGraphQLRequest(context.Background(), config, httpClient, `{"query": "{ viewer { login } }"}`)
+			if err != nil {
+				t.Fatalf("got error %v", err)
+			}
+			if userAgent != test.want {
+				t.Errorf("got User-Agent %q, want %q", userAgent, test.want)
+			}
+		})
+	}
+}
+
+func TestGetAuthorEmailFromGithubOrganizationSSOPagination(t *testing.T) {
+	var cursors []any
+	graphQLURL, httpClient, _ := newFakeGithubGraphQLAPI(t, func(variables map[string]any) map[string]any {
+		cursors = append(cursors, variables["after"])
+		if variables["after"] == nil {
+			return ssoPage(true, "cursor-1", [2]string{"jdoe-other", "other@example.com"})
+		}
+		return ssoPage(false, "cursor-2", [2]string{"JDoe", "jane@example.com"})
+	})
+	config := Config{GithubAccessToken: "ghp_test", GithubGraphQLURL: graphQLURL}
+
+	authorEmail, login, err := getAuthorEmailFromGithubOrganizationSSO(context.Background(), config, httpClient, "acme", "jdoe")
+	if err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	if authorEmail != "jane@example.com" || login != "JDoe" {
+		t.Errorf("got email %q and login %q, want the identity of the second page", authorEmail, login)
+	}
+	if want := []any{nil, "cursor-1"}; !reflect.DeepEqual(cursors, want) {
+		t.Errorf("got cursors %v, want %v", cursors, want)
+	}
+}
+
+func TestGetAuthorEmailFromGithubOrganizationSSOStopsAfterMaxPages(t *testing.T) {
+	graphQLURL, httpClient, requests := newFakeGithubGraphQLAPI(t, func(variables map[string]any) map[string]any {
+		return ssoPage(true, fmt.Sprintf("cursor-%v", variables["after"]), [2]string{"someone-else", "other@example.com"})
+	})
+	_, _, err := getAuthorEmailFromGithubOrganizationSSO(context.Background(), Config{GithubAccessToken: "ghp_test", GithubGraphQLURL: graphQLURL}, httpClient, "acme", "jdoe")
+	if !errors.Is(err, ErrSSONotFound) {
+		t.Errorf("got error %v, want %v", err, ErrSSONotFound)
+	}
+	if got := requests.Load(); got != SSOMaxPages {
+		t.Errorf("got %d pages read, want %d", got, SSOMaxPages)
+	}
+}
+
+func TestGetAuthorEmailFromGithubSSOFallsThroughOrganizations(t *testing.T) {
+	tests := []struct {
+		name          string
+		organizations []string
+		wantEmail     string
+		wantErr       error
+		wantQueried   []any
+	}{
+		{name: "found in the first", organizations: []string{"acme-labs", "acme"}, wantEmail: "jane@labs.example.com", wantQueried: []any{"acme-labs"}},
+		{name: "found in the second", organizations: []string{"acme-old", "acme"}, wantEmail: "jane@example.com", wantQueried: []any{"acme-old", "acme"}},
+		{name: "found in none", organizations: []string{"acme-old", "acme-other"}, wantErr: ErrSSONotFound, wantQueried: []any{"acme-old", "acme-other"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var queried []any
+			graphQLURL, httpClient, _ := newFakeGithubGraphQLAPI(t, func(variables map[string]any) map[string]any {
+				queried = append(queried, variables["organization"])
+				switch variables["organization"] {
+				case "acme":
+					return ssoPage(false, "", [2]string{"jdoe", "jane@example.com"})
+				case "acme-labs":
+					return ssoPage(false, "", [2]string{"jdoe", "jane@labs.example.com"})
+				}
+				return ssoPage(false, "")
+			})
+			config := Config{GithubAccessToken: "ghp_test", GithubGraphQLURL: graphQLURL, GithubOrganizations: test.organizations}
+
+			authorEmail, _, err := getAuthorEmailFromGithubSSO(context.Background(), config, httpClient, "jdoe")
+			if !errors.Is(err, test.wantErr) || (test.wantErr == nil && err != nil) {
+				t.Fatalf("got error %v, want %v", err, test.wantErr)
+			}
+			if authorEmail != test.wantEmail {
+				t.Errorf("got email %q, want %q", authorEmail, test.wantEmail)
+			}
+			if !reflect.DeepEqual(queried, test.wantQueried) {
+				t.Errorf("got organizations queried %v, want %v", queried, test.wantQueried)
+			}
+		})
+	}
+}
+
+func TestCompleteCommitCanonicalLogin(t *testing.T) {
+	tests := []struct {
+		name         string
+		username     string
+		page         map[string]any
+		wantUsername string
+		wantEmail    string
+	}{
+		{name: "other case", username: "jdoe", page: ssoPage(false, "", [2]string{"JDoe", "jane@example.com"}), wantUsername: "JDoe", wantEmail: "jane@example.com"},
+		{name: "same case", username: "JDoe", page: ssoPage(false, "", [2]string{"JDoe", "jane@example.com"}), wantUsername: "JDoe", wantEmail: "jane@example.com"},
+		{name: "identity without user", username: "jdoe", page: ssoPage(false, "", [2]string{"", "jane@example.com"}), wantUsername: "jdoe", wantEmail: "jane@example.com"},
+		{name: "not found in SSO", username: "jdoe", page: ssoPage(false, ""), wantUsername: "jdoe", wantEmail: "jdoe@users.noreply.github.com"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			graphQLURL, httpClient, _ := newFakeGithubGraphQLAPI(t, func(variables map[string]any) map[string]any {
+				return test.page
+			})
+			config := Config{
+				GithubAccessToken:   "ghp_test",
+				GithubGraphQLURL:    graphQLURL,
+				GithubOrganizations: []string{"acme"},
+				BotAuthorRegexp:     regexp.MustCompile(DefaultBotAuthorPattern),
+			}
+			commit := Commit{sha: "abc123", authorUsername: test.username, authorEmail: "jdoe@users.noreply.github.com"}
+
+			commit = completeCommit(context.Background(), config, httpClient, commit)
+			if commit.authorUsername != test.wantUsername {
+				t.Errorf("got username %q, want %q", commit.authorUsername, test.wantUsername)
+			}
+			if commit.authorEmail != test.wantEmail {
+				t.Errorf("got email %q, want %q", commit.authorEmail, test.wantEmail)
+			}
+		})
+	}
+}
+
+func TestPickSuccessEmoji(t *testing.T) {
+	pool := strings.Split(DefaultSuccessEmojiPool, ",")
+	picked := map[string]bool{}
+	for i := 0; i < 20; i++ {
+		sha := fmt.Sprintf("%040x", i*7919)
+		emoji := pickSuccessEmoji(pool, sha)
+		if !slices.Contains(pool, emoji) {
+			t.Fatalf("got %q for %s, want an emoji of the pool", emoji, sha)
+		}
+		for run := 0; run < 3; run++ {
+			if again := pickSuccessEmoji(pool, sha); again != emoji {
+				t.Errorf("got %q then %q for %s, want the same emoji on every run", emoji, again, sha)
+			}
+		}
+		picked[emoji] = true
+	}
+	if len(pool) > 1 && len(picked) < 2 {
+		t.Errorf("got only %v for 20 commits, want the picks spread over the pool", picked)
+	}
+	if got := pickSuccessEmoji([]string{":tada:"}, "abc123"); got != ":tada:" {
+		t.Errorf("got %q, want the only emoji of the pool", got)
+	}
+}
+
+func TestBuildFooter(t *testing.T) {
+	full := Config{
+		ShowFooter:       true,
+		GithubServerURL:  "https://github.example.com",
+		GithubRepository: "owner/repo",
+		GithubRunID:      "1234",
+		GithubRunNumber:  "42",
+		GithubRunAttempt: "2",
+	}
+	tests := []struct {
+		name   string
+		config func(config Config) Config
+		want   string
+	}{
+		{name: "full", want: "\nowner/repo · <https://github.example.com/owner/repo/actions/runs/1234|run #42> · attempt 2"},
+		{
+			name:   "disabled",
+			config: func(config Config) Config { config.ShowFooter = false; return config },
+		},
+		{
+			name:   "first attempt",
+			config: func(config Config) Config { config.GithubRunAttempt = "1"; return config },
+			want:   "\nowner/repo · <https://github.example.com/owner/repo/actions/runs/1234|run #42>",
+		},
+		{
+			name:   "without run ID",
+			config: func(config Config) Config { config.GithubRunID = ""; return config },
+			want:   "\nowner/repo · run #42 · attempt 2",
+		},
+		{
+			name:   "without repository",
+			config: func(config Config) Config { config.GithubRepository = ""; return config },
+			want:   "\nrun #42 · attempt 2",
+		},
+		{
+			name:   "nothing known",
+			config: func(config Config) Config { return Config{ShowFooter: true} },
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := full
+			if test.config != nil {
+				config = test.config(config)
+			}
+			if got := buildFooter(config); got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestGetConclusionEmoji(t *testing.T) {
+	emojiMap := map[string]string{"failure": ":x:", "success": ":white_check_mark:", "cancelled": ":no_entry_sign:"}
+	failureConclusions := []string{"failure", "timed_out"}
+	tests := []struct {
+		conclusion string
+		emojiMap   map[string]string
+		severity   string
+		want       string
+	}{
+		{conclusion: "failure", want: ":warning:"},
+		{conclusion: "success", want: ":warning:"},
+		{conclusion: "failure", emojiMap: emojiMap, want: ":x:"},
+		{conclusion: "success", emojiMap: emojiMap, want: ":white_check_mark:"},
+		{conclusion: "cancelled", emojiMap: emojiMap, want: ":no_entry_sign:"},
+		{conclusion: "timed_out", emojiMap: emojiMap, want: UnknownConclusionEmoji},
+		{conclusion: "skipped", emojiMap: emojiMap, want: UnknownConclusionEmoji},
+		{conclusion: "neutral", emojiMap: emojiMap, want: UnknownConclusionEmoji},
+		{conclusion: "action_required", emojiMap: emojiMap, want: UnknownConclusionEmoji},
+		{conclusion: "", emojiMap: emojiMap, want: UnknownConclusionEmoji},
+		{conclusion: "failure", emojiMap: emojiMap, severity: SeverityCritical, want: SeverityThemes[SeverityCritical].Emoji},
+		{conclusion: "timed_out", severity: SeverityInfo, want: SeverityThemes[SeverityInfo].Emoji},
+		{conclusion: "success", emojiMap: emojiMap, severity: SeverityCritical, want: ":white_check_mark:"},
+	}
+	for _, test := range tests {
+		t.Run(test.conclusion+" "+test.severity, func(t *testing.T) {
+			config := Config{ConclusionEmojiMap: test.emojiMap, Severity: test.severity, FailureConclusions: failureConclusions}
+			if got := getConclusionEmoji(config, CommitStatus{Conclusion: test.conclusion}, ":warning:"); got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestBuildCompareClause(t *testing.T) {
+	config := Config{GithubServerURL: DefaultGithubServerURL, GithubRepository: "owner/repo", LastGoodSHA: "aaa111"}
+	tests := []struct {
+		name   string
+		config func(config Config) Config
+		sha    string
+		want   string
+	}{
+		{name: "since the last green", sha: "bbb222", want: " (<https://github.com/owner/repo/compare/aaa111...bbb222|view changes since last green>)"},
+		{name: "missing base sha", config: func(config Config) Config { config.LastGoodSHA = ""; return config }, sha: "bbb222"},
+		{name: "missing head sha", sha: ""},
+		{name: "missing repository", config: func(config Config) Config { config.GithubRepository = ""; return config }, sha: "bbb222"},
+		{name: "same commit", sha: "aaa111"},
+		{
+			name:   "enterprise server",
+			config: func(config Config) Config { config.GithubServerURL = "https://github.example.com"; return config },
+			sha:    "bbb222",
+			want:   " (<https://github.example.com/owner/repo/compare/aaa111...bbb222|view changes since last green>)",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := config
+			if test.config != nil {
+				config = test.config(config)
+			}
+			if got := buildCompareClause(config, Commit{sha: test.sha}); got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestBuildPullRequestClause(t *testing.T) {
+	tests := []struct {
+		name        string
+		pullRequest PullRequest
+		want        string
+	}{
+		{name: "none"},
+		{name: "url without number", pullRequest: PullRequest{url: "https://github.com/owner/repo/pull/12"}},
+		{name: "number without url", pullRequest: PullRequest{number: "12"}},
+		{name: "without title", pullRequest: PullRequest{number: "12", url: "https://github.com/owner/repo/pull/12"}, want: " (PR <https://github.com/owner/repo/pull/12|#12>)"},
+		{
+			name:        "with title",
+			pullRequest: PullRequest{number: "12", url: "https://github.com/owner/repo/pull/12", title: "Use <b> & <i>"},
+			want:        " (PR <https://github.com/owner/repo/pull/12|#12: Use &lt;b&gt; &amp; &lt;i&gt;>)",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := buildPullRequestClause(test.pullRequest); got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestGetCommitLink(t *testing.T) {
+	tests := []struct {
+		name   string
+		commit Commit
+		want   string
+	}{
+		{name: "with url", commit: Commit{url: "https://github.com/owner/repo/commit/abc123", commitMessage: "Fix the build\n\nBody"}, want: "<https://github.com/owner/repo/commit/abc123|\"_Fix the build_\">"},
+		{name: "without url", commit: Commit{commitMessage: "Fix the build"}, want: "\"_Fix the build_\""},
+		{name: "escaped", commit: Commit{url: "https://x.io/c/1", commitMessage: "Use <b> & <i>"}, want: "<https://x.io/c/1|\"_Use &lt;b&gt; &amp; &lt;i&gt;_\">"},
+		{name: "title set", commit: Commit{url: "https://x.io/c/1", commitMessage: "feat: add tokens", title: "add tokens"}, want: "<https://x.io/c/1|\"_add tokens_\">"},
+		{name: "empty message", commit: Commit{url: "https://x.io/c/1"}, want: "<https://x.io/c/1|\"__\">"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.commit.getCommitLink(); got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestCompleteCommitURL(t *testing.T) {
+	tests := []struct {
+		name   string
+		config Config
+		commit Commit
+		want   string
+	}{
+		{
+			name:   "github.com",
+			config: Config{GithubServerURL: DefaultGithubServerURL, GithubRepository: "owner/repo"},
+			commit: Commit{sha: "abc123"},
+			want:   "https://github.com/owner/repo/commit/abc123",
+		},
+		{
+			name:   "enterprise server",
+			config: Config{GithubServerURL: "https://github.example.com", GithubRepository: "owner/repo"},
+			commit: Commit{sha: "abc123"},
+			want:   "https://github.example.com/owner/repo/commit/abc123",
+		},
+		{
+			name:   "given url kept",
+			config: Config{GithubServerURL: "https://github.example.com", GithubRepository: "owner/repo"},
+			commit: Commit{sha: "abc123", url: "https://ci.example.com/commits/abc123"},
+			want:   "https://ci.example.com/commits/abc123",
+		},
+		{name: "without sha", config: Config{GithubServerURL: DefaultGithubServerURL, GithubRepository: "owner/repo"}},
+		{name: "without repository", config: Config{GithubServerURL: DefaultGithubServerURL}, commit: Commit{sha: "abc123"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.config.BotAuthorRegexp = regexp.MustCompile(DefaultBotAuthorPattern)
+			if got := completeCommit(context.Background(), test.config, http.DefaultClient, test.commit).url; got != test.want {
+				t.Errorf("got url %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestBuildConfigGithubServerURL(t *testing.T) {
+	tests := []struct {
+		env  string
+		want string
+	}{
+		{env: "", want: DefaultGithubServerURL},
+		{env: "https://github.example.com", want: "https://github.example.com"},
+		{env: "https://github.example.com/", want: "https://github.example.com"},
+	}
+	for _, test := range tests {
+		t.Run(test.env, func(t *testing.T) {
+			t.Setenv("GITHUB_SERVER_URL", test.env)
+			if got := buildConfig().GithubServerURL; got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestCommitStatusDisplayName(t *testing.T) {
+	tests := []struct {
+		name   string
+		status CommitStatus
+		want   string
+	}{
+		{name: "job and step", status: CommitStatus{Name: "ci", JobName: "build", StepName: "test"}, want: "job \"build\" / step \"test\""},
+		{name: "job only", status: CommitStatus{Name: "ci", JobName: "build"}, want: "ci"},
+		{name: "step only", status: CommitStatus{Name: "ci", StepName: "test"}, want: "ci"},
+		{name: "name only", status: CommitStatus{Name: "ci"}, want: "ci"},
+		{name: "job and step without name", status: CommitStatus{JobName: "build (ubuntu, 1.21)", StepName: "test"}, want: "job \"build (ubuntu, 1.21)\" / step \"test\""},
+		{name: "nothing", want: ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.status.DisplayName(); got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestBuildRunnerClause(t *testing.T) {
+	tests := []struct {
+		name   string
+		config Config
+		want   string
+	}{
+		{name: "outside github actions"},
+		{name: "os and name", config: Config{RunnerOS: "Linux", RunnerName: "GitHub Actions 2"}, want: " on runner Linux (GitHub Actions 2)"},
+		{name: "os only", config: Config{RunnerOS: "macOS"}, want: " on runner macOS"},
+		{name: "name only", config: Config{RunnerName: "self-hosted-1"}, want: " on runner self-hosted-1"},
+		{name: "escaped", config: Config{RunnerOS: "Linux", RunnerName: "<arm> & co"}, want: " on runner Linux (&lt;arm&gt; &amp; co)"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := buildRunnerClause(test.config); got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestBuildConfigGithubAPIURL(t *testing.T) {
+	tests := []struct {
+		name           string
+		apiURL         string
+		graphQLURL     string
+		wantAPIURL     string
+		wantGraphQLURL string
+	}{
+		{name: "github.com", wantAPIURL: DefaultGithubAPIURL, wantGraphQLURL: "https://api.github.com/graphql"},
+		{name: "enterprise server", apiURL: "https://github.example.com/api/v3/", wantAPIURL: "https://github.example.com/api/v3", wantGraphQLURL: "https://github.example.com/api/graphql"},
+		{name: "enterprise cloud with data residency", apiURL: "https://api.acme.ghe.com", wantAPIURL: "https://api.acme.ghe.com", wantGraphQLURL: "https://api.acme.ghe.com/graphql"},
+		{name: "graphql url given", apiURL: "https://github.example.com/api/v3", graphQLURL: "https://graphql.example.com/", wantAPIURL: "https://github.example.com/api/v3", wantGraphQLURL: "https://graphql.example.com"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Setenv("GITHUB_API_URL", test.apiURL)
+			t.Setenv("GITHUB_GRAPHQL_URL", test.graphQLURL)
+			config := buildConfig()
+			if config.GithubAPIURL != test.wantAPIURL || config.GithubGraphQLURL != test.wantGraphQLURL {
+				t.Errorf("got API URL %q and GraphQL URL %q, want %q and %q", config.GithubAPIURL, config.GithubGraphQLURL, test.wantAPIURL, test.wantGraphQLURL)
+			}
+		})
+	}
+}
+
+func TestBuildConfigMessageMaxLength(t *testing.T) {
+	tests := []struct {
+		env  string
+		want int
+	}{
+		{env: "", want: DefaultMessageMaxLength},
+		{env: "0", want: 0},
+		{env: "200", want: 200},
+	}
+	for _, test := range tests {
+		t.Run(test.env, func(t *testing.T) {
+			t.Setenv("MESSAGE_MAX_LENGTH", test.env)
+			if got := buildConfig().MessageMaxLength; got != test.want {
+				t.Errorf("got %d, want %d", got, test.want)
+			}
+		})
+	}
+	if message := strings.Repeat("x", 5000); truncateMessage(message, 0) != message {
+		t.Error("got a message cut with MESSAGE_MAX_LENGTH=0, want no limit")
+	}
+}
+
+func TestSendMessageToUser(t *testing.T) {
+	tests := []struct {
+		name        string
+		email       string
+		lookup      map[string]any
+		wantErr     error
+		wantLookups int
+		wantPosts   []string
+	}{
+		{
+			name:        "found",
+			email:       "jane@example.com",
+			lookup:      map[string]any{"ok": true, "user": map[string]any{"id": "U0JANE", "name": "jane"}},
+			wantLookups: 1,
+			wantPosts:   []string{"U0JANE"},
+		},
+		{name: "not an email", email: "jane", wantLookups: 0},
+		{name: "not found", email: "ghost@example.com", lookup: map[string]any{"ok": false, "error": "users_not_found"}, wantLookups: 1},
+		{name: "revoked token", email: "jane@example.com", lookup: map[string]any{"ok": false, "error": "token_revoked"}, wantErr: ErrSlackAuth, wantLookups: 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			api := &fakeSlackAPI{responses: map[string][]map[string]any{
+				"users.lookupByEmail": {test.lookup},
+				"chat.postMessage":    {{"ok": true, "channel": "D0JANE", "ts": "1700000000.000100"}},
+			}}
+
+			respChannel, respTimestamp, err := sendMessageToUser(context.Background(), Config{}, newFakeSlackClient(t, api), test.email, "build failed")
+			if test.wantPosts == nil {
+				if err == nil || (test.wantErr != nil && !errors.Is(err, test.wantErr)) {
+					t.Errorf("got error %v, want %v", err, test.wantErr)
+				}
+			} else if err != nil {
+				t.Fatalf("got error %v", err)
+			} else if respChannel != "D0JANE" || respTimestamp != "1700000000.000100" {
+				t.Errorf("got channel %q and timestamp %q", respChannel, respTimestamp)
+			}
+			if got := api.callCount("users.lookupByEmail"); got != test.wantLookups {
+				t.Errorf("got %d lookups, want %d", got, test.wantLookups)
+			}
+			if got := api.formValues("chat.postMessage", "channel"); !reflect.DeepEqual(got, test.wantPosts) {
+				t.Errorf("got posts to %v, want %v", got, test.wantPosts)
+			}
+		})
+	}
+}
+
+func TestSendPreviewToAuthor(t *testing.T) {
+	jane := Author{username: "jdoe", slackUser: &slack.User{ID: "U0JANE"}}
+	tests := []struct {
+		name      string
+		authors   []Author
+		response  map[string]any
+		wantPosts []string
+		wantLog   string
+	}{
+		{name: "first author", authors: []Author{jane, {username: "jsmith", slackUser: &slack.User{ID: "U0JOHN"}}}, wantPosts: []string{"U0JANE"}},
+		{name: "no authors", wantLog: "commit author not found in slack"},
+		{name: "author not in slack", authors: []Author{{username: "psmith"}, jane}, wantLog: "commit author not found in slack"},
+		{name: "author with a handle only", authors: []Author{{username: "jdoe", slackUser: &slack.User{Name: "jane"}}}, wantLog: "commit author not found in slack"},
+		{
+			name:      "post error is only logged",
+			authors:   []Author{jane},
+			response:  map[string]any{"ok": false, "error": "cannot_dm_bot"},
+			wantPosts: []string{"U0JANE"},
+			wantLog:   "got error sending preview to commit author",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			response := map[string]any{"ok": true, "channel": "D0JANE", "ts": "1700000000.000100"}
+			if test.response != nil {
+				response = test.response
+			}
+			api := &fakeSlackAPI{responses: map[string][]map[string]any{"chat.postMessage": {response}}}
+			logs := captureLogs(t)
+
+			sendPreviewToAuthor(context.Background(), Config{}, newFakeSlackClient(t, api), test.authors, "#ci", "build failed")
+			if got := api.formValues("chat.postMessage", "channel"); !reflect.DeepEqual(got, test.wantPosts) {
+				t.Errorf("got posts to %v, want %v", got, test.wantPosts)
+			}
+			if test.wantPosts != nil {
+				want := ":eyes: Preview of the message about to be posted to #ci:\nbuild failed"
+				if texts := api.formValues("chat.postMessage", "text"); texts[0] != want {
+					t.Errorf("got text %q, want %q", texts[0], want)
+				}
+			}
+			if !strings.Contains(logs.String(), test.wantLog) {
+				t.Errorf("got logs %q, want them to contain %q", logs.String(), test.wantLog)
+			}
+		})
+	}
+}
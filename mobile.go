@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// CompactTitleMaxLength is how many characters of the commit title COMPACT_MOBILE keeps, about what fits a phone
+// screen next to the rest of the line
+const CompactTitleMaxLength = 40
+
+// buildCompactMobileMessage renders the failure on a single short line for COMPACT_MOBILE, with only the emoji, the
+// failed step linking to its run, the shortened commit title and the authors, pinged without their GitHub links
+func buildCompactMobileMessage(config Config, userResolver *SlackUserResolver, commit Commit, commitStatus CommitStatus) string {
+	var mentions []string
+	for _, author := range resolveAuthors(userResolver, commit) {
+		switch {
+		case author.slackUser != nil && author.slackUser.ID != "":
+			mentions = append(mentions, "<@"+author.slackUser.ID+">")
+		case author.username != "":
+			mentions = append(mentions, escapeMrkdwn(author.username))
+		default:
+			mentions = append(mentions, escapeMrkdwn(author.email))
+		}
+	}
+
+	title := commit.getCommitMessageTitle()
+	if utf8.RuneCountInString(title) > CompactTitleMaxLength {
+		title = string([]rune(title)[:CompactTitleMaxLength-1]) + "…"
+	}
+
+	return fmt.Sprintf("%s <%s|%s> · %s · %s",
+		getConclusionEmoji(config, commitStatus, ":warning:"),
+		commitStatus.Url,
+		commitStatus.DisplayName(),
+		escapeMrkdwn(title),
+		strings.Join(mentions, " "),
+	)
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBuildChannelMessageCompactMobileIsSingleLine(t *testing.T) {
+	config := Config{
+		CompactMobile:      true,
+		ShowFooter:         true,
+		ShowDiffStat:       true,
+		DiffStatMaxLines:   DefaultDiffStatMaxLines,
+		FailureMention:     "S0ONCALL",
+		OnUnresolvedUser:   OnUnresolvedUserAnnotate,
+		FailureConclusions: []string{"failure", "error"},
+		GithubServerURL:    DefaultGithubServerURL,
+		GithubRepository:   "owner/repo",
+		GithubRunID:        "42",
+		GithubRunNumber:    "7",
+	}
+	userResolver, _ := newFakeUserDirectory(t, config, map[string]string{"jane@example.com": "U0JANE"})
+	commit := Commit{
+		sha:            "abc123",
+		authorUsername: "jdoe",
+		authorEmail:    "jane@example.com",
+		commitMessage:  "Fix the login redirect when the session expired in the middle of a checkout\n\nLong body",
+		coAuthors:      []Author{{name: "Ghost", email: "ghost@example.com"}},
+	}
+	status := CommitStatus{Name: "build", Conclusion: "failure", Url: "https://ci.example.com/run/1"}
+	diffStat := " main.go | 2 +-\n 1 file changed, 1 insertion(+), 1 deletion(-)\n"
+
+	message, skip := buildChannelMessage(config, userResolver, commit, status, PullRequest{}, nil, nil, diffStat)
+	if skip {
+		t.Fatal("got message skipped")
+	}
+	if strings.Contains(message, "\n") {
+		t.Errorf("got a message on several lines: %q", message)
+	}
+	for _, want := range []string{":warning:", "<https://ci.example.com/run/1|build>", "Fix the login redirect", "<@U0JANE>", "<!subteam^S0ONCALL>", "(Slack user not found)"} {
+		if !strings.Contains(message, want) {
+			t.Errorf("got %q, want it to contain %q", message, want)
+		}
+	}
+	if strings.Contains(message, "github.com/jdoe") {
+		t.Errorf("got %q, want the authors pinged without their GitHub links", message)
+	}
+	if strings.Contains(message, "checkout") {
+		t.Errorf("got %q, want the commit title cut", message)
+	}
+
+	// Without COMPACT_MOBILE the same failure gets the footer and diff stat lines
+	config.CompactMobile = false
+	message, _ = buildChannelMessage(config, userResolver, commit, status, PullRequest{}, nil, nil, diffStat)
+	if !strings.Contains(message, "\nowner/repo · ") || !strings.Contains(message, "\n```\n") {
+		t.Errorf("got %q, want the footer and diff stat", message)
+	}
+}
+
+func TestBuildChannelMessageCompactMobilePrecedence(t *testing.T) {
+	config := Config{
+		CompactMobile:      true,
+		MessageFormat:      MessageFormatTable,
+		FailureConclusions: []string{"failure", "error"},
+		Templates:          map[string]string{"failure": "{status} broke"},
+	}
+	userResolver, _ := newFakeUserDirectory(t, config, nil)
+	status := CommitStatus{Name: "build", Conclusion: "failure"}
+	statuses := []CommitStatus{{Name: "build", Conclusion: "failure"}, {Name: "lint", Conclusion: "success"}}
+
+	message, _ := buildChannelMessage(config, userResolver, Commit{}, status, PullRequest{}, nil, statuses, "")
+	if !strings.Contains(message, "```") {
+		t.Errorf("got %q, want the table", message)
+	}
+	message, _ = buildChannelMessage(config, userResolver, Commit{}, status, PullRequest{}, nil, nil, "")
+	if message != "build broke" {
+		t.Errorf("got %q, want the template", message)
+	}
+}
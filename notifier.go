@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+const NotifierSlack = "slack"
+
+// Notifier delivers notifications to a chat backend
+type Notifier interface {
+	Notify(ctx context.Context, notification Notification) error
+}
+
+// Notification is what is sent about a status, independently of the backend. Each Notifier renders it as its backend
+// allows, e.g. the fields as an attachment in Slack. The text uses Slack mrkdwn, which other backends must translate,
+// e.g. with convertMrkdwnToPlainText.
+type Notification struct {
+	Text   string
+	Fields []NotificationField
+	// Status is the status the notification is about, used e.g. to color it
+	Status CommitStatus
+	// Commit is the commit the notification is about
+	Commit Commit
+	// Color overrides the color derived from the status, if set
+	Color string
+}
+
+// NotificationField is an extra detail of a notification, like "Service: payments"
+type NotificationField struct {
+	Title string
+	Value string
+	Short bool
+}
+
+// buildNotifier returns the Notifier of the backend selected by NOTIFIER
+func buildNotifier(config Config, httpClient *http.Client, slackClient *slack.Client, slackChannel string, messageRefs []MessageRef, slackOptions []slack.MsgOption, postAt time.Time, summary *RunSummary) (notifier Notifier, err error) {
+	switch config.Notifier {
+	case NotifierSlack:
+		notifier = &SlackNotifier{
+			config:      config,
+			client:      slackClient,
+			channel:     slackChannel,
+			messageRefs: messageRefs,
+			options:     slackOptions,
+			postAt:      postAt,
+			summary:     summary,
+		}
+	case NotifierWebhook:
+		notifier = &WebhookNotifier{
+			config:     config,
+			httpClient: httpClient,
+			url:        config.WebhookURL,
+		}
+	case NotifierWorkflow:
+		notifier = &WorkflowNotifier{
+			config:     config,
+			httpClient: httpClient,
+			url:        config.SlackWorkflowWebhookURL,
+		}
+	default:
+		err = fmt.Errorf("unknown notifier %s", config.Notifier)
+	}
+	return
+}
+
+// SlackNotifier posts notifications to a Slack channel, or updates the referenced messages if there are any
+type SlackNotifier struct {
+	config      Config
+	client      *slack.Client
+	channel     string
+	messageRefs []MessageRef
+	// options are extra Slack options like the metadata of the message
+	options []slack.MsgOption
+	// postAt is when the message is scheduled to be posted, it is posted right away if zero
+	postAt time.Time
+	// summary records the delivered messages
+	summary *RunSummary
+}
+
+func (n *SlackNotifier) Notify(ctx context.Context, notification Notification) error {
+	if len(n.messageRefs) > 0 {
+		updated, err := updateMessages(ctx, n.config, n.client, n.messageRefs, notification.Text)
+		for _, messageRef := range updated {
+			n.summary.addMessage(messageRef.Channel, messageRef.Ts)
+		}
+		return err
+	}
+
+	options := append([]slack.MsgOption{}, n.options...)
+	if attachment, ok := buildSlackAttachment(n.config, notification); ok {
+		options = append(options, slack.MsgOptionAttachments(attachment))
+	}
+	if !n.postAt.IsZero() {
+		return n.schedule(ctx, notification.Text, options)
+	}
+
+	threadTs := n.config.SlackThreadTs
+	respChannel, respTimestamp, err := sendMessageToChannel(ctx, n.config, n.client, n.channel, notification.Text, append(buildThreadOptions(n.config), options...)...)
+
+	// Better to deliver to a backup channel than to lose the notification. The thread only exists in the primary
+	// channel, so the fallback message goes to the root of the channel.
+	fallbackChannel := n.config.SlackFallbackChannel
+	if err != nil && fallbackChannel != "" && fallbackChannel != n.channel {
+		slog.Warn("got error posting message, trying the fallback channel", "channel", n.channel, "fallbackChannel", fallbackChannel)
+		text := fmt.Sprintf(":information_source: Posted here because posting to %s failed\n%s", n.channel, notification.Text)
+		threadTs = ""
+		respChannel, respTimestamp, err = sendMessageToChannel(ctx, n.config, n.client, fallbackChannel, text, options...)
+	}
+	if err == nil {
+		n.summary.addMessage(respChannel, respTimestamp)
+		n.emitMessageRef(respChannel, respTimestamp)
+		if n.config.VerifyDelivery {
+			n.verifyDelivery(ctx, respChannel, threadTs, respTimestamp)
+		}
+		if n.config.EmitPermalink {
+			n.emitPermalink(ctx, respChannel, respTimestamp)
+		}
+	}
+	return err
+}
+
+// emitMessageRef sets the channel and ts step outputs to the posted message, so a later run can reply to it, e.g.
+// with MODE=resolve
+func (n *SlackNotifier) emitMessageRef(channelID, ts string) {
+	err := writeActionOutput("channel", channelID)
+	if err == nil {
+		err = writeActionOutput("ts", ts)
+	}
+	if err != nil {
+		slog.Warn("got error writing message outputs", "error", err)
+	}
+}
+
+// emitPermalink sets the permalink step output to the link of the posted message, so other systems can link to it. A
+// failure only loses the output, the message was posted anyway.
+func (n *SlackNotifier) emitPermalink(ctx context.Context, channelID, ts string) {
+	permalink, err := n.client.GetPermalinkContext(ctx, &slack.PermalinkParameters{Channel: channelID, Ts: ts})
+	if err != nil {
+		slog.Warn("got error getting message permalink", "channel", channelID, "timestamp", ts, "error", err)
+		return
+	}
+	slog.Info("message permalink", "permalink", permalink)
+	err = writeActionOutput("permalink", permalink)
+	if err != nil {
+		slog.Warn("got error writing permalink output", "error", err)
+	}
+}
+
+// verifyDelivery reads the posted message back, only warning if it can't be found since it was accepted anyway
+func (n *SlackNotifier) verifyDelivery(ctx context.Context, channelID, threadTs, ts string) {
+	delivered, err := isMessageDelivered(ctx, n.client, channelID, threadTs, ts)
+	if err != nil {
+		slog.Warn("got error verifying message delivery", "channel", channelID, "timestamp", ts, "error", err)
+		return
+	}
+	if !delivered {
+		slog.Warn("posted message not found in the channel, it may have been filtered", "channel", channelID, "timestamp", ts)
+		return
+	}
+	slog.Debug("message delivery verified", "channel", channelID, "timestamp", ts)
+}
+
+// schedule has Slack post the message at postAt, e.g. at the end of quiet hours
+func (n *SlackNotifier) schedule(ctx context.Context, text string, options []slack.MsgOption) (err error) {
+	// chat.scheduleMessage only takes channel IDs
+	channelID, err := resolveChannelID(n.client, n.config.SlackTeamID, n.channel)
+	if err != nil {
+		return
+	}
+
+	options = append([]slack.MsgOption{
+		slack.MsgOptionText(text, false),
+		slack.MsgOptionDisableLinkUnfurl(),
+	}, append(buildThreadOptions(n.config), options...)...)
+	postAt := strconv.FormatInt(n.postAt.Unix(), 10)
+	var scheduledMessageID string
+	err = buildSlackRetryPolicy(n.config).retry(ctx, func(ctx context.Context) (err error) {
+		_, scheduledMessageID, err = n.client.ScheduleMessageContext(ctx, channelID, postAt, options...)
+		return classifySlackError(err)
+	})
+	if err != nil {
+		slog.Error("got error scheduling message to slack channel", "error", err)
+		return
+	}
+	slog.Info("message scheduled", "channel", channelID, "postAt", n.postAt, "scheduledMessageId", scheduledMessageID)
+	return
+}
@@ -0,0 +1,348 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeNotifier records the notifications instead of delivering them
+type fakeNotifier struct {
+	notifications []Notification
+	err           error
+}
+
+func (n *fakeNotifier) Notify(ctx context.Context, notification Notification) error {
+	n.notifications = append(n.notifications, notification)
+	return n.err
+}
+
+var _ Notifier = (*fakeNotifier)(nil)
+
+func TestBuildNotifier(t *testing.T) {
+	tests := []struct {
+		notifier string
+		want     Notifier
+		wantErr  bool
+	}{
+		{notifier: NotifierSlack, want: &SlackNotifier{}},
+		{notifier: NotifierWebhook, want: &WebhookNotifier{}},
+		{notifier: NotifierWorkflow, want: &WorkflowNotifier{}},
+		{notifier: "carrier-pigeon", wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.notifier, func(t *testing.T) {
+			notifier, err := buildNotifier(Config{Notifier: test.notifier}, http.DefaultClient, nil, "#ci", nil, nil, time.Time{}, &RunSummary{})
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("got notifier %T, want an error", notifier)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("got error %v", err)
+			}
+			if got, want := fmt.Sprintf("%T", notifier), fmt.Sprintf("%T", test.want); got != want {
+				t.Errorf("got %s, want %s", got, want)
+			}
+		})
+	}
+}
+
+func TestNotifyReceivesTheBuiltMessage(t *testing.T) {
+	config := Config{
+		Environment:        "production",
+		EnvThemeMap:        DefaultEnvThemes,
+		AttachmentFields:   []AttachmentFieldTemplate{{Title: "Run", Value: "{run_number}", Short: true}},
+		OnUnresolvedUser:   OnUnresolvedUserAnnotate,
+		FailureConclusions: []string{"failure", "error"},
+		GithubServerURL:    DefaultGithubServerURL,
+		GithubRepository:   "owner/repo",
+		GithubRunNumber:    "7",
+		MessageMaxLength:   DefaultMessageMaxLength,
+	}
+	userResolver, _ := newFakeUserDirectory(t, config, map[string]string{"jane@example.com": "U0JANE"})
+	commit := Commit{sha: "abc123", authorUsername: "jdoe", authorEmail: "jane@example.com", commitMessage: "Fix <b> & co"}
+	status := CommitStatus{Name: "build", Conclusion: "failure", Url: "https://ci.example.com/run/1"}
+
+	message, skip := buildChannelMessage(config, userResolver, commit, status, PullRequest{}, nil, nil, "")
+	if skip {
+		t.Fatal("got message skipped")
+	}
+	notifier := &fakeNotifier{}
+	err := Notifier(notifier).Notify(context.Background(), buildNotification(config, commit, status, message))
+	if err != nil {
+		t.Fatalf("got error %v", err)
+	}
+
+	if len(notifier.notifications) != 1 {
+		t.Fatalf("got %d notifications, want 1", len(notifier.notifications))
+	}
+	notification := notifier.notifications[0]
+	if want := DefaultEnvThemes["production"].Emoji + " "; !strings.HasPrefix(notification.Text, want) {
+		t.Errorf("got text %q, want it to start with the theme emoji %q", notification.Text, want)
+	}
+	for _, want := range []string{"<https://ci.example.com/run/1|build>", "Fix &lt;b&gt; &amp; co", "<@U0JANE>"} {
+		if !strings.Contains(notification.Text, want) {
+			t.Errorf("got text %q, want it to contain %q", notification.Text, want)
+		}
+	}
+	if notification.Color != DefaultEnvThemes["production"].Color {
+		t.Errorf("got color %q, want %q", notification.Color, DefaultEnvThemes["production"].Color)
+	}
+	wantFields := []NotificationField{{Title: "Run", Value: "7", Short: true}}
+	if !reflect.DeepEqual(notification.Fields, wantFields) {
+		t.Errorf("got fields %+v, want %+v", notification.Fields, wantFields)
+	}
+	if notification.Status != status || notification.Commit.sha != commit.sha {
+		t.Errorf("got status %+v and commit %s, want the notified ones", notification.Status, notification.Commit.sha)
+	}
+}
+
+func TestWebhookNotifierSendsPlainText(t *testing.T) {
+	var payload WebhookPayload
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if err := json.Unmarshal(body, &payload); err != nil {
+			t.Errorf("got invalid payload %s: %v", body, err)
+		}
+	}))
+	defer server.Close()
+
+	notifier := &WebhookNotifier{config: Config{}, httpClient: server.Client(), url: server.URL}
+	err := notifier.Notify(context.Background(), Notification{
+		Text:   ":x: The commit <https://github.com/o/r/commit/1|\"_fix &lt;b&gt;_\"> by <@U123> has failed",
+		Status: CommitStatus{Name: "build", Conclusion: "failure"},
+	})
+	if err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	want := ":x: The commit \"_fix <b>_\" (https://github.com/o/r/commit/1) by @U123 has failed"
+	if payload.Text != want {
+		t.Errorf("got text %q, want %q", payload.Text, want)
+	}
+	if payload.Conclusion != "failure" {
+		t.Errorf("got conclusion %q, want failure", payload.Conclusion)
+	}
+}
+
+func TestWorkflowNotifierSendsFlatVariables(t *testing.T) {
+	var payload map[string]any
+	var contentType string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contentType = r.Header.Get("Content-Type")
+		body, _ := io.ReadAll(r.Body)
+		if err := json.Unmarshal(body, &payload); err != nil {
+			t.Errorf("got invalid payload %s: %v", body, err)
+		}
+	}))
+	defer server.Close()
+
+	notifier := &WorkflowNotifier{
+		config:     Config{GithubRepository: "o/r", GithubRunID: "1234"},
+		httpClient: server.Client(),
+		url:        server.URL,
+	}
+	err := notifier.Notify(context.Background(), Notification{
+		Text:   ":x: The commit <https://github.com/o/r/commit/abc123|\"_Fix build_\"> by <@U0JANE> has failed",
+		Status: CommitStatus{Name: "build", Conclusion: "failure", Url: "https://ci.example.com/run/1"},
+		Commit: Commit{url: "https://github.com/o/r/commit/abc123", sha: "abc123", authorUsername: "jdoe", authorEmail: "jane@example.com", commitMessage: "Fix build\n\nDetails"},
+	})
+	if err != nil {
+		t.Fatalf("got error %v", err)
+	}
+
+	want := map[string]any{
+		"text":         ":x: The commit <https://github.com/o/r/commit/abc123|\"_Fix build_\"> by <@U0JANE> has failed",
+		"repository":   "o/r",
+		"commit_title": "Fix build",
+		"commit_url":   "https://github.com/o/r/commit/abc123",
+		"commit_sha":   "abc123",
+		"author":       "jdoe",
+		"author_email": "jane@example.com",
+		"status":       "build",
+		"conclusion":   "failure",
+		"status_url":   "https://ci.example.com/run/1",
+		"run_id":       "1234",
+	}
+	if !reflect.DeepEqual(payload, want) {
+		t.Errorf("got payload %v, want %v", payload, want)
+	}
+	if contentType != "application/json" {
+		t.Errorf("got content type %q, want application/json", contentType)
+	}
+}
+
+func TestWorkflowNotifierWithoutURL(t *testing.T) {
+	err := (&WorkflowNotifier{httpClient: http.DefaultClient}).Notify(context.Background(), Notification{Text: "build failed"})
+	if err == nil {
+		t.Error("got no error, want one without a webhook url")
+	}
+}
+
+func TestConvertMrkdwnToPlainText(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{name: "plain", text: "all good", want: "all good"},
+		{name: "link with label", text: "<https://x.io|job>", want: "job (https://x.io)"},
+		{name: "bare link", text: "<https://x.io>", want: "https://x.io"},
+		{name: "user mention", text: "cc <@U123>", want: "cc @U123"},
+		{name: "special mention", text: "<!here> look", want: "@here look"},
+		{name: "user group", text: "<!subteam^S0123>", want: "@S0123"},
+		{name: "channel", text: "<#C0123|ci>", want: "#ci"},
+		{name: "escaped", text: "A &lt; B &amp;&amp; C &gt; D", want: "A < B && C > D"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := convertMrkdwnToPlainText(test.text); got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestSignWebhookBody(t *testing.T) {
+	// The example of the GitHub webhook docs, whose X-Hub-Signature-256 is computed the same way
+	got := signWebhookBody("It's a Secret to Everybody", []byte("Hello, World!"))
+	want := "sha256=757107ea0eb2509fc211221cce984b8a37570b6d7586c22c46f4379c8b043e17"
+	if got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func TestPostWebhookSignsBody(t *testing.T) {
+	tests := []struct {
+		name   string
+		secret string
+		want   string
+	}{
+		{name: "with secret", secret: "It's a Secret to Everybody", want: "sha256=757107ea0eb2509fc211221cce984b8a37570b6d7586c22c46f4379c8b043e17"},
+		{name: "without secret", want: ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var body, signature string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				read, _ := io.ReadAll(r.Body)
+				body, signature = string(read), r.Header.Get(WebhookSignatureHeader)
+			}))
+			defer server.Close()
+
+			err := postWebhook(context.Background(), Config{WebhookSigningSecret: test.secret}, server.Client(), server.URL, []byte("Hello, World!"))
+			if err != nil {
+				t.Fatalf("got error %v", err)
+			}
+			if body != "Hello, World!" {
+				t.Errorf("got body %q, want the signed one", body)
+			}
+			if signature != test.want {
+				t.Errorf("got signature %q, want %q", signature, test.want)
+			}
+		})
+	}
+}
+
+func TestSlackNotifierFallbackChannelCountsAsNotified(t *testing.T) {
+	api := &fakeSlackAPI{handlers: map[string]func(r *http.Request) map[string]any{
+		"chat.postMessage": func(r *http.Request) map[string]any {
+			if r.Form.Get("channel") != "#ci-fallback" {
+				return map[string]any{"ok": false, "error": "is_archived"}
+			}
+			return map[string]any{"ok": true, "channel": "C0FALLBACK", "ts": "1700000000.000100"}
+		},
+	}}
+	outputPath := filepath.Join(t.TempDir(), "output")
+	t.Setenv("GITHUB_OUTPUT", outputPath)
+
+	summary := &RunSummary{}
+	notifier := &SlackNotifier{
+		config:  Config{SlackFallbackChannel: "#ci-fallback", SlackThreadTs: "1690000000.000100"},
+		client:  newFakeSlackClient(t, api),
+		channel: "#ci",
+		summary: summary,
+	}
+	err := notifier.Notify(context.Background(), Notification{Text: "build failed"})
+	if err != nil {
+		t.Fatalf("got error %v, want the fallback post to count as notified", err)
+	}
+
+	channels := api.formValues("chat.postMessage", "channel")
+	if !reflect.DeepEqual(channels, []string{"#ci", "#ci-fallback"}) {
+		t.Errorf("got posts to %v, want the primary then the fallback channel", channels)
+	}
+	texts := api.formValues("chat.postMessage", "text")
+	if want := ":information_source: Posted here because posting to #ci failed\nbuild failed"; len(texts) != 2 || texts[1] != want {
+		t.Errorf("got texts %q, want the fallback one to be %q", texts, want)
+	}
+	if threads := api.formValues("chat.postMessage", "thread_ts"); len(threads) != 2 || threads[1] != "" {
+		t.Errorf("got threads %q, want the fallback post at the root of the channel", threads)
+	}
+	wantMessages := []MessageRef{{Channel: "C0FALLBACK", Ts: "1700000000.000100"}}
+	if !reflect.DeepEqual(summary.Messages, wantMessages) {
+		t.Errorf("got messages %+v, want %+v", summary.Messages, wantMessages)
+	}
+	output, err := os.ReadFile(outputPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "channel=C0FALLBACK\nts=1700000000.000100\n"; string(output) != want {
+		t.Errorf("got outputs %q, want %q", output, want)
+	}
+}
+
+func TestSlackNotifierEmitPermalink(t *testing.T) {
+	tests := []struct {
+		name       string
+		response   map[string]any
+		wantOutput string
+		wantLog    string
+	}{
+		{
+			name:       "permalink found",
+			response:   map[string]any{"ok": true, "channel": "C0123456789", "permalink": "https://example.slack.com/archives/C0123456789/p1700000000000100"},
+			wantOutput: "permalink=https://example.slack.com/archives/C0123456789/p1700000000000100\n",
+		},
+		{
+			name:     "permalink error",
+			response: map[string]any{"ok": false, "error": "message_not_found"},
+			wantLog:  "got error getting message permalink",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			api := &fakeSlackAPI{responses: map[string][]map[string]any{"chat.getPermalink": {test.response}}}
+			outputPath := filepath.Join(t.TempDir(), "output")
+			t.Setenv("GITHUB_OUTPUT", outputPath)
+			logs := captureLogs(t)
+
+			notifier := &SlackNotifier{client: newFakeSlackClient(t, api), summary: &RunSummary{}}
+			notifier.emitPermalink(context.Background(), "C0123456789", "1700000000.000100")
+
+			if got := api.formValues("chat.getPermalink", "message_ts"); !reflect.DeepEqual(got, []string{"1700000000.000100"}) {
+				t.Errorf("got permalinks asked for %v, want the posted message", got)
+			}
+			output, err := os.ReadFile(outputPath)
+			if err != nil && !os.IsNotExist(err) {
+				t.Fatal(err)
+			}
+			if string(output) != test.wantOutput {
+				t.Errorf("got outputs %q, want %q", output, test.wantOutput)
+			}
+			if !strings.Contains(logs.String(), test.wantLog) {
+				t.Errorf("got logs %q, want them to contain %q", logs.String(), test.wantLog)
+			}
+		})
+	}
+}
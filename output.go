@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+)
+
+const OutputFormatJSON = "json"
+
+// RunSummary is what happened during a run, printed as JSON at the end with OUTPUT_FORMAT=json for tools wrapping
+// the action
+type RunSummary struct {
+	// Channels are the channels the notification was delivered to
+	Channels []string `json:"channels"`
+	// Messages are the posted or updated messages
+	Messages []MessageRef `json:"messages"`
+	// SSOResolved is whether the author email came from GitHub SSO instead of the commit metadata
+	SSOResolved bool `json:"ssoResolved"`
+	// SlackUserIDs are the Slack users found for the mentioned authors
+	SlackUserIDs []string `json:"slackUserIds"`
+	Errors       []string `json:"errors"`
+}
+
+func (s *RunSummary) addMessage(channel, ts string) {
+	s.Messages = append(s.Messages, MessageRef{Channel: channel, Ts: ts})
+	for _, summaryChannel := range s.Channels {
+		if summaryChannel == channel {
+			return
+		}
+	}
+	s.Channels = append(s.Channels, channel)
+}
+
+func (s *RunSummary) addError(err error) {
+	if err != nil {
+		s.Errors = append(s.Errors, err.Error())
+	}
+}
+
+// printSummary prints the summary as a single JSON line, if OUTPUT_FORMAT asks for it, and adds it to the job summary
+func printSummary(config Config, summary *RunSummary) {
+	if config.OutputFormat != OutputFormatJSON {
+		return
+	}
+	// Empty lists rather than nulls are easier on consumers
+	if summary.Channels == nil {
+		summary.Channels = []string{}
+	}
+	if summary.Messages == nil {
+		summary.Messages = []MessageRef{}
+	}
+	if summary.SlackUserIDs == nil {
+		summary.SlackUserIDs = []string{}
+	}
+	if summary.Errors == nil {
+		summary.Errors = []string{}
+	}
+
+	content, err := json.Marshal(summary)
+	if err != nil {
+		fmt.Printf("{\"errors\": [%q]}\n", err.Error())
+		return
+	}
+	fmt.Println(string(content))
+
+	err = writeStepSummary("```json\n" + string(content) + "\n```\n")
+	if err != nil {
+		slog.Warn("got error writing the job summary", "error", err)
+	}
+}
+
+// writeStepSummary appends the Markdown to the summary of the GitHub Actions job, shown on the page of the run. It
+// does nothing outside GitHub Actions.
+func writeStepSummary(markdown string) (err error) {
+	summaryPath := os.Getenv("GITHUB_STEP_SUMMARY")
+	if summaryPath == "" {
+		return
+	}
+	file, err := os.OpenFile(summaryPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return
+	}
+	_, err = file.WriteString(markdown)
+	closeErr := file.Close()
+	if err == nil {
+		err = closeErr
+	}
+	return
+}
+
+// writeActionOutput sets a step output of the GitHub Actions job, for later steps to use as
+// steps.<id>.outputs.<name>. It does nothing outside GitHub Actions.
+func writeActionOutput(name, value string) (err error) {
+	outputPath := os.Getenv("GITHUB_OUTPUT")
+	if outputPath == "" {
+		return
+	}
+	file, err := os.OpenFile(outputPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return
+	}
+	_, err = fmt.Fprintf(file, "%s=%s\n", name, value)
+	closeErr := file.Close()
+	if err == nil {
+		err = closeErr
+	}
+	return
+}
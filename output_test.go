@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// captureStdout returns what fn prints to stdout
+func captureStdout(t *testing.T, fn func()) string {
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = writer
+	defer func() { os.Stdout = stdout }()
+
+	fn()
+	err = writer.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	output, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(output)
+}
+
+func TestPrintSummary(t *testing.T) {
+	summaryPath := filepath.Join(t.TempDir(), "step_summary.md")
+	t.Setenv("GITHUB_STEP_SUMMARY", summaryPath)
+	err := os.WriteFile(summaryPath, []byte("# Tests\n"), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	summary := &RunSummary{SSOResolved: true, SlackUserIDs: []string{"U0JANE"}}
+	summary.addMessage("C0CI", "1700000000.000100")
+	summary.addMessage("C0CI", "1700000000.000200")
+	summary.addError(errors.New("posting the trend failed"))
+	output := captureStdout(t, func() { printSummary(Config{OutputFormat: OutputFormatJSON}, summary) })
+
+	var got map[string]any
+	if err := json.Unmarshal([]byte(output), &got); err != nil || !strings.HasSuffix(output, "}\n") || strings.Count(output, "\n") != 1 {
+		t.Fatalf("got output %q, want a single JSON line: %v", output, err)
+	}
+	want := map[string]any{
+		"channels": []any{"C0CI"},
+		"messages": []any{
+			map[string]any{"channel": "C0CI", "ts": "1700000000.000100"},
+			map[string]any{"channel": "C0CI", "ts": "1700000000.000200"},
+		},
+		"ssoResolved":  true,
+		"slackUserIds": []any{"U0JANE"},
+		"errors":       []any{"posting the trend failed"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got summary %v, want %v", got, want)
+	}
+
+	stepSummary, err := os.ReadFile(summaryPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "# Tests\n```json\n" + output + "```\n"; string(stepSummary) != want {
+		t.Errorf("got job summary %q, want %q", stepSummary, want)
+	}
+}
+
+func TestPrintSummaryEmptyLists(t *testing.T) {
+	t.Setenv("GITHUB_STEP_SUMMARY", "")
+	output := captureStdout(t, func() { printSummary(Config{OutputFormat: OutputFormatJSON}, &RunSummary{}) })
+	if want := `{"channels":[],"messages":[],"ssoResolved":false,"slackUserIds":[],"errors":[]}` + "\n"; output != want {
+		t.Errorf("got %q, want %q", output, want)
+	}
+
+	summaryPath := filepath.Join(t.TempDir(), "step_summary.md")
+	t.Setenv("GITHUB_STEP_SUMMARY", summaryPath)
+	output = captureStdout(t, func() { printSummary(Config{}, &RunSummary{}) })
+	if output != "" {
+		t.Errorf("got %q without OUTPUT_FORMAT, want nothing printed", output)
+	}
+	if _, err := os.Stat(summaryPath); !os.IsNotExist(err) {
+		t.Errorf("got job summary written without OUTPUT_FORMAT: %v", err)
+	}
+}
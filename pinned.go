@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+
+	"github.com/slack-go/slack"
+)
+
+const (
+	ModeSummary = "summary"
+
+	// SummaryHeaderFormat is the first line of the summary message of a repository, used to find it among the pins
+	SummaryHeaderFormat = "*CI status of %s*"
+)
+
+// summaryLineRegexp matches a status line of the summary message, capturing the status name
+var summaryLineRegexp = regexp.MustCompile("^• `([^`]+)`: ")
+
+// runSummaryMode keeps a single pinned message per repository with the latest conclusion of each status, posting and
+// pinning it on the first run and updating it afterwards, instead of posting a message per status
+func runSummaryMode(ctx context.Context, config Config, client *slack.Client, commit Commit, commitStatus CommitStatus) (err error) {
+	channelID, err := resolveChannelID(client, config.SlackTeamID, config.SlackChannelName)
+	if err != nil {
+		return
+	}
+
+	header := fmt.Sprintf(SummaryHeaderFormat, escapeMrkdwn(config.GithubRepository))
+	summaryMessage, err := findPinnedMessage(ctx, client, channelID, header)
+	if err != nil {
+		return
+	}
+
+	previousText := ""
+	if summaryMessage != nil {
+		previousText = summaryMessage.Text
+	}
+	text := buildSummaryText(header, previousText, commitStatus.Name, buildSummaryLine(config, commit, commitStatus))
+
+	if summaryMessage != nil {
+		err = updateMessage(ctx, config, client, MessageRef{Channel: channelID, Ts: summaryMessage.Timestamp}, text)
+		if err != nil {
+			return
+		}
+		slog.Info("summary message updated", "channel", channelID, "timestamp", summaryMessage.Timestamp)
+		return
+	}
+
+	respChannel, respTimestamp, err := sendMessageToChannel(ctx, config, client, channelID, text)
+	if err != nil {
+		return
+	}
+	err = client.AddPinContext(ctx, respChannel, slack.NewRefToMessage(respChannel, respTimestamp))
+	if err != nil {
+		logScopeError(err, "pins:write")
+		err = fmt.Errorf("pinning summary message: %w", err)
+		return
+	}
+	slog.Info("summary message posted and pinned", "channel", respChannel, "timestamp", respTimestamp)
+	return
+}
+
+// findPinnedMessage returns the pinned message of the channel starting with the header, or nil if there is none
+func findPinnedMessage(ctx context.Context, client *slack.Client, channelID, header string) (message *slack.Message, err error) {
+	items, _, err := client.ListPinsContext(ctx, channelID)
+	if err != nil {
+		logScopeError(err, "pins:read")
+		return
+	}
+	for _, item := range items {
+		if item.Message != nil && strings.HasPrefix(item.Message.Text, header) {
+			message = item.Message
+			return
+		}
+	}
+	return
+}
+
+// buildSummaryLine renders the latest conclusion of the status
+func buildSummaryLine(config Config, commit Commit, commitStatus CommitStatus) string {
+	defaultEmoji := ":large_yellow_circle:"
+	if commitStatus.Succeeded() {
+		defaultEmoji = ":large_green_circle:"
+	} else if commitStatus.Failed(config.FailureConclusions) {
+		defaultEmoji = ":red_circle:"
+	}
+	return fmt.Sprintf("• `%s`: %s <%s|%s> on %s%s",
+		commitStatus.Name,
+		getConclusionEmoji(config, commitStatus, defaultEmoji),
+		commitStatus.Url,
+		commitStatus.Conclusion,
+		commit.getCommitLink(),
+		buildTimingClause(config, commitStatus),
+	)
+}
+
+// buildSummaryText replaces the line of the status in the previous summary text, or adds it at the end. The lines of
+// the other statuses are kept as they were.
+func buildSummaryText(header, previousText, statusName, statusLine string) string {
+	lines := []string{header}
+	replaced := false
+	for _, line := range strings.Split(previousText, "\n") {
+		match := summaryLineRegexp.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+		if match[1] == statusName {
+			line = statusLine
+			replaced = true
+		}
+		lines = append(lines, line)
+	}
+	if !replaced {
+		lines = append(lines, statusLine)
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,49 @@
+package main
+
+import "testing"
+
+func TestBuildSummaryText(t *testing.T) {
+	header := "*Status of owner/repo*"
+	previousText := header + "\n" +
+		"• `build`: :red_circle: failure\n" +
+		"• `lint`: :large_green_circle: success"
+	tests := []struct {
+		name         string
+		previousText string
+		statusName   string
+		statusLine   string
+		want         string
+	}{
+		{
+			name:       "first status",
+			statusName: "build", statusLine: "• `build`: :large_green_circle: success",
+			want: header + "\n" +
+				"• `build`: :large_green_circle: success",
+		},
+		{
+			name: "replaces the line of the status in place", previousText: previousText,
+			statusName: "build", statusLine: "• `build`: :large_green_circle: success",
+			want: header + "\n" +
+				"• `build`: :large_green_circle: success\n" +
+				"• `lint`: :large_green_circle: success",
+		},
+		{
+			name: "adds a new status at the end", previousText: previousText,
+			statusName: "tests", statusLine: "• `tests`: :red_circle: failure",
+			want: previousText + "\n" +
+				"• `tests`: :red_circle: failure",
+		},
+		{
+			name: "takes the new header and drops other lines", previousText: "*Old header*\nsome note\n• `lint`: :red_circle: failure",
+			statusName: "lint", statusLine: "• `lint`: :large_green_circle: success",
+			want: header + "\n" +
+				"• `lint`: :large_green_circle: success",
+		},
+	}
+	for _, test := range tests {
+		got := buildSummaryText(header, test.previousText, test.statusName, test.statusLine)
+		if got != test.want {
+			t.Errorf("%s: got\n%s\nwant\n%s", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// QuietHours is a daily window, like 22:00-08:00, in which people should not be pinged. It may wrap around midnight.
+type QuietHours struct {
+	// Start and End are minutes since midnight, the window is empty if they are equal
+	Start int
+	End   int
+}
+
+// parseQuietHours parses a "HH:MM-HH:MM" window
+func parseQuietHours(value string) (quietHours QuietHours, err error) {
+	start, end, found := strings.Cut(value, "-")
+	if !found {
+		err = fmt.Errorf("quiet hours %q are not like HH:MM-HH:MM", value)
+		return
+	}
+	quietHours.Start, err = parseTimeOfDay(strings.TrimSpace(start))
+	if err != nil {
+		return
+	}
+	quietHours.End, err = parseTimeOfDay(strings.TrimSpace(end))
+	return
+}
+
+func parseTimeOfDay(value string) (minutes int, err error) {
+	timeOfDay, err := time.Parse("15:04", value)
+	if err != nil {
+		err = fmt.Errorf("%q is not a HH:MM time: %w", value, err)
+		return
+	}
+	minutes = timeOfDay.Hour()*60 + timeOfDay.Minute()
+	return
+}
+
+// contains reports whether the time, in the location it is given in, falls in the window
+func (q QuietHours) contains(t time.Time) bool {
+	minutes := t.Hour()*60 + t.Minute()
+	if q.Start <= q.End {
+		return q.Start <= minutes && minutes < q.End
+	}
+	return minutes >= q.Start || minutes < q.End
+}
+
+// endAfter returns the first end of the window after the time
+func (q QuietHours) endAfter(t time.Time) time.Time {
+	end := time.Date(t.Year(), t.Month(), t.Day(), q.End/60, q.End%60, 0, 0, t.Location())
+	if !end.After(t) {
+		end = time.Date(t.Year(), t.Month(), t.Day()+1, q.End/60, q.End%60, 0, 0, t.Location())
+	}
+	return end
+}
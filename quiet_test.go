@@ -0,0 +1,76 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseQuietHours(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    QuietHours
+		wantErr bool
+	}{
+		{value: "22:00-08:00", want: QuietHours{Start: 22 * 60, End: 8 * 60}},
+		{value: "12:30 - 13:45", want: QuietHours{Start: 12*60 + 30, End: 13*60 + 45}},
+		{value: "22:00", wantErr: true},
+		{value: "25:00-08:00", wantErr: true},
+		{value: "22:00-8am", wantErr: true},
+	}
+	for _, test := range tests {
+		got, err := parseQuietHours(test.value)
+		if (err != nil) != test.wantErr {
+			t.Errorf("%q: got error %v, want error %t", test.value, err, test.wantErr)
+			continue
+		}
+		if !test.wantErr && got != test.want {
+			t.Errorf("%q: got %+v, want %+v", test.value, got, test.want)
+		}
+	}
+}
+
+func TestQuietHoursContains(t *testing.T) {
+	overnight := QuietHours{Start: 22 * 60, End: 8 * 60}
+	daytime := QuietHours{Start: 12 * 60, End: 14 * 60}
+	tests := []struct {
+		name       string
+		quietHours QuietHours
+		hour       int
+		minute     int
+		want       bool
+	}{
+		{name: "overnight before start", quietHours: overnight, hour: 21, minute: 59, want: false},
+		{name: "overnight at start", quietHours: overnight, hour: 22, minute: 0, want: true},
+		{name: "overnight after midnight", quietHours: overnight, hour: 3, minute: 0, want: true},
+		{name: "overnight at end", quietHours: overnight, hour: 8, minute: 0, want: false},
+		{name: "daytime inside", quietHours: daytime, hour: 13, minute: 30, want: true},
+		{name: "daytime at end", quietHours: daytime, hour: 14, minute: 0, want: false},
+		{name: "daytime outside", quietHours: daytime, hour: 23, minute: 0, want: false},
+		{name: "empty window", quietHours: QuietHours{}, hour: 0, minute: 0, want: false},
+	}
+	for _, test := range tests {
+		now := time.Date(2024, 5, 1, test.hour, test.minute, 0, 0, time.UTC)
+		if got := test.quietHours.contains(now); got != test.want {
+			t.Errorf("%s: got %t, want %t", test.name, got, test.want)
+		}
+	}
+}
+
+func TestQuietHoursEndAfter(t *testing.T) {
+	overnight := QuietHours{Start: 22 * 60, End: 8 * 60}
+	tests := []struct {
+		name string
+		now  time.Time
+		want time.Time
+	}{
+		{name: "before midnight ends the next day", now: time.Date(2024, 5, 1, 23, 0, 0, 0, time.UTC), want: time.Date(2024, 5, 2, 8, 0, 0, 0, time.UTC)},
+		{name: "after midnight ends the same day", now: time.Date(2024, 5, 2, 3, 0, 0, 0, time.UTC), want: time.Date(2024, 5, 2, 8, 0, 0, 0, time.UTC)},
+		{name: "at the end moves to the next day", now: time.Date(2024, 5, 2, 8, 0, 0, 0, time.UTC), want: time.Date(2024, 5, 3, 8, 0, 0, 0, time.UTC)},
+		{name: "end of month", now: time.Date(2024, 5, 31, 23, 0, 0, 0, time.UTC), want: time.Date(2024, 6, 1, 8, 0, 0, 0, time.UTC)},
+	}
+	for _, test := range tests {
+		if got := overnight.endAfter(test.now); !got.Equal(test.want) {
+			t.Errorf("%s: got %s, want %s", test.name, got, test.want)
+		}
+	}
+}
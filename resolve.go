@@ -0,0 +1,29 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/slack-go/slack"
+)
+
+const ModeResolve = "resolve"
+
+// runResolveMode closes the loop on a failure, replying in the thread of its message (SLACK_THREAD_TS, e.g. the ts
+// output of the run that posted it) that the commit fixed it
+func runResolveMode(ctx context.Context, config Config, client *slack.Client, commit Commit, summary *RunSummary) (err error) {
+	if config.SlackThreadTs == "" {
+		err = fmt.Errorf("%w: SLACK_THREAD_TS is empty, there is no failure message to reply to", ErrNoConfig)
+		return
+	}
+
+	text := fmt.Sprintf(":white_check_mark: Fixed in %s", commit.getCommitLink())
+	respChannel, respTimestamp, err := sendMessageToChannel(ctx, config, client, config.SlackChannelName, text, buildThreadOptions(config)...)
+	if err != nil {
+		return
+	}
+	summary.addMessage(respChannel, respTimestamp)
+	slog.Info("resolution posted in thread", "channel", respChannel, "threadTs", config.SlackThreadTs)
+	return
+}
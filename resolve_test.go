@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestRunResolveMode(t *testing.T) {
+	api := &fakeSlackAPI{handlers: map[string]func(r *http.Request) map[string]any{
+		"chat.postMessage": func(r *http.Request) map[string]any {
+			return map[string]any{"ok": true, "channel": "C0123456789", "ts": "1700000000.000200"}
+		},
+	}}
+	config := Config{SlackChannelName: "C0123456789", SlackThreadTs: "1700000000.000100", PostTarget: PostTargetRoot}
+	commit := Commit{url: "https://github.com/o/r/commit/abc123", commitMessage: "Fix <b> tags\n\nDetails"}
+	summary := &RunSummary{}
+
+	err := runResolveMode(context.Background(), config, newFakeSlackClient(t, api), commit, summary)
+	if err != nil {
+		t.Fatalf("got error %v", err)
+	}
+
+	want := ":white_check_mark: Fixed in <https://github.com/o/r/commit/abc123|\"_Fix &lt;b&gt; tags_\">"
+	if texts := api.formValues("chat.postMessage", "text"); !reflect.DeepEqual(texts, []string{want}) {
+		t.Errorf("got texts %q, want %q", texts, want)
+	}
+	if threads := api.formValues("chat.postMessage", "thread_ts"); !reflect.DeepEqual(threads, []string{"1700000000.000100"}) {
+		t.Errorf("got threads %q, want the reply in the failure thread", threads)
+	}
+	if broadcasts := api.formValues("chat.postMessage", "reply_broadcast"); !reflect.DeepEqual(broadcasts, []string{"true"}) {
+		t.Errorf("got broadcasts %q, want POST_TARGET=root to broadcast the reply", broadcasts)
+	}
+	wantMessages := []MessageRef{{Channel: "C0123456789", Ts: "1700000000.000200"}}
+	if !reflect.DeepEqual(summary.Messages, wantMessages) {
+		t.Errorf("got messages %+v, want %+v", summary.Messages, wantMessages)
+	}
+}
+
+func TestRunResolveModeWithoutThread(t *testing.T) {
+	api := &fakeSlackAPI{}
+	err := runResolveMode(context.Background(), Config{SlackChannelName: "#ci"}, newFakeSlackClient(t, api), Commit{}, &RunSummary{})
+	if !errors.Is(err, ErrNoConfig) {
+		t.Errorf("got error %v, want %v", err, ErrNoConfig)
+	}
+	if got := api.callCount("chat.postMessage"); got != 0 {
+		t.Errorf("got %d posts, want none without a thread to reply to", got)
+	}
+}
+
+func TestRunResolveModeReturnsPostError(t *testing.T) {
+	api := &fakeSlackAPI{responses: map[string][]map[string]any{
+		"chat.postMessage": {{"ok": false, "error": "thread_not_found"}},
+	}}
+	summary := &RunSummary{}
+	config := Config{SlackChannelName: "C0123456789", SlackThreadTs: "1700000000.000100"}
+
+	err := runResolveMode(context.Background(), config, newFakeSlackClient(t, api), Commit{commitMessage: "Fix"}, summary)
+	if !isSlackError(err, "thread_not_found") {
+		t.Errorf("got error %v, want thread_not_found", err)
+	}
+	if len(summary.Messages) != 0 {
+		t.Errorf("got messages %+v, want none", summary.Messages)
+	}
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+const (
+	RetryBaseDelay = time.Second
+
+	// RetryMaxDelay caps the exponential backoff between two attempts
+	RetryMaxDelay = 10 * time.Second
+
+	// RetryMaxElapsed bounds the total time spent retrying a call, so a flaky API can't hold the job for long. It
+	// leaves room for one GitHub secondary rate limit wait.
+	RetryMaxElapsed = 2 * time.Minute
+
+	// GithubSecondaryRateLimitDelay is how long GitHub asks to wait after a secondary rate limit without Retry-After
+	GithubSecondaryRateLimitDelay = time.Minute
+)
+
+// permanentError marks an error that retrying cannot fix, e.g. a bad request
+type permanentError struct {
+	err error
+}
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+func permanent(err error) error {
+	return permanentError{err: err}
+}
+
+// retryAfterError marks an error whose response told us how long to wait before retrying, e.g. a rate limit
+type retryAfterError struct {
+	err   error
+	delay time.Duration
+}
+
+func (e retryAfterError) Error() string { return e.err.Error() }
+func (e retryAfterError) Unwrap() error { return e.err }
+
+func retryAfter(err error, delay time.Duration) error {
+	return retryAfterError{err: err, delay: delay}
+}
+
+// retryWithBackoff calls fn until it succeeds, returns a permanent error, maxAttempts are made, or retrying would
+// exceed maxElapsed since the first attempt. The delay between attempts starts at baseDelay and doubles each time, up
+// to RetryMaxDelay, unless the error asks for a longer one.
+func retryWithBackoff(ctx context.Context, maxAttempts int, baseDelay, maxElapsed time.Duration, fn func() error) (err error) {
+	start := time.Now()
+	delay := baseDelay
+	for attempt := 1; ; attempt++ {
+		err = fn()
+		if err == nil {
+			return
+		}
+
+		var permanentErr permanentError
+		if errors.As(err, &permanentErr) {
+			err = permanentErr.err
+			return
+		}
+		if attempt >= maxAttempts {
+			return
+		}
+
+		wait := delay
+		var retryAfterErr retryAfterError
+		if errors.As(err, &retryAfterErr) && retryAfterErr.delay > wait {
+			wait = retryAfterErr.delay
+		}
+		if time.Since(start)+wait > maxElapsed {
+			slog.Warn("not retrying, it would exceed the max elapsed time", "maxElapsed", maxElapsed)
+			return
+		}
+
+		slog.Warn("got error, retrying", "attempt", attempt, "maxAttempts", maxAttempts, "wait", wait, "error", err)
+		select {
+		case <-ctx.Done():
+			err = fmt.Errorf("gave up retrying: %w", ctx.Err())
+			return
+		case <-time.After(wait):
+		}
+
+		delay *= 2
+		if delay > RetryMaxDelay {
+			delay = RetryMaxDelay
+		}
+	}
+}
+
+// RetryPolicy is how many attempts a call to an external service gets, and how long each may take, built from the
+// settings of the service
+type RetryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxElapsed  time.Duration
+	// AttemptTimeout is the deadline of each attempt, so a slow one is retried instead of eating the whole retry
+	// window. Zero leaves only the HTTP client timeout.
+	AttemptTimeout time.Duration
+}
+
+func buildRetryPolicy(maxRetries int, attemptTimeout time.Duration) RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:    maxRetries + 1,
+		BaseDelay:      RetryBaseDelay,
+		MaxElapsed:     RetryMaxElapsed,
+		AttemptTimeout: attemptTimeout,
+	}
+}
+
+// buildOtherRetryPolicy is the policy of the services without settings of their own, like webhooks and secret
+// managers, which only follow MAX_RETRIES and the HTTP client timeout
+func buildOtherRetryPolicy(config Config) RetryPolicy {
+	return buildRetryPolicy(config.MaxRetries, 0)
+}
+
+func buildGithubRetryPolicy(config Config) RetryPolicy {
+	return buildRetryPolicy(config.GithubMaxRetries, time.Duration(config.GithubRequestTimeoutSeconds)*time.Second)
+}
+
+func buildSlackRetryPolicy(config Config) RetryPolicy {
+	return buildRetryPolicy(config.SlackMaxRetries, time.Duration(config.SlackRequestTimeoutSeconds)*time.Second)
+}
+
+// retry calls fn with a context bound to the deadline of the attempt
+func (p RetryPolicy) retry(ctx context.Context, fn func(ctx context.Context) error) error {
+	return retryWithBackoff(ctx, p.MaxAttempts, p.BaseDelay, p.MaxElapsed, func() error {
+		if p.AttemptTimeout <= 0 {
+			return fn(ctx)
+		}
+		attemptCtx, cancel := context.WithTimeout(ctx, p.AttemptTimeout)
+		defer cancel()
+		return fn(attemptCtx)
+	})
+}
+
+// classifySlackError tells which Slack errors are worth retrying: rate limits, server errors and network errors are,
+// while API errors like channel_not_found are not
+func classifySlackError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var rateLimitedErr *slack.RateLimitedError
+	if errors.As(err, &rateLimitedErr) {
+		return retryAfter(err, rateLimitedErr.RetryAfter)
+	}
+	var statusCodeErr slack.StatusCodeError
+	if errors.As(err, &statusCodeErr) {
+		if statusCodeErr.Code >= http.StatusInternalServerError {
+			return err
+		}
+		return permanent(err)
+	}
+	var slackErr slack.SlackErrorResponse
+	if errors.As(err, &slackErr) {
+		return permanent(err)
+	}
+	return err
+}
+
+// classifyHTTPResponse tells whether a response status is worth retrying, honouring the Retry-After header if any
+func classifyHTTPResponse(resp *http.Response) error {
+	if resp.StatusCode < http.StatusBadRequest {
+		return nil
+	}
+
+	err := fmt.Errorf("got status %s", resp.Status)
+	if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode < http.StatusInternalServerError {
+		return permanent(err)
+	}
+	if seconds, parseErr := strconv.Atoi(resp.Header.Get("Retry-After")); parseErr == nil {
+		return retryAfter(err, time.Duration(seconds)*time.Second)
+	}
+	return err
+}
+
+// classifyGithubResponse tells rate limits from other errors. GitHub answers both secondary rate limits and
+// permanent permission problems with a 403, only the former is worth waiting for.
+func classifyGithubResponse(resp *http.Response, body []byte) error {
+	if resp.StatusCode != http.StatusForbidden {
+		return classifyHTTPResponse(resp)
+	}
+
+	err := fmt.Errorf("got status %s: %s", resp.Status, body)
+	if seconds, parseErr := strconv.Atoi(resp.Header.Get("Retry-After")); parseErr == nil {
+		return retryAfter(err, time.Duration(seconds)*time.Second)
+	}
+	if strings.Contains(strings.ToLower(string(body)), "secondary rate limit") {
+		return retryAfter(err, GithubSecondaryRateLimitDelay)
+	}
+	// The primary rate limit tells when it resets instead
+	if resp.Header.Get("X-RateLimit-Remaining") == "0" {
+		if reset, parseErr := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64); parseErr == nil {
+			return retryAfter(err, time.Until(time.Unix(reset, 0)))
+		}
+	}
+	return permanent(err)
+}
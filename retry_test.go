@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+var errTransient = errors.New("transient")
+
+func TestRetryWithBackoff(t *testing.T) {
+	tests := []struct {
+		name         string
+		maxAttempts  int
+		maxElapsed   time.Duration
+		failures     int
+		err          error
+		wantAttempts int
+		wantErr      error
+	}{
+		{name: "succeeds right away", maxAttempts: 3, maxElapsed: time.Minute, failures: 0, err: errTransient, wantAttempts: 1},
+		{name: "succeeds after retries", maxAttempts: 3, maxElapsed: time.Minute, failures: 2, err: errTransient, wantAttempts: 3},
+		{name: "gives up after max attempts", maxAttempts: 3, maxElapsed: time.Minute, failures: 5, err: errTransient, wantAttempts: 3, wantErr: errTransient},
+		{name: "single attempt", maxAttempts: 1, maxElapsed: time.Minute, failures: 5, err: errTransient, wantAttempts: 1, wantErr: errTransient},
+		{name: "permanent error is not retried", maxAttempts: 3, maxElapsed: time.Minute, failures: 5, err: permanent(errTransient), wantAttempts: 1, wantErr: errTransient},
+		{name: "stops before exceeding max elapsed", maxAttempts: 5, maxElapsed: time.Millisecond, failures: 5, err: retryAfter(errTransient, time.Second), wantAttempts: 1, wantErr: errTransient},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			attempts := 0
+			err := retryWithBackoff(context.Background(), test.maxAttempts, time.Millisecond, test.maxElapsed, func() error {
+				attempts++
+				if attempts <= test.failures {
+					return test.err
+				}
+				return nil
+			})
+			if attempts != test.wantAttempts {
+				t.Errorf("got %d attempts, want %d", attempts, test.wantAttempts)
+			}
+			if !errors.Is(err, test.wantErr) || (test.wantErr == nil && err != nil) {
+				t.Errorf("got error %v, want %v", err, test.wantErr)
+			}
+			var permanentErr permanentError
+			if errors.As(err, &permanentErr) {
+				t.Errorf("got error %v still marked as permanent", err)
+			}
+		})
+	}
+}
+
+func TestRetryWithBackoffStopsOnCancelledContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	attempts := 0
+	err := retryWithBackoff(ctx, 5, time.Minute, time.Hour, func() error {
+		attempts++
+		cancel()
+		return errTransient
+	})
+	if attempts != 1 {
+		t.Errorf("got %d attempts, want 1", attempts)
+	}
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("got error %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestRetryPolicyAppliesAttemptTimeout(t *testing.T) {
+	policy := buildRetryPolicy(1, time.Millisecond)
+	policy.BaseDelay = time.Millisecond
+	attempts := 0
+	err := policy.retry(context.Background(), func(ctx context.Context) error {
+		attempts++
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	if attempts != 2 {
+		t.Errorf("got %d attempts, want 2", attempts)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got error %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestClassifyGithubResponse(t *testing.T) {
+	tests := []struct {
+		name          string
+		status        int
+		headers       map[string]string
+		body          string
+		wantErr       bool
+		wantPermanent bool
+		wantDelay     time.Duration
+	}{
+		{name: "ok", status: 200},
+		{name: "secondary rate limit with retry after", status: 403, headers: map[string]string{"Retry-After": "30"}, body: "You have exceeded a secondary rate limit", wantErr: true, wantDelay: 30 * time.Second},
+		{name: "secondary rate limit without retry after", status: 403, body: `{"message": "You have exceeded a secondary rate limit."}`, wantErr: true, wantDelay: GithubSecondaryRateLimitDelay},
+		{name: "bad scope", status: 403, body: `{"message": "Resource not accessible by integration"}`, wantErr: true, wantPermanent: true},
+		{name: "too many requests", status: 429, headers: map[string]string{"Retry-After": "5"}, wantErr: true, wantDelay: 5 * time.Second},
+		{name: "server error", status: 502, wantErr: true},
+		{name: "not found", status: 404, wantErr: true, wantPermanent: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp := &http.Response{StatusCode: test.status, Status: http.StatusText(test.status), Header: http.Header{}}
+			for key, value := range test.headers {
+				resp.Header.Set(key, value)
+			}
+			err := classifyGithubResponse(resp, []byte(test.body))
+			if (err != nil) != test.wantErr {
+				t.Fatalf("got error %v, want error %t", err, test.wantErr)
+			}
+			var permanentErr permanentError
+			if got := errors.As(err, &permanentErr); got != test.wantPermanent {
+				t.Errorf("got permanent %t, want %t", got, test.wantPermanent)
+			}
+			var retryAfterErr retryAfterError
+			var delay time.Duration
+			if errors.As(err, &retryAfterErr) {
+				delay = retryAfterErr.delay
+			}
+			if delay != test.wantDelay {
+				t.Errorf("got delay %s, want %s", delay, test.wantDelay)
+			}
+		})
+	}
+}
+
+func TestClassifyGithubResponsePrimaryRateLimit(t *testing.T) {
+	resp := &http.Response{StatusCode: 403, Status: "403 Forbidden", Header: http.Header{}}
+	resp.Header.Set("X-RateLimit-Remaining", "0")
+	resp.Header.Set("X-RateLimit-Reset", strconv.FormatInt(time.Now().Add(time.Minute).Unix(), 10))
+	err := classifyGithubResponse(resp, []byte(`{"message": "API rate limit exceeded"}`))
+	var retryAfterErr retryAfterError
+	if !errors.As(err, &retryAfterErr) {
+		t.Fatalf("got error %v, want a retry after error", err)
+	}
+	if retryAfterErr.delay <= 0 || retryAfterErr.delay > time.Minute {
+		t.Errorf("got delay %s, want up to a minute", retryAfterErr.delay)
+	}
+}
+
+func TestBuildServiceRetryPolicies(t *testing.T) {
+	tests := []struct {
+		name       string
+		env        map[string]string
+		wantGithub RetryPolicy
+		wantSlack  RetryPolicy
+		wantOther  RetryPolicy
+	}{
+		{
+			name:       "defaults",
+			wantGithub: RetryPolicy{MaxAttempts: DefaultMaxRetries + 1, BaseDelay: RetryBaseDelay, MaxElapsed: RetryMaxElapsed},
+			wantSlack:  RetryPolicy{MaxAttempts: DefaultMaxRetries + 1, BaseDelay: RetryBaseDelay, MaxElapsed: RetryMaxElapsed},
+			wantOther:  RetryPolicy{MaxAttempts: DefaultMaxRetries + 1, BaseDelay: RetryBaseDelay, MaxElapsed: RetryMaxElapsed},
+		},
+		{
+			name:       "global setting",
+			env:        map[string]string{"MAX_RETRIES": "5"},
+			wantGithub: RetryPolicy{MaxAttempts: 6, BaseDelay: RetryBaseDelay, MaxElapsed: RetryMaxElapsed},
+			wantSlack:  RetryPolicy{MaxAttempts: 6, BaseDelay: RetryBaseDelay, MaxElapsed: RetryMaxElapsed},
+			wantOther:  RetryPolicy{MaxAttempts: 6, BaseDelay: RetryBaseDelay, MaxElapsed: RetryMaxElapsed},
+		},
+		{
+			name: "per service settings",
+			env: map[string]string{
+				"MAX_RETRIES":            "5",
+				"GITHUB_MAX_RETRIES":     "0",
+				"SLACK_MAX_RETRIES":      "3",
+				"GITHUB_REQUEST_TIMEOUT": "10",
+				"SLACK_REQUEST_TIMEOUT":  "4",
+			},
+			wantGithub: RetryPolicy{MaxAttempts: 1, BaseDelay: RetryBaseDelay, MaxElapsed: RetryMaxElapsed, AttemptTimeout: 10 * time.Second},
+			wantSlack:  RetryPolicy{MaxAttempts: 4, BaseDelay: RetryBaseDelay, MaxElapsed: RetryMaxElapsed, AttemptTimeout: 4 * time.Second},
+			wantOther:  RetryPolicy{MaxAttempts: 6, BaseDelay: RetryBaseDelay, MaxElapsed: RetryMaxElapsed},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for _, key := range []string{"MAX_RETRIES", "GITHUB_MAX_RETRIES", "SLACK_MAX_RETRIES", "GITHUB_REQUEST_TIMEOUT", "SLACK_REQUEST_TIMEOUT"} {
+				t.Setenv(key, test.env[key])
+			}
+			config := buildConfig()
+
+			if got := buildGithubRetryPolicy(config); got != test.wantGithub {
+				t.Errorf("got github policy %+v, want %+v", got, test.wantGithub)
+			}
+			if got := buildSlackRetryPolicy(config); got != test.wantSlack {
+				t.Errorf("got slack policy %+v, want %+v", got, test.wantSlack)
+			}
+			if got := buildOtherRetryPolicy(config); got != test.wantOther {
+				t.Errorf("got other policy %+v, want %+v", got, test.wantOther)
+			}
+		})
+	}
+}
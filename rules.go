@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// NotifyRule is a rule of NOTIFY_RULES, notifying the statuses whose name matches NamePattern when their conclusion
+// is one of Conclusions, or any conclusion if empty
+type NotifyRule struct {
+	NamePattern string   `json:"name_pattern"`
+	Conclusions []string `json:"conclusions"`
+
+	nameRegexp *regexp.Regexp
+}
+
+// parseNotifyRules reads the NOTIFY_RULES JSON array, compiling the name patterns
+func parseNotifyRules(value string) (rules []NotifyRule, err error) {
+	err = json.Unmarshal([]byte(value), &rules)
+	if err != nil {
+		return
+	}
+	for i := range rules {
+		rules[i].nameRegexp, err = regexp.Compile(rules[i].NamePattern)
+		if err != nil {
+			err = fmt.Errorf("rule %d: %w", i, err)
+			return
+		}
+		for j := range rules[i].Conclusions {
+			rules[i].Conclusions[j] = strings.ToLower(strings.TrimSpace(rules[i].Conclusions[j]))
+		}
+	}
+	return
+}
+
+// isPostedByRules tells whether NOTIFY_RULES ask for a result that is not a failure to be posted to the channel, as
+// failures are. Without rules only failures are posted.
+func isPostedByRules(config Config, commitStatus CommitStatus) bool {
+	return len(config.NotifyRules) > 0 && !commitStatus.Failed(config.FailureConclusions) && isNotifiedByRules(config.NotifyRules, commitStatus)
+}
+
+// isNotifiedByRules tells whether the rules let the status be notified. The first rule whose pattern matches the
+// status name decides, so specific rules go before catch-all ones, and statuses no rule matches are not notified.
+// Without rules everything is.
+func isNotifiedByRules(rules []NotifyRule, commitStatus CommitStatus) bool {
+	if len(rules) == 0 {
+		return true
+	}
+	for _, rule := range rules {
+		if !rule.nameRegexp.MatchString(commitStatus.Name) {
+			continue
+		}
+		return len(rule.Conclusions) == 0 || slices.Contains(rule.Conclusions, commitStatus.Conclusion)
+	}
+	return false
+}
@@ -0,0 +1,80 @@
+package main
+
+import "testing"
+
+func TestParseNotifyRules(t *testing.T) {
+	rules, err := parseNotifyRules(`[{"name_pattern": "^deploy", "conclusions": [" Failure ", "success"]}]`)
+	if err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	if len(rules) != 1 || rules[0].Conclusions[0] != "failure" || rules[0].nameRegexp == nil {
+		t.Errorf("got %+v, want a compiled rule with lowercase conclusions", rules)
+	}
+
+	_, err = parseNotifyRules(`[{"name_pattern": "(", "conclusions": []}]`)
+	if err == nil {
+		t.Error("got no error for an invalid pattern")
+	}
+	_, err = parseNotifyRules(`{"name_pattern": "deploy"}`)
+	if err == nil {
+		t.Error("got no error for a value that is not an array")
+	}
+}
+
+func TestIsNotifiedByRules(t *testing.T) {
+	rules, err := parseNotifyRules(`[
+		{"name_pattern": "^deploy-prod$", "conclusions": ["failure", "success"]},
+		{"name_pattern": "^deploy", "conclusions": ["failure"]},
+		{"name_pattern": "^lint", "conclusions": []}
+	]`)
+	if err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	tests := []struct {
+		name       string
+		rules      []NotifyRule
+		status     string
+		conclusion string
+		want       bool
+	}{
+		{name: "no rules notify everything", rules: nil, status: "anything", conclusion: "success", want: true},
+		{name: "specific rule matches first", rules: rules, status: "deploy-prod", conclusion: "success", want: true},
+		{name: "catch-all rule after the specific one", rules: rules, status: "deploy-staging", conclusion: "success", want: false},
+		{name: "catch-all rule conclusion", rules: rules, status: "deploy-staging", conclusion: "failure", want: true},
+		{name: "empty conclusions match any", rules: rules, status: "lint", conclusion: "neutral", want: true},
+		{name: "no rule matches", rules: rules, status: "tests", conclusion: "failure", want: false},
+	}
+	for _, test := range tests {
+		got := isNotifiedByRules(test.rules, CommitStatus{Name: test.status, Conclusion: test.conclusion})
+		if got != test.want {
+			t.Errorf("%s: got %t, want %t", test.name, got, test.want)
+		}
+	}
+}
+
+func TestIsPostedByRules(t *testing.T) {
+	rules, err := parseNotifyRules(`[{"name_pattern": "^deploy", "conclusions": ["failure", "success"]}]`)
+	if err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	failureConclusions := []string{"failure", "error"}
+	tests := []struct {
+		name       string
+		rules      []NotifyRule
+		status     string
+		conclusion string
+		want       bool
+	}{
+		{name: "success enabled by a rule", rules: rules, status: "deploy", conclusion: "success", want: true},
+		{name: "failures are posted anyway", rules: rules, status: "deploy", conclusion: "failure", want: false},
+		{name: "success no rule matches", rules: rules, status: "tests", conclusion: "success", want: false},
+		{name: "success without rules", rules: nil, status: "deploy", conclusion: "success", want: false},
+	}
+	for _, test := range tests {
+		config := Config{NotifyRules: test.rules, FailureConclusions: failureConclusions}
+		got := isPostedByRules(config, CommitStatus{Name: test.status, Conclusion: test.conclusion})
+		if got != test.want {
+			t.Errorf("%s: got %t, want %t", test.name, got, test.want)
+		}
+	}
+}
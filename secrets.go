@@ -0,0 +1,246 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	// SecretRefGCPScheme and SecretRefAWSScheme prefix token values to fetch from a secret manager instead, e.g.
+	// gcp-sm://projects/x/secrets/y/versions/latest or aws-sm://name
+	SecretRefGCPScheme = "gcp-sm://"
+	SecretRefAWSScheme = "aws-sm://"
+
+	GCPSecretManagerURL  = "https://secretmanager.googleapis.com/v1/"
+	GCPMetadataTokenURL  = "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token"
+	AWSSecretsManagerURL = "https://secretsmanager.%s.amazonaws.com/"
+)
+
+// SecretFetcher fetches the value of the named secret from a secret manager
+type SecretFetcher func(ctx context.Context, config Config, httpClient *http.Client, name string) (value string, err error)
+
+// secretFetchers are the secret managers token values can point to, by scheme
+var secretFetchers = map[string]SecretFetcher{
+	SecretRefGCPScheme: fetchGCPSecret,
+	SecretRefAWSScheme: fetchAWSSecret,
+}
+
+// resolveSecretRefs replaces the tokens holding a secret reference with the secret they point to, for orgs that keep
+// their tokens in a secret manager instead of injecting them in the environment. Plain values are left as they are.
+func resolveSecretRefs(ctx context.Context, config *Config, httpClient *http.Client) (err error) {
+	tokens := map[string]*string{
+		"GITHUB_ACCESS_TOKEN": &config.GithubAccessToken,
+		"SLACK_ACCESS_TOKEN":  &config.SlackAccessToken,
+	}
+	for key, token := range tokens {
+		for scheme, fetchSecret := range secretFetchers {
+			if !strings.HasPrefix(*token, scheme) {
+				continue
+			}
+			name := strings.TrimPrefix(*token, scheme)
+			value, fetchErr := fetchSecret(ctx, *config, httpClient, name)
+			if fetchErr != nil {
+				err = fmt.Errorf("fetching %s from %s%s: %w", key, scheme, name, fetchErr)
+				return
+			}
+			slog.Info("resolved token from secret manager", "key", key, "scheme", scheme, "name", name)
+			*token = strings.TrimSpace(value)
+		}
+	}
+	return
+}
+
+// fetchGCPSecret reads a secret version of GCP Secret Manager, "latest" if the name has no version. The access token
+// is taken from GCP_ACCESS_TOKEN, e.g. the one minted by google-github-actions/auth, or from the metadata server on
+// runners hosted in GCP.
+func fetchGCPSecret(ctx context.Context, config Config, httpClient *http.Client, name string) (value string, err error) {
+	if !strings.Contains(name, "/versions/") {
+		name += "/versions/latest"
+	}
+
+	accessToken := os.Getenv("GCP_ACCESS_TOKEN")
+	if accessToken == "" {
+		var token struct {
+			AccessToken string `json:"access_token"`
+		}
+		err = doSecretRequest(ctx, config, httpClient, func(ctx context.Context) (*http.Request, error) {
+			req, err := http.NewRequestWithContext(ctx, "GET", GCPMetadataTokenURL, nil)
+			if err == nil {
+				req.Header.Set("Metadata-Flavor", "Google")
+			}
+			return req, err
+		}, &token)
+		if err != nil {
+			err = fmt.Errorf("no GCP_ACCESS_TOKEN and no token from the metadata server: %w", err)
+			return
+		}
+		accessToken = token.AccessToken
+	}
+
+	var secret struct {
+		Payload struct {
+			Data string `json:"data"`
+		} `json:"payload"`
+	}
+	err = doSecretRequest(ctx, config, httpClient, func(ctx context.Context) (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, "GET", GCPSecretManagerURL+name+":access", nil)
+		if err == nil {
+			req.Header.Set("Authorization", "Bearer "+accessToken)
+		}
+		return req, err
+	}, &secret)
+	if err != nil {
+		return
+	}
+	data, err := base64.StdEncoding.DecodeString(secret.Payload.Data)
+	value = string(data)
+	return
+}
+
+// fetchAWSSecret reads the string value of a secret of AWS Secrets Manager, by name or ARN. The credentials are the
+// usual AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN, e.g. set by
+// aws-actions/configure-aws-credentials, and the region is the one of the ARN, or AWS_REGION otherwise.
+func fetchAWSSecret(ctx context.Context, config Config, httpClient *http.Client, name string) (value string, err error) {
+	accessKeyID := os.Getenv("AWS_ACCESS_KEY_ID")
+	secretAccessKey := os.Getenv("AWS_SECRET_ACCESS_KEY")
+	if accessKeyID == "" || secretAccessKey == "" {
+		err = errors.New("no AWS_ACCESS_KEY_ID or AWS_SECRET_ACCESS_KEY")
+		return
+	}
+	region := os.Getenv("AWS_REGION")
+	if region == "" {
+		region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	if arn := strings.Split(name, ":"); len(arn) > 3 && arn[0] == "arn" {
+		region = arn[3]
+	}
+	if region == "" {
+		err = errors.New("no AWS_REGION")
+		return
+	}
+
+	body, err := json.Marshal(map[string]string{"SecretId": name})
+	if err != nil {
+		return
+	}
+	var secret struct {
+		SecretString string `json:"SecretString"`
+	}
+	err = doSecretRequest(ctx, config, httpClient, func(ctx context.Context) (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, "POST", fmt.Sprintf(AWSSecretsManagerURL, region), bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+		req.Header.Set("X-Amz-Target", "secretsmanager.GetSecretValue")
+		if sessionToken := os.Getenv("AWS_SESSION_TOKEN"); sessionToken != "" {
+			req.Header.Set("X-Amz-Security-Token", sessionToken)
+		}
+		signAWSRequest(req, body, accessKeyID, secretAccessKey, region, "secretsmanager", time.Now())
+		return req, nil
+	}, &secret)
+	value = secret.SecretString
+	return
+}
+
+// signAWSRequest adds the Signature Version 4 authorization of the request, signing all the headers set so far
+func signAWSRequest(req *http.Request, body []byte, accessKeyID, secretAccessKey, region, service string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(req.Header.Get(name))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	bodyHash := sha256.Sum256(body)
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		path,
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		hex.EncodeToString(bodyHash[:]),
+	}, "\n")
+
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	canonicalRequestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(canonicalRequestHash[:])
+
+	key := []byte("AWS4" + secretAccessKey)
+	for _, part := range []string{date, region, service, "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", accessKeyID, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// doSecretRequest sends the request built by buildRequest, retrying on transient errors, and decodes the JSON
+// response into target
+func doSecretRequest(ctx context.Context, config Config, httpClient *http.Client, buildRequest func(ctx context.Context) (*http.Request, error), target any) error {
+	return buildOtherRetryPolicy(config).retry(ctx, func(ctx context.Context) (err error) {
+		req, err := buildRequest(ctx)
+		if err != nil {
+			return permanent(err)
+		}
+
+		resp, err := httpClient.Do(req)
+		if err != nil {
+			return
+		}
+		defer func() {
+			closeErr := resp.Body.Close()
+			if closeErr != nil {
+				slog.Warn("got error closing secret manager response body", "error", closeErr)
+			}
+		}()
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return
+		}
+		err = classifyHTTPResponse(resp)
+		if err != nil {
+			return fmt.Errorf("%w: %s", err, body)
+		}
+		err = json.Unmarshal(body, target)
+		if err != nil {
+			return permanent(err)
+		}
+		return
+	})
+}
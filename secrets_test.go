@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestResolveSecretRefs(t *testing.T) {
+	fetchers := secretFetchers
+	t.Cleanup(func() { secretFetchers = fetchers })
+
+	var fetched []string
+	secretFetchers = map[string]SecretFetcher{
+		SecretRefGCPScheme: func(ctx context.Context, config Config, httpClient *http.Client, name string) (string, error) {
+			fetched = append(fetched, name)
+			if name == "missing" {
+				return "", errors.New("secret not found")
+			}
+			return "xoxb-from-gcp\n", nil
+		},
+	}
+
+	config := Config{GithubAccessToken: "ghp_plain", SlackAccessToken: SecretRefGCPScheme + "projects/x/secrets/slack"}
+	err := resolveSecretRefs(context.Background(), &config, http.DefaultClient)
+	if err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	if config.SlackAccessToken != "xoxb-from-gcp" {
+		t.Errorf("got slack token %q, want the trimmed secret", config.SlackAccessToken)
+	}
+	if config.GithubAccessToken != "ghp_plain" {
+		t.Errorf("got github token %q, want the plain value kept", config.GithubAccessToken)
+	}
+	if len(fetched) != 1 || fetched[0] != "projects/x/secrets/slack" {
+		t.Errorf("got fetched %v, want only the slack secret", fetched)
+	}
+
+	config = Config{SlackAccessToken: SecretRefGCPScheme + "missing"}
+	err = resolveSecretRefs(context.Background(), &config, http.DefaultClient)
+	if err == nil {
+		t.Error("got no error for a secret that can't be fetched")
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+const (
+	// SEVERITY values, telling the business impact of a failure whatever its conclusion
+	SeverityInfo     = "info"
+	SeverityWarning  = "warning"
+	SeverityCritical = "critical"
+)
+
+// SeverityThemes are how failures of each SEVERITY look, taking over the conclusion emoji and the environment color
+var SeverityThemes = map[string]Theme{
+	SeverityInfo:     {Emoji: ":information_source:", Color: "#439fe0"},
+	SeverityWarning:  {Emoji: ":warning:", Color: "#ecb22e"},
+	SeverityCritical: {Emoji: ":rotating_light:", Color: "#e01e5a"},
+}
+
+// getSeverityTheme returns the theme of the SEVERITY of a failed status, or false if there is no severity or the
+// status did not fail
+func getSeverityTheme(config Config, commitStatus CommitStatus) (theme Theme, ok bool) {
+	if config.Severity == "" || !commitStatus.Failed(config.FailureConclusions) {
+		return
+	}
+	theme, ok = SeverityThemes[config.Severity]
+	return
+}
+
+// getEscalateAfter returns after how many failures in a row the status is escalated, or 0 for never. Critical
+// failures are escalated right away, and informative ones never are.
+func getEscalateAfter(config Config) int {
+	switch config.Severity {
+	case SeverityInfo:
+		return 0
+	case SeverityCritical:
+		return 1
+	}
+	return config.EscalateAfter
+}
@@ -0,0 +1,46 @@
+package main
+
+import "testing"
+
+func TestGetSeverityTheme(t *testing.T) {
+	failureConclusions := []string{"failure", "error"}
+	tests := []struct {
+		name       string
+		severity   string
+		conclusion string
+		wantOk     bool
+		wantEmoji  string
+	}{
+		{name: "no severity", severity: "", conclusion: "failure", wantOk: false},
+		{name: "critical failure", severity: SeverityCritical, conclusion: "failure", wantOk: true, wantEmoji: ":rotating_light:"},
+		{name: "warning error", severity: SeverityWarning, conclusion: "error", wantOk: true, wantEmoji: ":warning:"},
+		{name: "success keeps its emoji", severity: SeverityCritical, conclusion: "success", wantOk: false},
+	}
+	for _, test := range tests {
+		config := Config{Severity: test.severity, FailureConclusions: failureConclusions}
+		theme, ok := getSeverityTheme(config, CommitStatus{Conclusion: test.conclusion})
+		if ok != test.wantOk || theme.Emoji != test.wantEmoji {
+			t.Errorf("%s: got %+v and %t, want emoji %q and %t", test.name, theme, ok, test.wantEmoji, test.wantOk)
+		}
+	}
+}
+
+func TestGetEscalateAfter(t *testing.T) {
+	tests := []struct {
+		severity      string
+		escalateAfter int
+		want          int
+	}{
+		{severity: "", escalateAfter: 3, want: 3},
+		{severity: SeverityWarning, escalateAfter: 3, want: 3},
+		{severity: SeverityInfo, escalateAfter: 3, want: 0},
+		{severity: SeverityCritical, escalateAfter: 3, want: 1},
+		{severity: SeverityCritical, escalateAfter: 0, want: 1},
+	}
+	for _, test := range tests {
+		got := getEscalateAfter(Config{Severity: test.severity, EscalateAfter: test.escalateAfter})
+		if got != test.want {
+			t.Errorf("%q with ESCALATE_AFTER=%d: got %d, want %d", test.severity, test.escalateAfter, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+const (
+	StateFileName = "actions-notify-slack-state.json"
+	// StateMaxEntries caps the entries kept in the state, so it can't grow unbounded on a long-lived runner
+	StateMaxEntries = 1000
+)
+
+// State is persisted to disk between runs, so notifications can be aware of the ones sent before them
+type State struct {
+	LastNotifiedAt map[string]time.Time `json:"lastNotifiedAt"`
+	// ConsecutiveFailures counts the failures of each status since it last succeeded
+	ConsecutiveFailures map[string]int `json:"consecutiveFailures"`
+	// FailuresUpdatedAt is when each of the ConsecutiveFailures was last counted
+	FailuresUpdatedAt map[string]time.Time `json:"failuresUpdatedAt"`
+	// CommitThreads are the first messages posted for each commit, whose threads the next statuses reply in
+	CommitThreads map[string]CommitThread `json:"commitThreads"`
+}
+
+// CommitThread is the message a commit's statuses are threaded under
+type CommitThread struct {
+	Channel  string    `json:"channel"`
+	Ts       string    `json:"ts"`
+	PostedAt time.Time `json:"postedAt"`
+}
+
+func getStateFilePath(stateDir string) string {
+	return filepath.Join(stateDir, StateFileName)
+}
+
+func loadState(stateDir string) (state State, err error) {
+	state = State{
+		LastNotifiedAt:      map[string]time.Time{},
+		ConsecutiveFailures: map[string]int{},
+		FailuresUpdatedAt:   map[string]time.Time{},
+		CommitThreads:       map[string]CommitThread{},
+	}
+
+	content, err := os.ReadFile(getStateFilePath(stateDir))
+	if errors.Is(err, fs.ErrNotExist) {
+		// Nothing was persisted yet, start from an empty state
+		err = nil
+		return
+	}
+	if err != nil {
+		return
+	}
+
+	err = json.Unmarshal(content, &state)
+	if state.LastNotifiedAt == nil {
+		state.LastNotifiedAt = map[string]time.Time{}
+	}
+	if state.ConsecutiveFailures == nil {
+		state.ConsecutiveFailures = map[string]int{}
+	}
+	if state.FailuresUpdatedAt == nil {
+		state.FailuresUpdatedAt = map[string]time.Time{}
+	}
+	if state.CommitThreads == nil {
+		state.CommitThreads = map[string]CommitThread{}
+	}
+	return
+}
+
+// saveState writes the state, pruned of the entries older than ttl
+func saveState(stateDir string, ttl time.Duration, state State) (err error) {
+	pruneState(state, ttl, time.Now())
+	content, err := json.Marshal(state)
+	if err != nil {
+		return
+	}
+	err = os.WriteFile(getStateFilePath(stateDir), content, 0o600)
+	return
+}
+
+func getCommitThreadKey(repository, sha, slackChannel string) string {
+	return fmt.Sprintf("thread:%s:%s:%s", repository, sha, slackChannel)
+}
+
+func getCooldownKey(authorUsername, slackChannel string) string {
+	return fmt.Sprintf("cooldown:%s:%s", authorUsername, slackChannel)
+}
+
+// isInCooldown reports whether the author was already notified in the channel less than cooldown ago
+func isInCooldown(state State, key string, cooldown time.Duration, now time.Time) bool {
+	lastNotifiedAt, ok := state.LastNotifiedAt[key]
+	if !ok {
+		return false
+	}
+	return now.Sub(lastNotifiedAt) < cooldown
+}
+
+// pruneState removes the entries last updated more than ttl ago, then the oldest ones beyond StateMaxEntries. Failure
+// counts saved before they had a timestamp are considered updated now, so they expire in due time.
+func pruneState(state State, ttl time.Duration, now time.Time) {
+	for key := range state.ConsecutiveFailures {
+		if _, ok := state.FailuresUpdatedAt[key]; !ok {
+			state.FailuresUpdatedAt[key] = now
+		}
+	}
+	for key := range state.FailuresUpdatedAt {
+		if _, ok := state.ConsecutiveFailures[key]; !ok {
+			delete(state.FailuresUpdatedAt, key)
+		}
+	}
+
+	type stateEntry struct {
+		key       string
+		updatedAt time.Time
+		remove    func(key string)
+	}
+	removeLastNotifiedAt := func(key string) { delete(state.LastNotifiedAt, key) }
+	removeFailures := func(key string) {
+		delete(state.FailuresUpdatedAt, key)
+		delete(state.ConsecutiveFailures, key)
+	}
+	removeCommitThread := func(key string) { delete(state.CommitThreads, key) }
+	var entries []stateEntry
+	for key, updatedAt := range state.LastNotifiedAt {
+		entries = append(entries, stateEntry{key, updatedAt, removeLastNotifiedAt})
+	}
+	for key, updatedAt := range state.FailuresUpdatedAt {
+		entries = append(entries, stateEntry{key, updatedAt, removeFailures})
+	}
+	for key, thread := range state.CommitThreads {
+		entries = append(entries, stateEntry{key, thread.PostedAt, removeCommitThread})
+	}
+	slices.SortFunc(entries, func(a, b stateEntry) int {
+		return b.updatedAt.Compare(a.updatedAt)
+	})
+
+	for i, entry := range entries {
+		if i >= StateMaxEntries || now.Sub(entry.updatedAt) > ttl {
+			entry.remove(entry.key)
+		}
+	}
+}
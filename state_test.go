@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func newEmptyState() State {
+	return State{
+		LastNotifiedAt:      map[string]time.Time{},
+		ConsecutiveFailures: map[string]int{},
+		FailuresUpdatedAt:   map[string]time.Time{},
+		CommitThreads:       map[string]CommitThread{},
+	}
+}
+
+func TestPruneState(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	ttl := 24 * time.Hour
+	fresh := now.Add(-time.Hour)
+	expired := now.Add(-48 * time.Hour)
+
+	state := newEmptyState()
+	state.LastNotifiedAt["cooldown:expired-1"] = expired
+	state.LastNotifiedAt["cooldown:fresh"] = fresh
+	state.LastNotifiedAt["cooldown:expired-2"] = expired
+	state.ConsecutiveFailures["failures:expired"] = 3
+	state.FailuresUpdatedAt["failures:expired"] = expired
+	state.ConsecutiveFailures["failures:fresh"] = 1
+	state.FailuresUpdatedAt["failures:fresh"] = fresh
+	state.ConsecutiveFailures["failures:legacy"] = 2
+	state.FailuresUpdatedAt["failures:orphan"] = fresh
+	state.CommitThreads["thread:expired"] = CommitThread{Ts: "1", PostedAt: expired}
+	state.CommitThreads["thread:fresh"] = CommitThread{Ts: "2", PostedAt: fresh}
+
+	pruneState(state, ttl, now)
+
+	tests := []struct {
+		name string
+		kept bool
+		got  bool
+	}{
+		{name: "fresh cooldown", kept: true, got: hasKey(state.LastNotifiedAt, "cooldown:fresh")},
+		{name: "expired cooldown 1", kept: false, got: hasKey(state.LastNotifiedAt, "cooldown:expired-1")},
+		{name: "expired cooldown 2", kept: false, got: hasKey(state.LastNotifiedAt, "cooldown:expired-2")},
+		{name: "fresh failures", kept: true, got: hasKey(state.ConsecutiveFailures, "failures:fresh")},
+		{name: "expired failures", kept: false, got: hasKey(state.ConsecutiveFailures, "failures:expired")},
+		{name: "expired failures timestamp", kept: false, got: hasKey(state.FailuresUpdatedAt, "failures:expired")},
+		{name: "legacy failures without timestamp", kept: true, got: hasKey(state.FailuresUpdatedAt, "failures:legacy")},
+		{name: "orphan failures timestamp", kept: false, got: hasKey(state.FailuresUpdatedAt, "failures:orphan")},
+		{name: "fresh thread", kept: true, got: hasKey(state.CommitThreads, "thread:fresh")},
+		{name: "expired thread", kept: false, got: hasKey(state.CommitThreads, "thread:expired")},
+	}
+	for _, test := range tests {
+		if test.got != test.kept {
+			t.Errorf("%s: got kept %t, want %t", test.name, test.got, test.kept)
+		}
+	}
+}
+
+func TestPruneStateCapsEntries(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	state := newEmptyState()
+	for i := 0; i < StateMaxEntries+10; i++ {
+		state.LastNotifiedAt[fmt.Sprintf("cooldown:%d", i)] = now.Add(-time.Duration(i) * time.Second)
+	}
+
+	pruneState(state, 24*time.Hour, now)
+
+	if len(state.LastNotifiedAt) != StateMaxEntries {
+		t.Fatalf("got %d entries, want %d", len(state.LastNotifiedAt), StateMaxEntries)
+	}
+	for i := StateMaxEntries; i < StateMaxEntries+10; i++ {
+		if hasKey(state.LastNotifiedAt, fmt.Sprintf("cooldown:%d", i)) {
+			t.Errorf("got oldest entry %d kept", i)
+		}
+	}
+	if !hasKey(state.LastNotifiedAt, "cooldown:0") {
+		t.Error("got newest entry pruned")
+	}
+}
+
+func TestSaveAndLoadState(t *testing.T) {
+	stateDir := t.TempDir()
+	state := newEmptyState()
+	state.LastNotifiedAt["cooldown:fresh"] = time.Now().Add(-time.Minute).Round(0)
+	state.LastNotifiedAt["cooldown:expired"] = time.Now().Add(-48 * time.Hour)
+
+	err := saveState(stateDir, 24*time.Hour, state)
+	if err != nil {
+		t.Fatalf("got error saving state: %v", err)
+	}
+	loaded, err := loadState(stateDir)
+	if err != nil {
+		t.Fatalf("got error loading state: %v", err)
+	}
+	if !hasKey(loaded.LastNotifiedAt, "cooldown:fresh") || hasKey(loaded.LastNotifiedAt, "cooldown:expired") {
+		t.Errorf("got %v, want only the fresh entry", loaded.LastNotifiedAt)
+	}
+}
+
+func hasKey[V any](m map[string]V, key string) bool {
+	_, ok := m[key]
+	return ok
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+)
+
+const MessageFormatTable = "table"
+
+// buildStatuses reads the statuses listed in STATUSES_JSON, each with a name, conclusion and url
+func buildStatuses() (statuses []CommitStatus, err error) {
+	statusesJSON := os.Getenv("STATUSES_JSON")
+	if statusesJSON == "" {
+		return
+	}
+	err = json.Unmarshal([]byte(statusesJSON), &statuses)
+	for i := range statuses {
+		statuses[i].Conclusion = strings.ToLower(strings.TrimSpace(statuses[i].Conclusion))
+	}
+	return
+}
+
+// buildStatusTableMessage renders the statuses of the commit as a monospace table, easier to scan than prose when
+// there are many checks
+func buildStatusTableMessage(config Config, userResolver *SlackUserResolver, commit Commit, commitStatus CommitStatus, statuses []CommitStatus, pullRequest PullRequest) (message string) {
+	rows := [][]string{{"NAME", "CONCLUSION", "LINK"}}
+	for _, status := range statuses {
+		rows = append(rows, []string{status.DisplayName(), status.Conclusion, status.Url})
+	}
+
+	message = fmt.Sprintf("%s Status checks of the commit %s%s by %s:\n```\n%s```",
+		getConclusionEmoji(config, commitStatus, ":warning:"),
+		commit.getCommitLink(),
+		buildPullRequestClause(pullRequest),
+		buildAuthorsMention(config, resolveAuthors(userResolver, commit)),
+		formatTable(rows),
+	)
+	return
+}
+
+// formatTable aligns the rows into columns separated by two spaces, one row per line
+func formatTable(rows [][]string) string {
+	var columnWidths []int
+	for _, row := range rows {
+		for i, cell := range row {
+			if i == len(columnWidths) {
+				columnWidths = append(columnWidths, 0)
+			}
+			columnWidths[i] = max(columnWidths[i], displayWidth(cell))
+		}
+	}
+
+	var table strings.Builder
+	for _, row := range rows {
+		var line strings.Builder
+		for i, cell := range row {
+			line.WriteString(cell)
+			if i < len(row)-1 {
+				line.WriteString(strings.Repeat(" ", columnWidths[i]-displayWidth(cell)+2))
+			}
+		}
+		table.WriteString(strings.TrimRight(line.String(), " "))
+		table.WriteString("\n")
+	}
+	return table.String()
+}
+
+// displayWidth is how many monospace columns the text takes: wide characters (CJK, most emoji) take two, combining
+// marks none
+func displayWidth(text string) (width int) {
+	for _, r := range text {
+		switch {
+		case unicode.Is(unicode.Mn, r) || unicode.Is(unicode.Me, r) || r == '\u200d':
+			// Combining marks and zero width joiners are drawn over the previous character
+		case isWideRune(r):
+			width += 2
+		default:
+			width++
+		}
+	}
+	return
+}
+
+func isWideRune(r rune) bool {
+	return unicode.Is(unicode.Han, r) ||
+		unicode.Is(unicode.Hiragana, r) ||
+		unicode.Is(unicode.Katakana, r) ||
+		unicode.Is(unicode.Hangul, r) ||
+		(r >= 0x1100 && r <= 0x115f) || // Hangul Jamo
+		(r >= 0x2e80 && r <= 0x303e) || // CJK radicals and punctuation
+		(r >= 0xff00 && r <= 0xff60) || // Fullwidth forms
+		(r >= 0xffe0 && r <= 0xffe6) ||
+		(r >= 0x1f300 && r <= 0x1f64f) || // Emoji
+		(r >= 0x1f680 && r <= 0x1f6ff) || // Transport and map symbols
+		(r >= 0x1f900 && r <= 0x1f9ff)
+}
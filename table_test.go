@@ -0,0 +1,120 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFormatTable(t *testing.T) {
+	tests := []struct {
+		name string
+		rows [][]string
+		want string
+	}{
+		{name: "empty", rows: nil, want: ""},
+		{
+			name: "aligned columns",
+			rows: [][]string{{"Status", "Conclusion"}, {"build", "success"}, {"integration-tests", "failure"}},
+			want: "Status             Conclusion\n" +
+				"build              success\n" +
+				"integration-tests  failure\n",
+		},
+		{
+			name: "trailing empty cells are trimmed",
+			rows: [][]string{{"a", "", ""}, {"bb", "c", "d"}},
+			want: "a\n" +
+				"bb  c  d\n",
+		},
+		{
+			name: "wide characters take two columns",
+			rows: [][]string{{"デプロイ", "ok"}, {"build", "ok"}},
+			want: "デプロイ  ok\n" +
+				"build     ok\n",
+		},
+	}
+	for _, test := range tests {
+		if got := formatTable(test.rows); got != test.want {
+			t.Errorf("%s: got\n%q\nwant\n%q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestDisplayWidth(t *testing.T) {
+	tests := []struct {
+		text string
+		want int
+	}{
+		{text: "", want: 0},
+		{text: "build", want: 5},
+		{text: "ビルド", want: 6},
+		{text: "🚀 deploy", want: 9},
+		{text: "🚗", want: 2},
+		{text: "é", want: 1},
+	}
+	for _, test := range tests {
+		if got := displayWidth(test.text); got != test.want {
+			t.Errorf("%q: got %d, want %d", test.text, got, test.want)
+		}
+	}
+}
+
+func TestBuildStatuses(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     string
+		want    []CommitStatus
+		wantErr bool
+	}{
+		{name: "unset"},
+		{
+			name: "conclusions are normalized",
+			env:  `[{"name": "build", "conclusion": " Failure ", "url": "https://ci.example.com/1"}, {"name": "lint", "conclusion": "SUCCESS"}]`,
+			want: []CommitStatus{{Name: "build", Conclusion: "failure", Url: "https://ci.example.com/1"}, {Name: "lint", Conclusion: "success"}},
+		},
+		{name: "invalid", env: `{"name": "build"}`, wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Setenv("STATUSES_JSON", test.env)
+			statuses, err := buildStatuses()
+			if (err != nil) != test.wantErr {
+				t.Fatalf("got error %v, want error %t", err, test.wantErr)
+			}
+			if !reflect.DeepEqual(statuses, test.want) {
+				t.Errorf("got %+v, want %+v", statuses, test.want)
+			}
+		})
+	}
+}
+
+func TestBuildStatusTableMessage(t *testing.T) {
+	config := Config{
+		GithubServerURL:    "https://github.example.com",
+		ConclusionEmojiMap: map[string]string{"failure": ":rotating_light:"},
+	}
+	userResolver, _ := newFakeUserDirectory(t, config, map[string]string{"jane@example.com": "U0JANE", "john@example.com": "U0JOHN"})
+	commit := Commit{
+		url:            "https://github.example.com/o/r/commit/abc123",
+		authorUsername: "jdoe",
+		authorEmail:    "jane@example.com",
+		commitMessage:  "Fix build\n\nCo-authored-by: John Smith <john@example.com>",
+	}
+	commit.coAuthors = parseCoAuthors(commit.commitMessage, "")
+	statuses := []CommitStatus{
+		{Name: "build", Conclusion: "failure", Url: "https://ci.example.com/1"},
+		{Name: "test", JobName: "unit", StepName: "go test", Conclusion: "success", Url: "https://ci.example.com/2"},
+	}
+	pullRequest := PullRequest{number: "42", url: "https://github.example.com/o/r/pull/42"}
+
+	got := buildStatusTableMessage(config, userResolver, commit, CommitStatus{Name: "build", Conclusion: "failure"}, statuses, pullRequest)
+	want := ":rotating_light: Status checks of the commit <https://github.example.com/o/r/commit/abc123|\"_Fix build_\">" +
+		" (PR <https://github.example.com/o/r/pull/42|#42>) by <@U0JANE> (<https://github.example.com/jdoe|jdoe>) with <@U0JOHN>:\n" +
+		"```\n" +
+		"NAME                         CONCLUSION  LINK\n" +
+		"build                        failure     https://ci.example.com/1\n" +
+		"job \"unit\" / step \"go test\"  success     https://ci.example.com/2\n" +
+		"```"
+	if got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
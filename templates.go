@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// TemplateEnvPrefix starts the env vars holding a message template per conclusion, like TEMPLATE_FAILURE
+const TemplateEnvPrefix = "TEMPLATE_"
+
+// buildTemplates reads the TEMPLATE_<CONCLUSION> env vars, keyed by lowercase conclusion
+func buildTemplates() (templates map[string]string) {
+	templates = map[string]string{}
+	for _, entry := range os.Environ() {
+		key, value, _ := strings.Cut(entry, "=")
+		conclusion, found := strings.CutPrefix(key, TemplateEnvPrefix)
+		if !found || conclusion == "" || strings.TrimSpace(value) == "" {
+			continue
+		}
+		templates[strings.ToLower(conclusion)] = value
+	}
+	return
+}
+
+// hasTemplate reports whether a TEMPLATE_<CONCLUSION> is set for the conclusion of the status
+func hasTemplate(config Config, commitStatus CommitStatus) bool {
+	_, ok := config.Templates[commitStatus.Conclusion]
+	return ok
+}
+
+// buildTemplatedMessage renders the template of the status conclusion, on top of the ATTACHMENT_FIELDS placeholders
+// with {mention}, {commit_link}, {status_link} and {pr_link}. It returns false when no template is set for the
+// conclusion, and the default message should be used. Anything else, like an unknown placeholder, is kept as is.
+func buildTemplatedMessage(config Config, userResolver *SlackUserResolver, commit Commit, commitStatus CommitStatus, pullRequest PullRequest) (message string, ok bool) {
+	template, ok := config.Templates[commitStatus.Conclusion]
+	if !ok {
+		return
+	}
+
+	// Looking authors up in Slack is only worth it when the template mentions them
+	var mention string
+	if strings.Contains(template, "{mention}") {
+		mention = buildAuthorsMention(config, resolveAuthors(userResolver, commit))
+	}
+	var pullRequestLink string
+	if pullRequest.isPresent() {
+		pullRequestLink = fmt.Sprintf("<%s|#%s>", pullRequest.url, pullRequest.number)
+	}
+	replacer := buildPlaceholderReplacer(config, commit, commitStatus,
+		"{mention}", mention,
+		"{commit_link}", commit.getCommitLink(),
+		"{status_link}", fmt.Sprintf("<%s|%s>", commitStatus.Url, commitStatus.DisplayName()),
+		"{pr_link}", pullRequestLink,
+	)
+	message = replacer.Replace(template)
+	return
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBuildTemplates(t *testing.T) {
+	t.Setenv("TEMPLATE_FAILURE", ":x: {mention} broke {status_link}")
+	t.Setenv("TEMPLATE_Success", ":white_check_mark: {status_link}")
+	t.Setenv("TEMPLATE_CANCELLED", "  ")
+	t.Setenv("TEMPLATE_", "no conclusion")
+
+	want := map[string]string{"failure": ":x: {mention} broke {status_link}", "success": ":white_check_mark: {status_link}"}
+	if got := buildTemplates(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestBuildTemplatedMessage(t *testing.T) {
+	commit := Commit{url: "https://github.com/o/r/commit/abc123", sha: "abc123", authorUsername: "jdoe", authorEmail: "jane@example.com", commitMessage: "Fix <b>"}
+	status := CommitStatus{Name: "build", Conclusion: "failure", Url: "https://ci.example.com/run/1"}
+	pullRequest := PullRequest{number: "42", url: "https://github.com/o/r/pull/42"}
+	tests := []struct {
+		name        string
+		template    string
+		want        string
+		wantLookups int
+	}{
+		{
+			name:        "all placeholders",
+			template:    ":x: {mention} broke {status_link} with {commit_link} in {pr_link} ({sha} of {repository})",
+			want:        ":x: <@U0JANE> (<https://github.com/jdoe|jdoe>) broke <https://ci.example.com/run/1|build> with <https://github.com/o/r/commit/abc123|\"_Fix &lt;b&gt;_\"> in <https://github.com/o/r/pull/42|#42> (abc123 of o/r)",
+			wantLookups: 1,
+		},
+		{name: "without mention", template: "{author} broke {status}", want: "jdoe broke build", wantLookups: 0},
+		{name: "unknown placeholder", template: "{author} broke {branch}", want: "jdoe broke {branch}"},
+		{name: "unbalanced braces", template: "{author broke {status} }{", want: "{author broke build }{"},
+		{name: "escaped title", template: "{title}", want: "Fix &lt;b&gt;"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := Config{
+				GithubServerURL:  DefaultGithubServerURL,
+				GithubRepository: "o/r",
+				Templates:        map[string]string{"failure": test.template},
+			}
+			userResolver, api := newFakeUserDirectory(t, config, map[string]string{"jane@example.com": "U0JANE"})
+
+			message, ok := buildTemplatedMessage(config, userResolver, commit, status, pullRequest)
+			if !ok {
+				t.Fatal("got no templated message")
+			}
+			if message != test.want {
+				t.Errorf("got %q, want %q", message, test.want)
+			}
+			if got := api.callCount("users.lookupByEmail"); got != test.wantLookups {
+				t.Errorf("got %d lookups, want %d", got, test.wantLookups)
+			}
+		})
+	}
+}
+
+func TestBuildTemplatedMessageWithoutTemplate(t *testing.T) {
+	config := Config{Templates: map[string]string{"failure": ":x: {status_link}"}}
+	message, ok := buildTemplatedMessage(config, nil, Commit{}, CommitStatus{Name: "build", Conclusion: "success"}, PullRequest{})
+	if ok || message != "" {
+		t.Errorf("got %q, want no message for a conclusion without template", message)
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import "strings"
+
+// Theme makes the notifications of an environment recognizable at a glance
+type Theme struct {
+	// Emoji is put before the message
+	Emoji string `json:"emoji"`
+	// Color is the color of the message attachment, as a Slack color name or hex code
+	Color string `json:"color"`
+}
+
+// DefaultEnvThemes are the themes of the common environment names, ENV_THEME_MAP can override or add to them
+var DefaultEnvThemes = map[string]Theme{
+	"production":  {Emoji: ":rotating_light:", Color: "#e01e5a"},
+	"prod":        {Emoji: ":rotating_light:", Color: "#e01e5a"},
+	"staging":     {Emoji: ":large_orange_diamond:", Color: "#ecb22e"},
+	"development": {Emoji: ":white_circle:", Color: "#9e9e9e"},
+	"dev":         {Emoji: ":white_circle:", Color: "#9e9e9e"},
+}
+
+// getEnvironmentTheme returns the theme of the ENVIRONMENT of the run, looked up case-insensitively, or false if there
+// is none
+func getEnvironmentTheme(config Config) (theme Theme, ok bool) {
+	if config.Environment == "" {
+		return
+	}
+	theme, ok = config.EnvThemeMap[strings.ToLower(config.Environment)]
+	return
+}
+
+// getMessageTheme returns the theme of a channel message about the status. Only failures are themed: a success of
+// production must not look like an alarm. The SEVERITY of a failure takes over the color of the environment.
+func getMessageTheme(config Config, commitStatus CommitStatus) (theme Theme) {
+	if !commitStatus.Failed(config.FailureConclusions) {
+		return
+	}
+	theme, _ = getEnvironmentTheme(config)
+	if severityTheme, ok := getSeverityTheme(config, commitStatus); ok {
+		theme.Color = severityTheme.Color
+	}
+	return
+}
@@ -0,0 +1,66 @@
+package main
+
+import "testing"
+
+func TestGetEnvironmentTheme(t *testing.T) {
+	config := Config{EnvThemeMap: DefaultEnvThemes}
+	tests := []struct {
+		environment string
+		want        Theme
+		wantOk      bool
+	}{
+		{environment: "", wantOk: false},
+		{environment: "Production", want: DefaultEnvThemes["production"], wantOk: true},
+		{environment: "staging", want: DefaultEnvThemes["staging"], wantOk: true},
+		{environment: "qa", wantOk: false},
+	}
+	for _, test := range tests {
+		config.Environment = test.environment
+		got, ok := getEnvironmentTheme(config)
+		if got != test.want || ok != test.wantOk {
+			t.Errorf("%q: got %+v and %t, want %+v and %t", test.environment, got, ok, test.want, test.wantOk)
+		}
+	}
+}
+
+func TestGetMessageTheme(t *testing.T) {
+	tests := []struct {
+		name        string
+		environment string
+		severity    string
+		conclusion  string
+		want        Theme
+		wantColor   string
+	}{
+		{name: "production failure", environment: "production", conclusion: "failure", want: DefaultEnvThemes["production"], wantColor: "#e01e5a"},
+		{name: "production success", environment: "production", conclusion: "success", wantColor: AttachmentColorSuccess},
+		{name: "staging failure", environment: "staging", conclusion: "failure", want: DefaultEnvThemes["staging"], wantColor: "#ecb22e"},
+		{name: "staging success", environment: "staging", conclusion: "success", wantColor: AttachmentColorSuccess},
+		{
+			name: "severity color over the environment", environment: "staging", severity: SeverityCritical, conclusion: "failure",
+			want: Theme{Emoji: DefaultEnvThemes["staging"].Emoji, Color: SeverityThemes[SeverityCritical].Color}, wantColor: SeverityThemes[SeverityCritical].Color,
+		},
+	}
+	for _, test := range tests {
+		config := Config{
+			Environment:        test.environment,
+			Severity:           test.severity,
+			EnvThemeMap:        DefaultEnvThemes,
+			FailureConclusions: []string{"failure", "error"},
+		}
+		status := CommitStatus{Conclusion: test.conclusion}
+		theme := getMessageTheme(config, status)
+		if theme != test.want {
+			t.Errorf("%s: got theme %+v, want %+v", test.name, theme, test.want)
+		}
+
+		attachment, ok := buildSlackAttachment(config, Notification{
+			Fields: []NotificationField{{Title: "Service", Value: "payments"}},
+			Status: status,
+			Color:  theme.Color,
+		})
+		if !ok || attachment.Color != test.wantColor {
+			t.Errorf("%s: got attachment color %q, want %q", test.name, attachment.Color, test.wantColor)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/slack-go/slack"
+)
+
+const (
+	// TopicFailingFormat and TopicPassingFormat are the topics set by UPDATE_CHANNEL_TOPIC. Topics don't render links,
+	// so they only name the repository and the failed status.
+	TopicFailingFormat = ":red_circle: %s is failing: %s"
+	TopicPassingFormat = ":large_green_circle: %s is passing"
+)
+
+// buildChannelTopic returns the topic telling the state of the repository after the status, or "" for conclusions
+// that tell nothing about it, e.g. cancelled or skipped runs
+func buildChannelTopic(config Config, commitStatus CommitStatus) string {
+	if commitStatus.Failed(config.FailureConclusions) {
+		return fmt.Sprintf(TopicFailingFormat, config.GithubRepository, commitStatus.DisplayName())
+	}
+	if commitStatus.Succeeded() {
+		return fmt.Sprintf(TopicPassingFormat, config.GithubRepository)
+	}
+	return ""
+}
+
+// updateChannelTopic sets the channel topic to the state of the repository, turning status board channels red on a
+// failure and green again on the next success. The topic is left alone when it is already right, since every change
+// posts a "set the channel topic" message.
+func updateChannelTopic(ctx context.Context, config Config, client *slack.Client, slackChannel string, commitStatus CommitStatus) (err error) {
+	topic := buildChannelTopic(config, commitStatus)
+	if topic == "" {
+		return
+	}
+
+	channelID, err := resolveChannelID(client, config.SlackTeamID, slackChannel)
+	if err != nil {
+		return
+	}
+	channel, err := client.GetConversationInfoContext(ctx, &slack.GetConversationInfoInput{ChannelID: channelID})
+	if err != nil {
+		return
+	}
+	if channel.Topic.Value == topic {
+		return
+	}
+
+	_, err = client.SetTopicOfConversationContext(ctx, channelID, topic)
+	if err != nil {
+		logScopeError(err, "channels:write.topic")
+		err = fmt.Errorf("setting channel topic: %w", err)
+		return
+	}
+	slog.Info("channel topic updated", "channel", channelID, "topic", topic)
+	return
+}
@@ -0,0 +1,22 @@
+package main
+
+import "testing"
+
+func TestBuildChannelTopic(t *testing.T) {
+	config := Config{GithubRepository: "owner/repo", FailureConclusions: []string{"failure", "error"}}
+	tests := []struct {
+		conclusion string
+		want       string
+	}{
+		{conclusion: "failure", want: ":red_circle: owner/repo is failing: build"},
+		{conclusion: "success", want: ":large_green_circle: owner/repo is passing"},
+		{conclusion: "cancelled", want: ""},
+		{conclusion: "skipped", want: ""},
+	}
+	for _, test := range tests {
+		got := buildChannelTopic(config, CommitStatus{Name: "build", Conclusion: test.conclusion})
+		if got != test.want {
+			t.Errorf("%s: got %q, want %q", test.conclusion, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// DebugBodyMaxLength is how much of a request or response body is logged when debugging HTTP calls
+const DebugBodyMaxLength = 4096
+
+// buildHTTPClient builds the HTTP client shared by the Slack and GitHub calls, so they all use the same timeout, proxy
+// and CA settings
+func buildHTTPClient(config Config) (client *http.Client, err error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = http.ProxyFromEnvironment
+
+	if config.CACertFile != "" {
+		rootCAs, poolErr := x509.SystemCertPool()
+		if poolErr != nil {
+			slog.Warn("got error loading system cert pool, using only the custom CA", "error", poolErr)
+			rootCAs = x509.NewCertPool()
+		}
+		caCert, readErr := os.ReadFile(config.CACertFile)
+		if readErr != nil {
+			err = fmt.Errorf("could not read CA cert file %s: %w", config.CACertFile, readErr)
+			return
+		}
+		if !rootCAs.AppendCertsFromPEM(caCert) {
+			err = errors.New("no PEM certificates found in CA cert file " + config.CACertFile)
+			return
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: rootCAs}
+	}
+
+	client = &http.Client{
+		Transport: transport,
+		Timeout:   time.Duration(config.HTTPTimeoutSeconds) * time.Second,
+	}
+	return
+}
+
+// SlackResponseWarnings is the part of Slack API responses telling about what works but should be fixed, like
+// superfluous_charset or deprecated arguments
+type SlackResponseWarnings struct {
+	Warning          string `json:"warning"`
+	ResponseMetadata struct {
+		Warnings []string `json:"warnings"`
+	} `json:"response_metadata"`
+}
+
+// slackWarningTransport logs the warnings of Slack API responses, which the Slack client discards even though they
+// announce future errors
+type slackWarningTransport struct {
+	base http.RoundTripper
+}
+
+func (t *slackWarningTransport) RoundTrip(req *http.Request) (resp *http.Response, err error) {
+	resp, err = t.base.RoundTrip(req)
+	if err != nil || !strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json") {
+		return
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	closeErr := resp.Body.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	var warnings SlackResponseWarnings
+	if json.Unmarshal(body, &warnings) != nil {
+		return
+	}
+	if warnings.Warning != "" || len(warnings.ResponseMetadata.Warnings) > 0 {
+		slog.Warn("got warnings from slack api", "method", req.URL.Path, "warning", warnings.Warning, "warnings", warnings.ResponseMetadata.Warnings)
+	}
+	return
+}
+
+// logDebugRequest logs the request with its body, never printing the credentials in its headers
+func logDebugRequest(req *http.Request, body string) {
+	slog.Info("sending request", "method", req.Method, "url", req.URL)
+	for name, values := range req.Header {
+		if strings.EqualFold(name, "Authorization") {
+			values = []string{RedactedValue}
+		}
+		slog.Info("request header", "name", name, "value", strings.Join(values, ", "))
+	}
+	slog.Info("request body", "body", truncateDebugBody(body))
+}
+
+func logDebugResponse(resp *http.Response, body []byte) {
+	slog.Info("got response", "status", resp.Status)
+	slog.Info("response body", "body", truncateDebugBody(string(body)))
+}
+
+func truncateDebugBody(body string) string {
+	if len(body) <= DebugBodyMaxLength {
+		return body
+	}
+	return body[:DebugBodyMaxLength] + fmt.Sprintf("... (%d bytes truncated)", len(body)-DebugBodyMaxLength)
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// roundTripFunc lets a function stand in for the transport of an HTTP client
+type roundTripFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// captureLogs sends the logs of the test to the returned buffer, as text, and restores the default logger after it
+func captureLogs(t *testing.T) *bytes.Buffer {
+	var logs bytes.Buffer
+	defaultLogger := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&logs, nil)))
+	t.Cleanup(func() { slog.SetDefault(defaultLogger) })
+	return &logs
+}
+
+func TestGetSlackClientUsesHTTPClient(t *testing.T) {
+	logs := captureLogs(t)
+	var requests []string
+	httpClient := &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		requests = append(requests, req.URL.Path)
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": []string{"application/json"}},
+			Body:       io.NopCloser(strings.NewReader(`{"ok": true, "user_id": "U0BOT", "warning": "superfluous_charset"}`)),
+			Request:    req,
+		}, nil
+	})}
+
+	client := getSlackClient(Config{SlackAccessToken: "xoxb-test"}, httpClient)
+	resp, err := client.AuthTest()
+	if err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	if resp.UserID != "U0BOT" {
+		t.Errorf("got user ID %q, want U0BOT", resp.UserID)
+	}
+	if len(requests) != 1 || requests[0] != "/api/auth.test" {
+		t.Errorf("got requests %v, want a single auth.test through the shared client", requests)
+	}
+	if _, ok := httpClient.Transport.(*slackWarningTransport); ok {
+		t.Error("got the transport of the shared client replaced, GitHub calls would go through the slack warnings")
+	}
+	for _, want := range []string{"level=WARN", `msg="got warnings from slack api"`, "method=/api/auth.test", "warning=superfluous_charset"} {
+		if !strings.Contains(logs.String(), want) {
+			t.Errorf("got logs %q, want them to contain %q", logs.String(), want)
+		}
+	}
+}
+
+func TestBuildHTTPClient(t *testing.T) {
+	client, err := buildHTTPClient(Config{HTTPTimeoutSeconds: 7})
+	if err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	if client.Timeout != 7*time.Second {
+		t.Errorf("got timeout %s, want 7s", client.Timeout)
+	}
+	transport, ok := client.Transport.(*http.Transport)
+	if !ok || transport.Proxy == nil {
+		t.Errorf("got transport %T, want an *http.Transport honouring the proxy environment", client.Transport)
+	}
+
+	_, err = buildHTTPClient(Config{CACertFile: filepath.Join(t.TempDir(), "missing.pem")})
+	if err == nil {
+		t.Error("got no error for a missing CA cert file")
+	}
+
+	notPEM := filepath.Join(t.TempDir(), "ca.pem")
+	err = os.WriteFile(notPEM, []byte("not a certificate"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = buildHTTPClient(Config{CACertFile: notPEM})
+	if err == nil {
+		t.Error("got no error for a CA cert file without PEM certificates")
+	}
+}
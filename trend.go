@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/slack-go/slack"
+)
+
+const (
+	// TrendBarWidth, TrendBarGap and TrendHeight size the trend image, small enough to sit in a thread
+	TrendBarWidth = 8
+	TrendBarGap   = 2
+	TrendHeight   = 32
+	// TrendMaxRuns caps how many of the runs of TREND_DATA are drawn, the most recent ones
+	TrendMaxRuns = 50
+)
+
+var (
+	trendSuccessColor = color.RGBA{R: 0x2e, G: 0xb8, B: 0x86, A: 0xff}
+	trendFailureColor = color.RGBA{R: 0xa3, G: 0x00, B: 0x00, A: 0xff}
+	trendOtherColor   = color.RGBA{R: 0xbb, G: 0xbb, B: 0xbb, A: 0xff}
+)
+
+// buildTrend reads TREND_DATA, a JSON array of the conclusions of the last runs from oldest to newest, e.g.
+// ["success", "failure", "success"]
+func buildTrend() (conclusions []string, err error) {
+	trendData := os.Getenv("TREND_DATA")
+	if trendData == "" {
+		return
+	}
+	err = json.Unmarshal([]byte(trendData), &conclusions)
+	for i := range conclusions {
+		conclusions[i] = strings.ToLower(conclusions[i])
+	}
+	return
+}
+
+// renderTrendPNG draws a bar per run, full height and green for successes, full height and red for failures and half
+// height and grey for anything else, like cancelled runs
+func renderTrendPNG(config Config, conclusions []string) (content []byte, err error) {
+	if len(conclusions) == 0 {
+		err = errors.New("no runs to draw")
+		return
+	}
+	if len(conclusions) > TrendMaxRuns {
+		conclusions = conclusions[len(conclusions)-TrendMaxRuns:]
+	}
+
+	width := len(conclusions)*(TrendBarWidth+TrendBarGap) - TrendBarGap
+	img := image.NewRGBA(image.Rect(0, 0, width, TrendHeight))
+	for i, conclusion := range conclusions {
+		status := CommitStatus{Conclusion: conclusion}
+		barColor, barHeight := trendOtherColor, TrendHeight/2
+		switch {
+		case status.Succeeded():
+			barColor, barHeight = trendSuccessColor, TrendHeight
+		case status.Failed(config.FailureConclusions):
+			barColor, barHeight = trendFailureColor, TrendHeight
+		}
+		left := i * (TrendBarWidth + TrendBarGap)
+		for x := left; x < left+TrendBarWidth; x++ {
+			for y := TrendHeight - barHeight; y < TrendHeight; y++ {
+				img.Set(x, y, barColor)
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	err = png.Encode(&buf, img)
+	content = buf.Bytes()
+	return
+}
+
+// uploadTrend uploads the trend image in the thread of the posted message. It is only a nice to have, so errors are
+// logged and not returned.
+func uploadTrend(ctx context.Context, config Config, client *slack.Client, ref MessageRef, conclusions []string) {
+	content, err := renderTrendPNG(config, conclusions)
+	if err != nil {
+		slog.Warn("got error rendering trend image", "error", err)
+		return
+	}
+
+	failures := 0
+	for _, conclusion := range conclusions {
+		if (CommitStatus{Conclusion: conclusion}).Failed(config.FailureConclusions) {
+			failures++
+		}
+	}
+	_, err = client.UploadFileV2Context(ctx, slack.UploadFileV2Parameters{
+		Reader:          bytes.NewReader(content),
+		FileSize:        len(content),
+		Filename:        "trend.png",
+		Title:           "Build trend",
+		AltTxt:          fmt.Sprintf("%d failures in the last %d runs", failures, len(conclusions)),
+		Channel:         ref.Channel,
+		ThreadTimestamp: ref.Ts,
+	})
+	if err != nil {
+		logScopeError(err, "files:write")
+		slog.Warn("got error uploading trend image", "error", err)
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"image/color"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+func TestRenderTrendPNG(t *testing.T) {
+	config := Config{FailureConclusions: []string{"failure", "error"}}
+	content, err := renderTrendPNG(config, []string{"success", "failure", "cancelled"})
+	if err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	img, err := png.Decode(bytes.NewReader(content))
+	if err != nil {
+		t.Fatalf("got invalid PNG: %v", err)
+	}
+	size := img.Bounds().Size()
+	if want := 3*TrendBarWidth + 2*TrendBarGap; size.X != want || size.Y != TrendHeight {
+		t.Errorf("got size %v, want %dx%d", size, want, TrendHeight)
+	}
+
+	colorAt := func(x, y int) color.RGBA {
+		return color.RGBAModel.Convert(img.At(x, y)).(color.RGBA)
+	}
+	bar := func(i int) int { return i * (TrendBarWidth + TrendBarGap) }
+	pixels := []struct {
+		name string
+		x, y int
+		want color.RGBA
+	}{
+		{name: "top of the success bar", x: bar(0), y: 0, want: trendSuccessColor},
+		{name: "top of the failure bar", x: bar(1) + TrendBarWidth - 1, y: 0, want: trendFailureColor},
+		{name: "above the cancelled bar", x: bar(2), y: TrendHeight/2 - 1, want: color.RGBA{}},
+		{name: "top of the cancelled bar", x: bar(2), y: TrendHeight / 2, want: trendOtherColor},
+		{name: "gap", x: bar(1) - 1, y: TrendHeight - 1, want: color.RGBA{}},
+	}
+	for _, pixel := range pixels {
+		if got := colorAt(pixel.x, pixel.y); got != pixel.want {
+			t.Errorf("%s: got color %v at %d,%d, want %v", pixel.name, got, pixel.x, pixel.y, pixel.want)
+		}
+	}
+}
+
+func TestRenderTrendPNGKeepsTheLastRuns(t *testing.T) {
+	conclusions := strings.Split(strings.Repeat("failure,", TrendMaxRuns)+"success", ",")
+	content, err := renderTrendPNG(Config{FailureConclusions: []string{"failure"}}, conclusions)
+	if err != nil {
+		t.Fatalf("got error %v", err)
+	}
+	img, err := png.Decode(bytes.NewReader(content))
+	if err != nil {
+		t.Fatalf("got invalid PNG: %v", err)
+	}
+	if got, want := img.Bounds().Dx(), TrendMaxRuns*(TrendBarWidth+TrendBarGap)-TrendBarGap; got != want {
+		t.Errorf("got width %d, want %d", got, want)
+	}
+	last := color.RGBAModel.Convert(img.At(img.Bounds().Dx()-1, 0)).(color.RGBA)
+	if last != trendSuccessColor {
+		t.Errorf("got color %v for the last bar, want the most recent run", last)
+	}
+
+	_, err = renderTrendPNG(Config{}, nil)
+	if err == nil {
+		t.Error("got no error without runs")
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+
+	"github.com/slack-go/slack"
+)
+
+// MessageRef identifies a previously posted message, so it can be updated
+type MessageRef struct {
+	Channel string `json:"channel"`
+	Ts      string `json:"ts"`
+}
+
+// buildMessageRefs reads the messages to update from SLACK_MESSAGE_REFS, a JSON array of {channel, ts} objects
+func buildMessageRefs() (messageRefs []MessageRef, err error) {
+	messageRefsJSON := os.Getenv("SLACK_MESSAGE_REFS")
+	if messageRefsJSON == "" {
+		return
+	}
+	err = json.Unmarshal([]byte(messageRefsJSON), &messageRefs)
+	if err != nil {
+		return
+	}
+	for _, messageRef := range messageRefs {
+		if messageRef.Channel == "" || messageRef.Ts == "" {
+			err = fmt.Errorf("message ref %+v needs both a channel and a ts", messageRef)
+			return
+		}
+	}
+	return
+}
+
+// updateMessages replaces the text of every referenced message, going on with the rest if one fails. It returns the
+// messages that were updated, and an error joining the errors of all the failed updates.
+func updateMessages(ctx context.Context, config Config, client *slack.Client, messageRefs []MessageRef, message string) (updated []MessageRef, err error) {
+	updateErrs := runConcurrently(ctx, config.PostConcurrency, len(messageRefs), func(i int) (err error) {
+		messageRef := messageRefs[i]
+		err = updateMessage(ctx, config, client, messageRef, message)
+		if err != nil {
+			slog.Error("got error updating slack message", "channel", messageRef.Channel, "ts", messageRef.Ts, "error", err)
+			err = fmt.Errorf("updating message %s in %s: %w", messageRef.Ts, messageRef.Channel, err)
+			return
+		}
+		slog.Info("message updated", "channel", messageRef.Channel, "timestamp", messageRef.Ts)
+		return
+	})
+	for i, updateErr := range updateErrs {
+		if updateErr == nil {
+			updated = append(updated, messageRefs[i])
+		}
+	}
+	err = errors.Join(updateErrs...)
+	return
+}
+
+// runConcurrently calls fn for every index from 0 to n, at most limit at a time so posting to many targets is fast
+// without hitting Slack rate limits. Indexes not started when the context is done fail with its error. The errors are
+// returned in index order, nil for the calls that succeeded.
+func runConcurrently(ctx context.Context, limit, n int, fn func(i int) error) (errs []error) {
+	if limit < 1 {
+		limit = 1
+	}
+	errs = make([]error, n)
+	slots := make(chan struct{}, limit)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		acquired := false
+		select {
+		case slots <- struct{}{}:
+			acquired = true
+		case <-ctx.Done():
+		}
+		// select picks at random when a slot frees up after the context is done, so check it either way
+		if ctx.Err() != nil {
+			if acquired {
+				<-slots
+			}
+			errs[i] = ctx.Err()
+			continue
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
+			errs[i] = fn(i)
+		}(i)
+	}
+	wg.Wait()
+	return
+}
+
+func updateMessage(ctx context.Context, config Config, client *slack.Client, messageRef MessageRef, message string) error {
+	return buildSlackRetryPolicy(config).retry(ctx, func(ctx context.Context) error {
+		_, _, _, err := client.UpdateMessageContext(ctx, messageRef.Channel, messageRef.Ts,
+			slack.MsgOptionText(message, false),
+			slack.MsgOptionAsUser(true))
+		return classifySlackError(err)
+	})
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRunConcurrently(t *testing.T) {
+	tests := []struct {
+		name    string
+		limit   int
+		n       int
+		wantMax int32
+	}{
+		{name: "below the limit", limit: 5, n: 3, wantMax: 3},
+		{name: "above the limit", limit: 3, n: 10, wantMax: 3},
+		{name: "sequential", limit: 1, n: 4, wantMax: 1},
+		{name: "limit below one", limit: 0, n: 4, wantMax: 1},
+		{name: "nothing to run", limit: 3, n: 0, wantMax: 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var inFlight, maxInFlight, calls atomic.Int32
+			errs := runConcurrently(context.Background(), test.limit, test.n, func(i int) error {
+				calls.Add(1)
+				current := inFlight.Add(1)
+				defer inFlight.Add(-1)
+				for {
+					seen := maxInFlight.Load()
+					if current <= seen || maxInFlight.CompareAndSwap(seen, current) {
+						break
+					}
+				}
+				// Long enough for the other calls to start if the limit let them
+				time.Sleep(10 * time.Millisecond)
+				if i%2 == 1 {
+					return fmt.Errorf("call %d failed", i)
+				}
+				return nil
+			})
+
+			if got := calls.Load(); got != int32(test.n) {
+				t.Errorf("got %d calls, want %d", got, test.n)
+			}
+			if got := maxInFlight.Load(); got != test.wantMax {
+				t.Errorf("got at most %d calls at a time, want %d", got, test.wantMax)
+			}
+			if len(errs) != test.n {
+				t.Fatalf("got %d errors, want one per call", len(errs))
+			}
+			for i, err := range errs {
+				want := ""
+				if i%2 == 1 {
+					want = fmt.Sprintf("call %d failed", i)
+				}
+				if (err == nil && want != "") || (err != nil && err.Error() != want) {
+					t.Errorf("call %d: got error %v, want %q", i, err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestRunConcurrentlyStopsWhenContextIsDone(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var calls atomic.Int32
+	errs := runConcurrently(ctx, 1, 3, func(i int) error {
+		calls.Add(1)
+		cancel()
+		return nil
+	})
+	if got := calls.Load(); got != 1 {
+		t.Errorf("got %d calls, want only the one started before the cancel", got)
+	}
+	if errs[0] != nil || !errors.Is(errs[1], context.Canceled) || !errors.Is(errs[2], context.Canceled) {
+		t.Errorf("got errors %v, want the calls not started to fail with the context error", errs)
+	}
+}
+
+func TestUpdateMessages(t *testing.T) {
+	api := &fakeSlackAPI{handlers: map[string]func(r *http.Request) map[string]any{
+		"chat.update": func(r *http.Request) map[string]any {
+			if r.Form.Get("channel") == "C0GONE" {
+				return map[string]any{"ok": false, "error": "message_not_found"}
+			}
+			return map[string]any{"ok": true, "channel": r.Form.Get("channel"), "ts": r.Form.Get("ts"), "text": r.Form.Get("text")}
+		},
+	}}
+	client := newFakeSlackClient(t, api)
+	messageRefs := []MessageRef{
+		{Channel: "C0CI", Ts: "1700000000.000100"},
+		{Channel: "C0GONE", Ts: "1700000000.000200"},
+		{Channel: "C0DEPLOYS", Ts: "1700000000.000300"},
+	}
+
+	updated, err := updateMessages(context.Background(), Config{PostConcurrency: 2}, client, messageRefs, "build fixed")
+	wantUpdated := []MessageRef{messageRefs[0], messageRefs[2]}
+	if !reflect.DeepEqual(updated, wantUpdated) {
+		t.Errorf("got updated %+v, want %+v", updated, wantUpdated)
+	}
+	if !isSlackError(err, "message_not_found") || !strings.Contains(err.Error(), "1700000000.000200 in C0GONE") {
+		t.Errorf("got error %v, want the failed update", err)
+	}
+
+	got := map[string]string{}
+	channels, timestamps, texts := api.formValues("chat.update", "channel"), api.formValues("chat.update", "ts"), api.formValues("chat.update", "text")
+	for i := range channels {
+		got[channels[i]+"/"+timestamps[i]] = texts[i]
+	}
+	want := map[string]string{
+		"C0CI/1700000000.000100":      "build fixed",
+		"C0GONE/1700000000.000200":    "build fixed",
+		"C0DEPLOYS/1700000000.000300": "build fixed",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got updates %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+var (
+	errUserNotFound = errors.New("no slack user")
+	// errUserNotFoundBefore is returned for the emails already looked up in vain, whose error was logged then
+	errUserNotFoundBefore = errors.New("slack user not found in a previous lookup")
+)
+
+// SlackUserResolver finds the Slack user behind a commit author, trying each of the configured strategies in turn
+type SlackUserResolver struct {
+	// ctx is the context of the run, so lookups are cancelled with it
+	ctx             context.Context
+	client          *slack.Client
+	githubFieldID   string
+	botAuthorRegexp *regexp.Regexp
+	// retryPolicy applies to lookups, so a network error doesn't silently lose the mention
+	retryPolicy RetryPolicy
+	// allowedDomains are the lowercase email domains whose authors may be mentioned, any if empty
+	allowedDomains []string
+
+	// users is the workspace user list, loaded at most once per run since GetUsers is expensive
+	users       []slack.User
+	usersLoaded bool
+	// usersByEmail caches the users found by lowercase email, from lookups or from the user list, and nil for the
+	// emails no user was found for
+	usersByEmail map[string]*slack.User
+	// missingScopeErr is the missing_scope error of the first lookup by email, after which emails are only searched in
+	// the user list
+	missingScopeErr error
+
+	// resolvedUserIDs are the IDs of the users found so far
+	resolvedUserIDs []string
+	// unresolvedAuthors are the GitHub usernames, or emails if unknown, of the authors looked up but not found. Bots
+	// and authors of domains not allowed are not looked up.
+	unresolvedAuthors []string
+}
+
+func newSlackUserResolver(ctx context.Context, config Config, client *slack.Client) *SlackUserResolver {
+	return &SlackUserResolver{
+		ctx:             ctx,
+		client:          client,
+		githubFieldID:   config.SlackGithubFieldID,
+		botAuthorRegexp: config.BotAuthorRegexp,
+		retryPolicy:     buildSlackRetryPolicy(config),
+		allowedDomains:  config.AllowedMentionDomains,
+		usersByEmail:    map[string]*slack.User{},
+	}
+}
+
+// resolveUser returns the Slack user for the author, or nil if no strategy found one
+func (r *SlackUserResolver) resolveUser(authorEmail, githubUsername string) (slackUser *slack.User) {
+	defer func() {
+		if slackUser != nil && slackUser.ID != "" && !slices.Contains(r.resolvedUserIDs, slackUser.ID) {
+			r.resolvedUserIDs = append(r.resolvedUserIDs, slackUser.ID)
+		}
+	}()
+
+	if r.botAuthorRegexp != nil && r.botAuthorRegexp.MatchString(githubUsername) {
+		slog.Debug("author is a bot, skipping slack user lookup", "author", githubUsername)
+		return
+	}
+	// External contributors may share an email or username with someone unrelated in the workspace
+	if !r.isAllowedDomain(authorEmail) {
+		slog.Debug("author email domain is not allowed for mentions, skipping slack user lookup", "email", authorEmail)
+		return
+	}
+
+	slackUser, err := r.findUserByEmail(authorEmail)
+	if err == nil {
+		slackUser = r.completeUserID(slackUser)
+		return
+	}
+	if !errors.Is(err, errUserNotFoundBefore) {
+		logScopeError(err, "users:read.email")
+		slog.Warn("got error getting slack user by email", "error", err)
+	}
+	slackUser = nil
+
+	if r.githubFieldID != "" {
+		slackUser, err = r.findUserByGithubUsername(githubUsername)
+		if err == nil {
+			return
+		}
+		logScopeError(err, "users:read")
+		slog.Warn("got error getting slack user by github username profile field", "error", err)
+		slackUser = nil
+	}
+
+	unresolvedAuthor := githubUsername
+	if unresolvedAuthor == "" {
+		unresolvedAuthor = authorEmail
+	}
+	if !slices.Contains(r.unresolvedAuthors, unresolvedAuthor) {
+		r.unresolvedAuthors = append(r.unresolvedAuthors, unresolvedAuthor)
+	}
+	return
+}
+
+// isAllowedDomain reports whether the email is on one of the allowed domains, or true if any domain is allowed
+func (r *SlackUserResolver) isAllowedDomain(email string) bool {
+	if len(r.allowedDomains) == 0 {
+		return true
+	}
+	_, domain, found := strings.Cut(email, "@")
+	return found && slices.Contains(r.allowedDomains, strings.ToLower(domain))
+}
+
+// buildGreeting returns a greeting for the time of day of the user, e.g. "Good morning", or "" when their timezone is
+// unknown
+func buildGreeting(slackUser *slack.User, now time.Time) string {
+	if slackUser == nil || slackUser.TZ == "" {
+		return ""
+	}
+	location, err := time.LoadLocation(slackUser.TZ)
+	if err != nil {
+		slog.Warn("got invalid slack user timezone, not greeting", "tz", slackUser.TZ, "error", err)
+		return ""
+	}
+
+	hour := now.In(location).Hour()
+	switch {
+	case hour >= 5 && hour < 12:
+		return "Good morning"
+	case hour >= 12 && hour < 18:
+		return "Good afternoon"
+	default:
+		return "Good evening"
+	}
+}
+
+// logScopeError explains a missing_scope error, since the bare code doesn't tell users how to fix their Slack app
+func logScopeError(err error, scope string) {
+	if isSlackError(err, "missing_scope") {
+		slog.Error("slack token is missing a scope, add it to the slack app and reinstall it", "scope", scope)
+	}
+}
+
+// findUserByEmail looks the user up by email, skipping the API call when the email is malformed since odd commit
+// metadata can carry anything. Found users are cached, so digests don't look the same author up for every commit.
+// Without the users:read.email scope the emails are searched in the user list instead, where the workspace lets
+// them be seen.
+func (r *SlackUserResolver) findUserByEmail(email string) (slackUser *slack.User, err error) {
+	if !looksLikeEmail(email) {
+		err = fmt.Errorf("%q does not look like an email, skipping lookup", email)
+		return
+	}
+	key := strings.ToLower(email)
+	if cachedUser, ok := r.usersByEmail[key]; ok {
+		slackUser = cachedUser
+		if slackUser == nil {
+			err = errUserNotFoundBefore
+		}
+		return
+	}
+
+	if r.missingScopeErr != nil {
+		slackUser, err = r.findUserByEmailInUserList(key, r.missingScopeErr)
+	} else {
+		slackUser, err = getUserByEmail(r.ctx, r.retryPolicy, r.client, email)
+		if isSlackError(err, "missing_scope") {
+			r.missingScopeErr = err
+			slackUser, err = r.findUserByEmailInUserList(key, err)
+		}
+	}
+	if errors.Is(err, errUserNotFound) || isSlackError(err, "users_not_found") || isSlackError(err, "missing_scope") {
+		r.usersByEmail[key] = nil
+	}
+	if err != nil {
+		return
+	}
+	r.usersByEmail[key] = slackUser
+	return
+}
+
+// getUserByEmail looks the user up, retrying network and server errors. Slack errors like users_not_found are final.
+func getUserByEmail(ctx context.Context, retryPolicy RetryPolicy, client *slack.Client, email string) (slackUser *slack.User, err error) {
+	err = retryPolicy.retry(ctx, func(ctx context.Context) (err error) {
+		slackUser, err = client.GetUserByEmailContext(ctx, email)
+		return classifySlackError(err)
+	})
+	return
+}
+
+// findUserByEmailInUserList looks for the lowercase email among the user profiles, returning lookupErr if no email is
+// visible at all, as the user list is then no substitute for the lookup
+func (r *SlackUserResolver) findUserByEmailInUserList(email string, lookupErr error) (slackUser *slack.User, err error) {
+	users, err := r.getUsers()
+	if err != nil {
+		return
+	}
+
+	emailsVisible := false
+	for i := range users {
+		if users[i].Profile.Email == "" {
+			continue
+		}
+		emailsVisible = true
+		r.usersByEmail[strings.ToLower(users[i].Profile.Email)] = &users[i]
+	}
+	if !emailsVisible {
+		err = lookupErr
+		return
+	}
+
+	slackUser, ok := r.usersByEmail[email]
+	if !ok {
+		err = fmt.Errorf("%w with email %s", errUserNotFound, email)
+	}
+	return
+}
+
+// completeUserID looks up the ID of a user Slack returned with a handle only, since a bare @handle in a message does
+// not ping anyone. The user is returned as is if the handle is not in the user list.
+func (r *SlackUserResolver) completeUserID(slackUser *slack.User) *slack.User {
+	if slackUser == nil || slackUser.ID != "" || slackUser.Name == "" {
+		return slackUser
+	}
+	users, err := r.getUsers()
+	if err != nil {
+		slog.Warn("got error listing slack users, the author will be named but not pinged", "handle", slackUser.Name, "error", err)
+		return slackUser
+	}
+	for i := range users {
+		if users[i].Name == slackUser.Name && users[i].ID != "" {
+			return &users[i]
+		}
+	}
+	slog.Warn("slack user handle not found in the user list, the author will be named but not pinged", "handle", slackUser.Name)
+	return slackUser
+}
+
+// findUserByGithubUsername looks for a user whose profile field with the configured ID holds the GitHub username
+func (r *SlackUserResolver) findUserByGithubUsername(githubUsername string) (slackUser *slack.User, err error) {
+	users, err := r.getUsers()
+	if err != nil {
+		return
+	}
+
+	for i := range users {
+		field, ok := users[i].Profile.Fields.ToMap()[r.githubFieldID]
+		if !ok {
+			continue
+		}
+		// GitHub usernames are case-insensitive, and people tend to write them with a leading @
+		if strings.EqualFold(strings.TrimPrefix(strings.TrimSpace(field.Value), "@"), githubUsername) {
+			slackUser = &users[i]
+			return
+		}
+	}
+	err = fmt.Errorf("no slack user with github username %s", githubUsername)
+	return
+}
+
+func (r *SlackUserResolver) getUsers() (users []slack.User, err error) {
+	if r.usersLoaded {
+		users = r.users
+		return
+	}
+
+	err = r.retryPolicy.retry(r.ctx, func(ctx context.Context) (err error) {
+		users, err = r.client.GetUsersContext(ctx)
+		return classifySlackError(err)
+	})
+	if err != nil {
+		return
+	}
+	r.users = users
+	r.usersLoaded = true
+	return
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+// newFakeUserDirectory returns a resolver finding the users by email in the fake Slack API, by lowercase email to ID
+func newFakeUserDirectory(t *testing.T, config Config, usersByEmail map[string]string) (*SlackUserResolver, *fakeSlackAPI) {
+	api := &fakeSlackAPI{handlers: map[string]func(r *http.Request) map[string]any{
+		"users.lookupByEmail": func(r *http.Request) map[string]any {
+			email := strings.ToLower(r.Form.Get("email"))
+			id, ok := usersByEmail[email]
+			if !ok {
+				return map[string]any{"ok": false, "error": "users_not_found"}
+			}
+			return map[string]any{"ok": true, "user": map[string]any{"id": id, "name": strings.Split(email, "@")[0]}}
+		},
+	}}
+	return newSlackUserResolver(context.Background(), config, newFakeSlackClient(t, api)), api
+}
+
+func TestFindUserByEmailCachesMissingScopeAndNotFound(t *testing.T) {
+	api := &fakeSlackAPI{responses: map[string][]map[string]any{
+		"users.lookupByEmail": {{"ok": false, "error": "missing_scope"}},
+		"users.list": {{"ok": true, "members": []map[string]any{
+			{"id": "U0JANE", "profile": map[string]any{"email": "Jane@example.com"}},
+			{"id": "U0JOHN", "profile": map[string]any{"email": "john@example.com"}},
+		}}},
+	}}
+	resolver := newSlackUserResolver(context.Background(), Config{}, newFakeSlackClient(t, api))
+
+	tests := []struct {
+		email   string
+		wantID  string
+		wantErr error
+	}{
+		{email: "jane@example.com", wantID: "U0JANE"},
+		{email: "john@example.com", wantID: "U0JOHN"},
+		{email: "ghost@example.com", wantErr: errUserNotFound},
+		{email: "ghost@example.com", wantErr: errUserNotFoundBefore},
+	}
+	for _, test := range tests {
+		slackUser, err := resolver.findUserByEmail(test.email)
+		if !errors.Is(err, test.wantErr) || (test.wantErr == nil && err != nil) {
+			t.Errorf("%s: got error %v, want %v", test.email, err, test.wantErr)
+			continue
+		}
+		if test.wantID != "" && (slackUser == nil || slackUser.ID != test.wantID) {
+			t.Errorf("%s: got user %+v, want %s", test.email, slackUser, test.wantID)
+		}
+	}
+	if got := api.callCount("users.lookupByEmail"); got != 1 {
+		t.Errorf("got %d lookups by email, want 1 before falling back to the user list", got)
+	}
+	if got := api.callCount("users.list"); got != 1 {
+		t.Errorf("got %d user list loads, want 1", got)
+	}
+}
+
+func TestGetUserByEmailRetriesTransientErrors(t *testing.T) {
+	tests := []struct {
+		name         string
+		failures     []int
+		slackError   string
+		wantAttempts int32
+		wantErr      bool
+	}{
+		{name: "server error then found", failures: []int{http.StatusInternalServerError}, wantAttempts: 2},
+		{name: "rate limited then found", failures: []int{http.StatusTooManyRequests}, wantAttempts: 2},
+		{name: "server errors until giving up", failures: []int{http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway}, wantAttempts: 3, wantErr: true},
+		{name: "client error is final", failures: []int{http.StatusForbidden}, wantAttempts: 1, wantErr: true},
+		{name: "users_not_found is final", slackError: "users_not_found", wantAttempts: 1, wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var attempts atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				attempt := int(attempts.Add(1))
+				if attempt <= len(test.failures) {
+					w.Header().Set("Retry-After", "0")
+					w.WriteHeader(test.failures[attempt-1])
+					return
+				}
+				w.Header().Set("Content-Type", "application/json")
+				if test.slackError != "" {
+					_ = json.NewEncoder(w).Encode(map[string]any{"ok": false, "error": test.slackError})
+					return
+				}
+				_ = json.NewEncoder(w).Encode(map[string]any{"ok": true, "user": map[string]any{"id": "U0JANE"}})
+			}))
+			defer server.Close()
+			client := slack.New("xoxb-test", slack.OptionAPIURL(server.URL+"/"))
+			retryPolicy := RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxElapsed: time.Second}
+
+			slackUser, err := getUserByEmail(context.Background(), retryPolicy, client, "jane@example.com")
+			if got := attempts.Load(); got != test.wantAttempts {
+				t.Errorf("got %d attempts, want %d", got, test.wantAttempts)
+			}
+			if test.wantErr {
+				if err == nil {
+					t.Errorf("got user %+v, want an error", slackUser)
+				}
+				return
+			}
+			if err != nil || slackUser == nil || slackUser.ID != "U0JANE" {
+				t.Errorf("got user %+v and error %v, want U0JANE", slackUser, err)
+			}
+		})
+	}
+}
+
+func TestBuildGreeting(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name      string
+		slackUser *slack.User
+		want      string
+	}{
+		{name: "no user", slackUser: nil, want: ""},
+		{name: "no timezone", slackUser: &slack.User{}, want: ""},
+		{name: "invalid timezone", slackUser: &slack.User{TZ: "Mars/Olympus_Mons"}, want: ""},
+		{name: "morning", slackUser: &slack.User{TZ: "America/New_York"}, want: "Good morning"},
+		{name: "afternoon", slackUser: &slack.User{TZ: "Europe/Madrid"}, want: "Good afternoon"},
+		{name: "evening", slackUser: &slack.User{TZ: "Asia/Tokyo"}, want: "Good evening"},
+	}
+	for _, test := range tests {
+		if got := buildGreeting(test.slackUser, now); got != test.want {
+			t.Errorf("%s: got %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestResolveUserCompletesHandleWithID(t *testing.T) {
+	tests := []struct {
+		name    string
+		members []map[string]any
+		wantID  string
+	}{
+		{name: "handle in the user list", members: []map[string]any{{"id": "U0JANE", "name": "jane"}}, wantID: "U0JANE"},
+		{name: "handle not in the user list", members: []map[string]any{{"id": "U0JOHN", "name": "john"}}, wantID: ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			api := &fakeSlackAPI{responses: map[string][]map[string]any{
+				"users.lookupByEmail": {{"ok": true, "user": map[string]any{"name": "jane"}}},
+				"users.list":          {{"ok": true, "members": test.members}},
+			}}
+			resolver := newSlackUserResolver(context.Background(), Config{}, newFakeSlackClient(t, api))
+			slackUser := resolver.resolveUser("jane@example.com", "jdoe")
+			if slackUser == nil || slackUser.ID != test.wantID || slackUser.Name != "jane" {
+				t.Errorf("got user %+v, want ID %q and handle jane", slackUser, test.wantID)
+			}
+		})
+	}
+}
+
+func TestResolveUserSkipsBots(t *testing.T) {
+	tests := []struct {
+		name     string
+		pattern  string
+		username string
+		wantBot  bool
+	}{
+		{name: "default pattern, app account", username: "dependabot[bot]", wantBot: true},
+		{name: "default pattern, user", username: "jdoe", wantBot: false},
+		{name: "default pattern, bot in the middle", username: "renovate[bot]-fork", wantBot: false},
+		{name: "custom pattern", pattern: `^svc-`, username: "svc-deploy", wantBot: true},
+		{name: "custom pattern replaces the default", pattern: `^svc-`, username: "dependabot[bot]", wantBot: false},
+		{name: "invalid pattern falls back to the default", pattern: `[`, username: "dependabot[bot]", wantBot: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Setenv("BOT_AUTHOR_PATTERN", test.pattern)
+			config := buildConfig()
+			resolver, api := newFakeUserDirectory(t, config, map[string]string{"jane@example.com": "U0JANE"})
+
+			slackUser := resolver.resolveUser("jane@example.com", test.username)
+			if gotBot := slackUser == nil; gotBot != test.wantBot {
+				t.Errorf("got user %+v, want bot %t", slackUser, test.wantBot)
+			}
+			if lookups := api.callCount("users.lookupByEmail"); test.wantBot && lookups != 0 {
+				t.Errorf("got %d lookups, want none for a bot", lookups)
+			}
+		})
+	}
+}
+
+func TestIsAllowedDomain(t *testing.T) {
+	tests := []struct {
+		name           string
+		allowedDomains []string
+		email          string
+		want           bool
+	}{
+		{name: "empty allowlist", email: "jane@gmail.com", want: true},
+		{name: "empty allowlist without @", email: "jdoe", want: true},
+		{name: "allowed", allowedDomains: []string{"example.com", "example.org"}, email: "jane@example.org", want: true},
+		{name: "case", allowedDomains: []string{"example.com"}, email: "Jane@EXAMPLE.com", want: true},
+		{name: "other domain", allowedDomains: []string{"example.com"}, email: "jane@gmail.com", want: false},
+		{name: "subdomain", allowedDomains: []string{"example.com"}, email: "jane@eng.example.com", want: false},
+		{name: "listed subdomain", allowedDomains: []string{"example.com", "eng.example.com"}, email: "jane@eng.example.com", want: true},
+		{name: "suffix", allowedDomains: []string{"example.com"}, email: "jane@notexample.com", want: false},
+		{name: "without @", allowedDomains: []string{"example.com"}, email: "example.com", want: false},
+		{name: "empty email", allowedDomains: []string{"example.com"}, email: "", want: false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resolver := newSlackUserResolver(context.Background(), Config{AllowedMentionDomains: test.allowedDomains}, nil)
+			if got := resolver.isAllowedDomain(test.email); got != test.want {
+				t.Errorf("got %t, want %t", got, test.want)
+			}
+		})
+	}
+}
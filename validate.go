@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/slack-go/slack"
+)
+
+const (
+	ModeTest = "test"
+
+	// TestNotificationText is the message posted by MODE=test, worded so nobody takes it for a real failure
+	TestNotificationText = ":wave: Test notification from actions-notify-slack"
+)
+
+// ValidationCheck is the outcome of one check of VALIDATE_ONLY
+type ValidationCheck struct {
+	Name   string
+	Detail string
+	Err    error
+}
+
+// runTestNotification posts the test message to the configured channel, checking the token, channel and posting
+// scope end to end, unlike VALIDATE_ONLY which only reads
+func runTestNotification(ctx context.Context, config Config, client *slack.Client, summary *RunSummary) (err error) {
+	respChannel, respTimestamp, err := sendMessageToChannel(ctx, config, client, config.SlackChannelName, TestNotificationText, buildThreadOptions(config)...)
+	if err != nil {
+		return
+	}
+	summary.addMessage(respChannel, respTimestamp)
+	slog.Info("test notification sent", "channel", respChannel, "timestamp", respTimestamp)
+	return
+}
+
+// runValidation checks the token, channel and author lookup against the Slack API without posting anything, only
+// calling read methods, and prints a report. It returns an error if any check failed.
+func runValidation(ctx context.Context, config Config, client *slack.Client, commit Commit) (err error) {
+	var checks []ValidationCheck
+
+	auth, authErr := client.AuthTestContext(ctx)
+	authCheck := ValidationCheck{Name: "slack token", Err: wrapSlackAuthError(authErr)}
+	if authErr == nil {
+		authCheck.Detail = fmt.Sprintf("authenticated as %s in %s", auth.User, auth.Team)
+	}
+	checks = append(checks, authCheck)
+
+	slackChannel := config.SlackChannelName
+	channelCheck := ValidationCheck{Name: "slack channel"}
+	if commit.notifyChannel != "" {
+		slackChannel = commit.notifyChannel
+	}
+	if !isValidChannelName(slackChannel) {
+		channelCheck.Err = fmt.Errorf("%q is not a valid channel name or ID", slackChannel)
+	} else {
+		channelCheck.Detail, channelCheck.Err = checkChannel(ctx, client, config.SlackTeamID, slackChannel)
+	}
+	checks = append(checks, channelCheck)
+
+	userCheck := ValidationCheck{Name: "commit author"}
+	if commit.authorUsername == "" && commit.authorEmail == "" {
+		userCheck.Detail = "no author given, skipped"
+	} else {
+		slackUser := newSlackUserResolver(ctx, config, client).resolveUser(commit.authorEmail, commit.authorUsername)
+		if slackUser == nil {
+			userCheck.Err = fmt.Errorf("no slack user found for %s <%s>", commit.authorUsername, commit.authorEmail)
+		} else {
+			userCheck.Detail = fmt.Sprintf("%s <%s> is %s", commit.authorUsername, commit.authorEmail, slackUser.ID)
+		}
+	}
+	checks = append(checks, userCheck)
+
+	err = printValidationReport(checks)
+	return
+}
+
+// checkChannel resolves the channel and reads it back, since a channel given by ID is not looked up when resolved and
+// may not exist or be hidden from the bot
+func checkChannel(ctx context.Context, client *slack.Client, teamID, slackChannel string) (detail string, err error) {
+	channelID, err := resolveChannelID(client, teamID, slackChannel)
+	if err != nil {
+		return
+	}
+	channel, err := client.GetConversationInfoContext(ctx, &slack.GetConversationInfoInput{ChannelID: channelID})
+	if isSlackError(err, "channel_not_found") || isSlackError(err, "not_in_channel") {
+		err = fmt.Errorf("%w: %s, check the channel and that the bot can see it: %w", ErrChannelNotFound, slackChannel, err)
+	}
+	if err != nil {
+		err = wrapSlackAuthError(err)
+		return
+	}
+	detail = fmt.Sprintf("%s is %s", slackChannel, channelID)
+	if !channel.IsMember {
+		detail += ", the bot is not a member and will try to join it when posting"
+	}
+	return
+}
+
+// printValidationReport prints a PASS or FAIL line per check, returning an error joining the failures
+func printValidationReport(checks []ValidationCheck) error {
+	var errs []error
+	for _, check := range checks {
+		if check.Err != nil {
+			fmt.Printf("FAIL %s: %v\n", check.Name, check.Err)
+			errs = append(errs, fmt.Errorf("%s: %w", check.Name, check.Err))
+			continue
+		}
+		fmt.Printf("PASS %s: %s\n", check.Name, check.Detail)
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestRunValidation(t *testing.T) {
+	authTest := map[string]any{"ok": true, "user": "notifier", "team": "Acme"}
+	tests := []struct {
+		name             string
+		channel          string
+		conversationInfo map[string]any
+		wantErr          error
+	}{
+		{
+			name:             "known channel ID",
+			channel:          "C0123456789",
+			conversationInfo: map[string]any{"ok": true, "channel": map[string]any{"id": "C0123456789", "is_member": true}},
+		},
+		{
+			name:             "unknown channel ID",
+			channel:          "C0UNKNOWN00",
+			conversationInfo: map[string]any{"ok": false, "error": "channel_not_found"},
+			wantErr:          ErrChannelNotFound,
+		},
+		{
+			name:             "channel hidden from the bot",
+			channel:          "C0PRIVATE00",
+			conversationInfo: map[string]any{"ok": false, "error": "not_in_channel"},
+			wantErr:          ErrChannelNotFound,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			api := &fakeSlackAPI{responses: map[string][]map[string]any{
+				"auth.test":          {authTest},
+				"conversations.info": {test.conversationInfo},
+			}}
+			config := Config{SlackChannelName: test.channel}
+			err := runValidation(context.Background(), config, newFakeSlackClient(t, api), Commit{})
+			if !errors.Is(err, test.wantErr) || (test.wantErr == nil && err != nil) {
+				t.Errorf("got error %v, want %v", err, test.wantErr)
+			}
+			if got := api.callCount("conversations.info"); got != 1 {
+				t.Errorf("got %d conversations.info calls, want the channel ID checked once", got)
+			}
+			if got := api.callCount("chat.postMessage"); got != 0 {
+				t.Errorf("got %d posts, want none", got)
+			}
+		})
+	}
+}
+
+func TestRunTestNotification(t *testing.T) {
+	tests := []struct {
+		name         string
+		config       Config
+		response     map[string]any
+		wantThread   string
+		wantErr      error
+		wantMessages []MessageRef
+	}{
+		{
+			name:         "posted",
+			config:       Config{SlackChannelName: "C0123456789"},
+			response:     map[string]any{"ok": true, "channel": "C0123456789", "ts": "1700000000.000100"},
+			wantMessages: []MessageRef{{Channel: "C0123456789", Ts: "1700000000.000100"}},
+		},
+		{
+			name:         "posted in the thread",
+			config:       Config{SlackChannelName: "C0123456789", SlackThreadTs: "1690000000.000100"},
+			response:     map[string]any{"ok": true, "channel": "C0123456789", "ts": "1700000000.000100"},
+			wantThread:   "1690000000.000100",
+			wantMessages: []MessageRef{{Channel: "C0123456789", Ts: "1700000000.000100"}},
+		},
+		{
+			name:     "unknown channel",
+			config:   Config{SlackChannelName: "C0UNKNOWN00"},
+			response: map[string]any{"ok": false, "error": "channel_not_found"},
+			wantErr:  ErrChannelNotFound,
+		},
+		{
+			name:     "revoked token",
+			config:   Config{SlackChannelName: "C0123456789"},
+			response: map[string]any{"ok": false, "error": "token_revoked"},
+			wantErr:  ErrSlackAuth,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			api := &fakeSlackAPI{responses: map[string][]map[string]any{"chat.postMessage": {test.response}}}
+			summary := &RunSummary{}
+
+			err := runTestNotification(context.Background(), test.config, newFakeSlackClient(t, api), summary)
+			if !errors.Is(err, test.wantErr) || (test.wantErr == nil && err != nil) {
+				t.Errorf("got error %v, want %v", err, test.wantErr)
+			}
+			if texts := api.formValues("chat.postMessage", "text"); !reflect.DeepEqual(texts, []string{TestNotificationText}) {
+				t.Errorf("got texts %q, want the test notification", texts)
+			}
+			if threads := api.formValues("chat.postMessage", "thread_ts"); !reflect.DeepEqual(threads, []string{test.wantThread}) {
+				t.Errorf("got threads %q, want %q", threads, test.wantThread)
+			}
+			if !reflect.DeepEqual(summary.Messages, test.wantMessages) {
+				t.Errorf("got messages %+v, want %+v", summary.Messages, test.wantMessages)
+			}
+		})
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+const (
+	NotifierWebhook = "webhook"
+
+	// WebhookSignatureHeader carries the HMAC-SHA256 of the body, like GitHub's X-Hub-Signature-256
+	WebhookSignatureHeader = "X-Signature-256"
+)
+
+// WebhookPayload is the JSON body posted to WEBHOOK_URL
+type WebhookPayload struct {
+	Text       string                `json:"text"`
+	Status     string                `json:"status"`
+	Conclusion string                `json:"conclusion"`
+	Url        string                `json:"url"`
+	Repository string                `json:"repository"`
+	RunID      string                `json:"runId"`
+	Fields     []WebhookPayloadField `json:"fields"`
+}
+
+type WebhookPayloadField struct {
+	Title string `json:"title"`
+	Value string `json:"value"`
+	Short bool   `json:"short"`
+}
+
+// WebhookNotifier posts notifications as JSON to a generic HTTP endpoint, for chat tools without a dedicated notifier
+type WebhookNotifier struct {
+	config     Config
+	httpClient *http.Client
+	url        string
+}
+
+func (n *WebhookNotifier) Notify(ctx context.Context, notification Notification) (err error) {
+	if n.url == "" {
+		err = errors.New("no webhook url")
+		return
+	}
+
+	payload := WebhookPayload{
+		Text:       convertMrkdwnToPlainText(notification.Text),
+		Status:     notification.Status.DisplayName(),
+		Conclusion: notification.Status.Conclusion,
+		Url:        notification.Status.Url,
+		Repository: n.config.GithubRepository,
+		RunID:      n.config.GithubRunID,
+		Fields:     []WebhookPayloadField{},
+	}
+	for _, field := range notification.Fields {
+		payload.Fields = append(payload.Fields, WebhookPayloadField{Title: field.Title, Value: field.Value, Short: field.Short})
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return
+	}
+
+	err = postWebhook(ctx, n.config, n.httpClient, n.url, body)
+	if err != nil {
+		slog.Error("got error posting message to webhook", "error", err)
+		return
+	}
+	slog.Info("message sent to webhook")
+	return
+}
+
+// postWebhook posts the JSON body to the URL, retrying on transient errors. With WEBHOOK_SIGNING_SECRET the body is
+// signed, so the receiver can tell the request comes from us.
+func postWebhook(ctx context.Context, config Config, httpClient *http.Client, url string, body []byte) error {
+	return buildOtherRetryPolicy(config).retry(ctx, func(ctx context.Context) (err error) {
+		req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
+		if err != nil {
+			return permanent(err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		if config.WebhookSigningSecret != "" {
+			req.Header.Set(WebhookSignatureHeader, signWebhookBody(config.WebhookSigningSecret, body))
+		}
+
+		resp, err := httpClient.Do(req)
+		if err != nil {
+			return
+		}
+		defer func() {
+			closeErr := resp.Body.Close()
+			if closeErr != nil {
+				slog.Warn("got error closing webhook response body", "error", closeErr)
+			}
+		}()
+		return classifyHTTPResponse(resp)
+	})
+}
+
+// mrkdwnSpecialRegexp matches the <...> markup of Slack mrkdwn: links, mentions and special mentions
+var mrkdwnSpecialRegexp = regexp.MustCompile(`<([^<>|]*)(?:\|([^<>]*))?>`)
+
+// mrkdwnUnescaper undoes escapeMrkdwn
+var mrkdwnUnescaper = strings.NewReplacer("&lt;", "<", "&gt;", ">", "&amp;", "&")
+
+// convertMrkdwnToPlainText turns the Slack markup of the text into something readable in other chat tools: links
+// become "text (url)", mentions "@id" and channels "#name"
+func convertMrkdwnToPlainText(text string) string {
+	text = mrkdwnSpecialRegexp.ReplaceAllStringFunc(text, func(markup string) string {
+		match := mrkdwnSpecialRegexp.FindStringSubmatch(markup)
+		target, label := match[1], match[2]
+		switch {
+		case strings.HasPrefix(target, "@"):
+			return target
+		case strings.HasPrefix(target, "#"):
+			if label != "" {
+				return "#" + label
+			}
+			return target
+		case strings.HasPrefix(target, "!subteam^"):
+			return "@" + strings.TrimPrefix(target, "!subteam^")
+		case strings.HasPrefix(target, "!"):
+			return "@" + strings.TrimPrefix(target, "!")
+		case label != "":
+			return label + " (" + target + ")"
+		default:
+			return target
+		}
+	})
+	return mrkdwnUnescaper.Replace(text)
+}
+
+// signWebhookBody returns the "sha256=<hex>" HMAC-SHA256 signature of the body with the secret
+func signWebhookBody(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
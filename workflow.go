@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+)
+
+const NotifierWorkflow = "workflow"
+
+// WorkflowPayload is the JSON body posted to SLACK_WORKFLOW_WEBHOOK_URL. Workflow Builder only takes flat text
+// variables, named after these fields when setting up the webhook trigger.
+type WorkflowPayload struct {
+	Text        string `json:"text"`
+	Repository  string `json:"repository"`
+	CommitTitle string `json:"commit_title"`
+	CommitUrl   string `json:"commit_url"`
+	CommitSha   string `json:"commit_sha"`
+	Author      string `json:"author"`
+	AuthorEmail string `json:"author_email"`
+	Status      string `json:"status"`
+	Conclusion  string `json:"conclusion"`
+	StatusUrl   string `json:"status_url"`
+	RunID       string `json:"run_id"`
+}
+
+// WorkflowNotifier triggers a Slack Workflow Builder workflow, so the automation downstream can be built without code
+type WorkflowNotifier struct {
+	config     Config
+	httpClient *http.Client
+	url        string
+}
+
+func (n *WorkflowNotifier) Notify(ctx context.Context, notification Notification) (err error) {
+	if n.url == "" {
+		err = errors.New("no slack workflow webhook url")
+		return
+	}
+
+	body, err := json.Marshal(WorkflowPayload{
+		Text:        notification.Text,
+		Repository:  n.config.GithubRepository,
+		CommitTitle: notification.Commit.getCommitMessageTitle(),
+		CommitUrl:   notification.Commit.url,
+		CommitSha:   notification.Commit.sha,
+		Author:      notification.Commit.authorUsername,
+		AuthorEmail: notification.Commit.authorEmail,
+		Status:      notification.Status.DisplayName(),
+		Conclusion:  notification.Status.Conclusion,
+		StatusUrl:   notification.Status.Url,
+		RunID:       n.config.GithubRunID,
+	})
+	if err != nil {
+		return
+	}
+
+	err = postWebhook(ctx, n.config, n.httpClient, n.url, body)
+	if err != nil {
+		slog.Error("got error triggering slack workflow", "error", err)
+		return
+	}
+	slog.Info("slack workflow triggered")
+	return
+}